@@ -0,0 +1,197 @@
+package ixtar
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Builder assembles a bundle from files added one at a time, for content
+// that doesn't come from a directory on disk. File data is staged in a
+// temporary file; the index is kept in memory until WriteFile.
+type Builder struct {
+	data    *os.File
+	mem     *bytes.Buffer // staging of in-memory builders, instead of data
+	pos     int64
+	order   []string
+	entries map[string]*FileIndex
+
+	// Metadata is stored as bundle-wide metadata, like CreateOptions.Metadata.
+	Metadata map[string]string
+	// ContentTypes is stored like CreateOptions.ContentTypes.
+	ContentTypes map[string]string
+}
+
+func NewBuilder() (*Builder, error) {
+	data, err := os.CreateTemp("", "ixtar-data-*.tmp")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp data file: %w", err)
+	}
+
+	return &Builder{
+		data:    data,
+		entries: make(map[string]*FileIndex),
+	}, nil
+}
+
+// Add stores the content of r under filePath.
+func (b *Builder) Add(filePath string, r io.Reader) error {
+	cleanPath := filepath.ToSlash(normalizePath(filePath))
+	if err := checkStoredName(cleanPath); err != nil {
+		return err
+	}
+	hash := pathKey(md5Hasher{}, filePath)
+	if _, exists := b.entries[hash]; exists {
+		return fmt.Errorf("duplicate file: %s", filePath)
+	}
+
+	checksum := crc32.NewIEEE()
+	written, err := io.Copy(io.MultiWriter(b.stage(), checksum), r)
+	if err != nil {
+		return fmt.Errorf("failed to write data of %s: %w", filePath, err)
+	}
+
+	b.entries[hash] = &FileIndex{
+		Start: b.pos,
+		Size:  written,
+		Path:  cleanPath,
+		CRC32: formatCRC32(checksum.Sum32()),
+	}
+	b.order = append(b.order, hash)
+	b.pos += written
+	return nil
+}
+
+// AddBytes stores data under filePath.
+func (b *Builder) AddBytes(filePath string, data []byte) error {
+	return b.Add(filePath, bytes.NewReader(data))
+}
+
+// SetMeta attaches a metadata key to a file that was already added.
+func (b *Builder) SetMeta(filePath, key, value string) error {
+	fileIndex, exists := b.entries[pathKey(md5Hasher{}, filePath)]
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrFileNotFound, filePath)
+	}
+	if fileIndex.Meta == nil {
+		fileIndex.Meta = make(map[string]string)
+	}
+	fileIndex.Meta[key] = value
+	return nil
+}
+
+// GetMeta returns a metadata value previously set with SetMeta.
+func (b *Builder) GetMeta(filePath, key string) (string, bool) {
+	fileIndex, exists := b.entries[pathKey(md5Hasher{}, filePath)]
+	if !exists {
+		return "", false
+	}
+	value, ok := fileIndex.Meta[key]
+	return value, ok
+}
+
+// WriteFile writes the bundle to bundlePath. The builder can't be used
+// afterwards except for Close.
+func (b *Builder) WriteFile(bundlePath string) error {
+	header, csvData, infoData, data, err := b.prepare()
+	if err != nil {
+		return err
+	}
+	return writeBundleFile(bundlePath, header, csvData, infoData, data)
+}
+
+// stage returns where added data is written.
+func (b *Builder) stage() io.Writer {
+	if b.mem != nil {
+		return b.mem
+	}
+	return b.data
+}
+
+// prepare encodes the index and the info block and rewinds the staged data
+// for writeBundle.
+func (b *Builder) prepare() (bundleHeader, io.ReadSeeker, []byte, io.Reader, error) {
+	var csvData bytes.Buffer
+	csvWriter := csv.NewWriter(&csvData)
+	for _, hash := range b.order {
+		if err := writeCSVRecord(csvWriter, hash, *b.entries[hash]); err != nil {
+			return bundleHeader{}, nil, nil, nil, err
+		}
+	}
+	csvWriter.Flush()
+	if err := csvWriter.Error(); err != nil {
+		return bundleHeader{}, nil, nil, nil, fmt.Errorf("failed to flush CSV writer: %w", err)
+	}
+
+	infoData, err := encodeBundleInfo(bundleInfo{Creator: "ixtar " + Version, Metadata: b.Metadata, ContentTypes: b.ContentTypes})
+	if err != nil {
+		return bundleHeader{}, nil, nil, nil, err
+	}
+
+	var data io.Reader
+	if b.mem != nil {
+		data = bytes.NewReader(b.mem.Bytes())
+	} else {
+		if _, err := b.data.Seek(0, io.SeekStart); err != nil {
+			return bundleHeader{}, nil, nil, nil, fmt.Errorf("failed to seek data temp file: %w", err)
+		}
+		data = b.data
+	}
+
+	header := bundleHeader{csvSize: int64(csvData.Len())}
+	return header, bytes.NewReader(csvData.Bytes()), infoData, data, nil
+}
+
+// Close removes the builder's temporary data.
+func (b *Builder) Close() error {
+	if b.data == nil {
+		return nil
+	}
+	b.data.Close()
+	return os.Remove(b.data.Name())
+}
+
+// FileEntry is a file given to CreateBundleInMemory.
+type FileEntry struct {
+	Path string
+	Data []byte
+	Meta map[string]string // Per-file metadata, like Builder.SetMeta
+}
+
+// CreateBundleInMemory assembles a bundle of entries without touching the
+// disk and opens it. It returns the open bundle and its raw bytes, which can
+// be written out or opened again with NewIxTarAt. Meant for tests and small
+// pipelines; everything is held in memory.
+func CreateBundleInMemory(entries []FileEntry) (*IxTar, []byte, error) {
+	b := &Builder{mem: &bytes.Buffer{}, entries: make(map[string]*FileIndex)}
+	for _, entry := range entries {
+		if err := b.AddBytes(entry.Path, entry.Data); err != nil {
+			return nil, nil, err
+		}
+		for key, value := range entry.Meta {
+			if err := b.SetMeta(entry.Path, key, value); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	header, csvData, infoData, data, err := b.prepare()
+	if err != nil {
+		return nil, nil, err
+	}
+	var bundle bytes.Buffer
+	if err := writeBundle(&bundle, header, csvData, infoData, data); err != nil {
+		return nil, nil, err
+	}
+
+	raw := bundle.Bytes()
+	ix, err := NewIxTarAt(bytes.NewReader(raw), 0, int64(len(raw)))
+	if err != nil {
+		return nil, nil, err
+	}
+	return ix, raw, nil
+}
@@ -0,0 +1,107 @@
+package ixtar
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBuilderFileMeta(t *testing.T) {
+	b, err := NewBuilder()
+	if err != nil {
+		t.Fatalf("Failed to create builder: %v", err)
+	}
+	defer b.Close()
+
+	if err := b.AddBytes("index.html", []byte("<html></html>")); err != nil {
+		t.Fatalf("Failed to add file: %v", err)
+	}
+	if err := b.Add("app/main.js", strings.NewReader("console.log(1)")); err != nil {
+		t.Fatalf("Failed to add file: %v", err)
+	}
+	if err := b.AddBytes("./index.html", nil); err == nil {
+		t.Error("Expected error adding a duplicate path")
+	}
+
+	if err := b.SetMeta("app/main.js", "content-type", "text/javascript; charset=utf-8"); err != nil {
+		t.Fatalf("Failed to set meta: %v", err)
+	}
+	if err := b.SetMeta("app/main.js", "cache", "max-age=3600&public"); err != nil {
+		t.Fatalf("Failed to set meta: %v", err)
+	}
+	if err := b.SetMeta("missing.txt", "k", "v"); err == nil {
+		t.Error("Expected error setting meta on a missing file")
+	}
+	if value, ok := b.GetMeta("app/main.js", "cache"); !ok || value != "max-age=3600&public" {
+		t.Errorf("Unexpected GetMeta result %q, %v", value, ok)
+	}
+
+	bundlePath := filepath.Join(t.TempDir(), "built.ixtar")
+	if err := b.WriteFile(bundlePath); err != nil {
+		t.Fatalf("Failed to write bundle: %v", err)
+	}
+
+	ix, err := NewIxTar(bundlePath)
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	defer ix.Close()
+
+	data, err := ix.ExtractBytesOfFile("app/main.js")
+	if err != nil || string(data) != "console.log(1)" {
+		t.Errorf("Unexpected content %q, %v", data, err)
+	}
+
+	expected := map[string]string{
+		"content-type": "text/javascript; charset=utf-8",
+		"cache":        "max-age=3600&public",
+	}
+	if meta := ix.FileMeta("app/main.js"); !reflect.DeepEqual(meta, expected) {
+		t.Errorf("Expected meta %v, got %v", expected, meta)
+	}
+	if meta := ix.FileMeta("index.html"); meta != nil {
+		t.Errorf("Expected no meta, got %v", meta)
+	}
+}
+
+func TestCreateBundleInMemory(t *testing.T) {
+	ix, raw, err := CreateBundleInMemory([]FileEntry{
+		{Path: "index.html", Data: []byte("<html></html>")},
+		{Path: "app/main.js", Data: []byte("console.log(1)"), Meta: map[string]string{"content-type": "text/javascript"}},
+		{Path: "empty.txt"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create bundle: %v", err)
+	}
+	defer ix.Close()
+
+	if got, err := ix.ExtractBytesOfFile("app/main.js"); err != nil || string(got) != "console.log(1)" {
+		t.Errorf("Expected main.js content, got %q (%v)", got, err)
+	}
+	if meta := ix.FileMeta("app/main.js"); meta["content-type"] != "text/javascript" {
+		t.Errorf("Unexpected meta %v", meta)
+	}
+	if err := ix.VerifyAll(); err != nil {
+		t.Errorf("VerifyAll failed: %v", err)
+	}
+
+	// The raw bytes are a complete bundle
+	bundlePath := filepath.Join(t.TempDir(), "mem.ixtar")
+	if err := os.WriteFile(bundlePath, raw, 0644); err != nil {
+		t.Fatal(err)
+	}
+	ix2, err := NewIxTar(bundlePath)
+	if err != nil {
+		t.Fatalf("Failed to open written bundle: %v", err)
+	}
+	defer ix2.Close()
+	if want := []string{"app/main.js", "empty.txt", "index.html"}; !reflect.DeepEqual(ix2.ListPaths(), want) {
+		t.Errorf("Expected paths %v, got %v", want, ix2.ListPaths())
+	}
+
+	if _, _, err := CreateBundleInMemory([]FileEntry{{Path: "a"}, {Path: "./a"}}); err == nil {
+		t.Error("Expected error for duplicate paths")
+	}
+}
@@ -0,0 +1,174 @@
+package ixtar
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// checkpointEvery is how many files are added between the checkpoints of
+// CreateOptions.Checkpoint. Tests lower it.
+var checkpointEvery = 1000
+
+// checkpoint is what CreateOptions.Checkpoint saves of an unfinished bundle
+// written in place: the data written into the bundle file so far, and the
+// index records of that data, which are staged at indexPath.
+type checkpoint struct {
+	Bundle     string `json:"bundle"`
+	Source     string `json:"source"`
+	DataOffset int64  `json:"data_offset"`
+	DataSize   int64  `json:"data_size"`
+	IndexSize  int64  `json:"index_size"`
+	Partial    string `json:"partial"` // the unfinished bundle file, renamed to Bundle when done
+
+	// Encryption is the encryption of the bundle, whose key check and salt
+	// a resumed create must keep
+	Encryption *encryptionInfo `json:"encryption,omitempty"`
+
+	path   string // absolute path of the checkpoint
+	resume bool   // loaded from an earlier create
+}
+
+// openCheckpoint loads the checkpoint at path of a create of sourceDir into
+// bundlePath, or starts a new one if there is none.
+func openCheckpoint(path, bundlePath, sourceDir string) (*checkpoint, error) {
+	c := &checkpoint{}
+	var err error
+	if c.path, err = filepath.Abs(path); err != nil {
+		return nil, fmt.Errorf("failed to resolve checkpoint: %w", err)
+	}
+	bundle, err := filepath.Abs(bundlePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve bundle path: %w", err)
+	}
+	source, err := filepath.Abs(sourceDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve source directory: %w", err)
+	}
+
+	data, err := os.ReadFile(c.path)
+	if os.IsNotExist(err) {
+		c.Bundle, c.Source = bundle, source
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("invalid checkpoint %s: %w", path, err)
+	}
+	if c.Bundle != bundle || c.Source != source {
+		return nil, fmt.Errorf("checkpoint %s is of a create of %s into %s", path, c.Source, c.Bundle)
+	}
+	if c.DataOffset < headerSize || c.DataSize < 0 || c.IndexSize < 0 {
+		return nil, fmt.Errorf("invalid checkpoint %s: bad offsets", path)
+	}
+	if c.Partial == "" || filepath.Dir(c.Partial) != filepath.Dir(bundle) {
+		return nil, fmt.Errorf("invalid checkpoint %s: partial file %q isn't next to the bundle", path, c.Partial)
+	}
+	c.resume = true
+	return c, nil
+}
+
+// indexPath is where the index of the bundle is staged.
+func (c *checkpoint) indexPath() string {
+	return c.path + ".csv"
+}
+
+// owns reports whether path, found while walking the source directory, is
+// the checkpoint or one of its files.
+func (c *checkpoint) owns(path string, info os.FileInfo) bool {
+	if !strings.HasPrefix(info.Name(), filepath.Base(c.path)) {
+		return false
+	}
+	abs, err := filepath.Abs(path)
+	return err == nil && strings.HasPrefix(abs, c.path)
+}
+
+// openIndex opens the staged index. A resumed index is cut back to the
+// records of the checkpoint, which are returned; records written after it
+// describe data that may not have reached the bundle file.
+func (c *checkpoint) openIndex() (*os.File, DataIndex, error) {
+	if !c.resume {
+		f, err := os.Create(c.indexPath())
+		if err != nil {
+			return nil, DataIndex{}, fmt.Errorf("failed to create checkpoint index: %w", err)
+		}
+		return f, DataIndex{Files: make(map[string]FileIndex)}, nil
+	}
+
+	f, err := os.OpenFile(c.indexPath(), os.O_RDWR, 0)
+	if err != nil {
+		return nil, DataIndex{}, fmt.Errorf("failed to open checkpoint index: %w", err)
+	}
+	csvData := make([]byte, c.IndexSize)
+	if _, err := io.ReadFull(f, csvData); err != nil {
+		f.Close()
+		return nil, DataIndex{}, fmt.Errorf("failed to read checkpoint index: %w", err)
+	}
+	index, err := parseCSVIndex(csvData)
+	if err == nil {
+		err = f.Truncate(c.IndexSize)
+	}
+	if err != nil {
+		f.Close()
+		return nil, DataIndex{}, fmt.Errorf("failed to resume checkpoint index: %w", err)
+	}
+	return f, index, nil
+}
+
+// openBundle opens the partial bundle file of a resumed create, without the
+// data written after the checkpoint.
+func (c *checkpoint) openBundle() (*inPlaceOutput, error) {
+	file, err := os.OpenFile(c.Partial, os.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bundle file: %w", err)
+	}
+	end := c.DataOffset + c.DataSize
+	if info, err := file.Stat(); err != nil || info.Size() < end {
+		file.Close()
+		return nil, fmt.Errorf("bundle file %s is shorter than its checkpoint", c.Partial)
+	}
+	if err := file.Truncate(end); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to truncate bundle file: %w", err)
+	}
+	return &inPlaceOutput{file: file, path: c.Bundle, sizeEstimate: newSizeEstimate()}, nil
+}
+
+// save replaces the checkpoint, so an interrupted save leaves the previous
+// one. The caller syncs the bundle file and index first.
+func (c *checkpoint) save() error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	tmp := c.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, c.path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+// remove deletes the checkpoint and its index.
+func (c *checkpoint) remove() {
+	os.Remove(c.path)
+	os.Remove(c.indexPath())
+}
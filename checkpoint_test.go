@@ -0,0 +1,139 @@
+package ixtar
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCreateCheckpointResume(t *testing.T) {
+	defer func(every int) { checkpointEvery = every }(checkpointEvery)
+	checkpointEvery = 2
+
+	files := map[string]string{
+		"a.txt":     "alpha",
+		"b.txt":     "bravo",
+		"c.txt":     strings.Repeat("charlie", 1000),
+		"d.txt":     "delta",
+		"dir/e.txt": "echo",
+		"f.txt":     "foxtrot",
+	}
+	srcDir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(srcDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The checkpoint is in the tree being bundled and must not be added
+	checkpointPath := filepath.Join(srcDir, "create.checkpoint")
+	bundlePath := filepath.Join(t.TempDir(), "resumed.ixtar")
+	oldBundle := createTestBundle(t, map[string]string{"old.txt": "previous"})
+	if err := os.Rename(oldBundle, bundlePath); err != nil {
+		t.Fatal(err)
+	}
+
+	// Interrupt the create at d.txt
+	interrupted := errors.New("interrupted")
+	_, err := CreateBundleWithOptions(srcDir, bundlePath, CreateOptions{
+		Checkpoint: checkpointPath,
+		Compress:   func(path string) bool { return path == "c.txt" },
+		Transform: func(path string, r io.Reader) (io.Reader, error) {
+			if path == "d.txt" {
+				return nil, interrupted
+			}
+			return r, nil
+		},
+	})
+	if !errors.Is(err, interrupted) {
+		t.Fatalf("Expected the create to be interrupted, got %v", err)
+	}
+	partials, _ := filepath.Glob(filepath.Join(filepath.Dir(bundlePath), ".resumed.ixtar.*.partial"))
+	if len(partials) != 1 {
+		t.Fatalf("Expected one partial bundle file, got %v", partials)
+	}
+	for _, path := range []string{checkpointPath, checkpointPath + ".csv", partials[0]} {
+		if _, err := os.Stat(path); err != nil {
+			t.Fatalf("Expected %s to be kept: %v", path, err)
+		}
+	}
+	// Until it is complete, the bundle it replaces is left as it was
+	if ix, err := NewIxTar(bundlePath); err != nil {
+		t.Errorf("Expected the previous bundle to be kept: %v", err)
+	} else {
+		if got, err := ix.ExtractBytesOfFile("old.txt"); err != nil || string(got) != "previous" {
+			t.Errorf("Expected the previous bundle to be kept, got %q (%v)", got, err)
+		}
+		ix.Close()
+	}
+
+	// A checkpoint only resumes the create it was saved by
+	_, err = CreateBundleWithOptions(t.TempDir(), bundlePath, CreateOptions{Checkpoint: checkpointPath})
+	if err == nil || !strings.Contains(err.Error(), "checkpoint") {
+		t.Errorf("Expected another source directory to be refused, got %v", err)
+	}
+
+	// What was written after the checkpoint, as by a crash, is dropped
+	for _, path := range []string{partials[0], checkpointPath + ".csv"} {
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.WriteString("garbage,after,the,checkpoint\n")
+		f.Close()
+	}
+
+	var transformed []string
+	result, err := CreateBundleWithOptions(srcDir, bundlePath, CreateOptions{
+		Checkpoint: checkpointPath,
+		Compress:   func(path string) bool { return path == "c.txt" },
+		Transform: func(path string, r io.Reader) (io.Reader, error) {
+			transformed = append(transformed, path)
+			return r, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to resume: %v", err)
+	}
+	if strings.Join(transformed, ",") != "d.txt,dir/e.txt,f.txt" {
+		t.Errorf("Expected only the files after the checkpoint to be read, got %v", transformed)
+	}
+	if result.Files != len(files) {
+		t.Errorf("Expected %d files, got %+v", len(files), result)
+	}
+	for _, path := range []string{checkpointPath, checkpointPath + ".csv", partials[0]} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("Expected %s to be removed, got %v", path, err)
+		}
+	}
+
+	ix, err := NewIxTar(bundlePath)
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	defer ix.Close()
+	if ix.Len() != len(files) {
+		t.Errorf("Expected %d files, got %d", len(files), ix.Len())
+	}
+	for name, content := range files {
+		if got, err := ix.ExtractBytesOfFile(name); err != nil || string(got) != content {
+			t.Errorf("%s: got %q (%v)", name, got, err)
+		}
+	}
+	if err := ix.VerifyAll(); err != nil {
+		t.Errorf("Verify failed: %v", err)
+	}
+}
+
+func TestCreateCheckpointUnsupported(t *testing.T) {
+	_, err := CreateBundleToWriter(t.TempDir(), io.Discard, CreateOptions{Checkpoint: filepath.Join(t.TempDir(), "ckpt")})
+	if err == nil {
+		t.Error("Expected Checkpoint to need a bundle file")
+	}
+}
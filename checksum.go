@@ -0,0 +1,108 @@
+package ixtar
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// ErrChecksumMismatch is returned when file data doesn't match the CRC32
+// stored in the index.
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// WithVerifyOnRead makes ExtractBytesOfFile, ExtractToWriter, WalkFiles and
+// ExtractAll compare file data against the CRC32 stored in the index before
+// returning it. Files without a stored checksum are returned unchecked.
+func WithVerifyOnRead() OpenOption {
+	return func(c *openConfig) {
+		c.verifyOnRead = true
+	}
+}
+
+// formatCRC32 encodes a checksum the way it is stored in the index.
+func formatCRC32(sum uint32) string {
+	return fmt.Sprintf("%08x", sum)
+}
+
+// checkCRC32 compares the stored bytes of an entry against its checksum.
+func checkCRC32(fileIndex FileIndex, stored []byte) error {
+	if fileIndex.CRC32 == "" {
+		return nil
+	}
+	return compareCRC32(fileIndex, crc32.ChecksumIEEE(stored))
+}
+
+func compareCRC32(fileIndex FileIndex, sum uint32) error {
+	if got := formatCRC32(sum); got != fileIndex.CRC32 {
+		return fmt.Errorf("%w: %s: expected crc32 %s, got %s", ErrChecksumMismatch, entryName("", fileIndex), fileIndex.CRC32, got)
+	}
+	return nil
+}
+
+// ExtractToWriter streams the content of a file into w and returns the
+// number of bytes written. With WithVerifyOnRead the checksum is only known
+// after the last byte, so on a mismatch w has already received the data and
+// ErrChecksumMismatch is returned.
+func (ix *IxTar) ExtractToWriter(filePath string, w io.Writer) (int64, error) {
+	fileIndex, err := ix.lookup(filePath)
+	if err != nil {
+		return 0, err
+	}
+
+	// Sparse files are expanded in memory, and encrypted files are
+	// authenticated as a whole before any of them is written
+	if fileIndex.Sparse != nil || fileIndex.encrypted() {
+		data, err := ix.extractEntry(fileIndex)
+		if err != nil {
+			return 0, err
+		}
+		n, err := w.Write(data)
+		return int64(n), err
+	}
+
+	var r io.Reader = io.NewSectionReader(ix.reader, ix.dataOffset+fileIndex.Start, fileIndex.storedSize())
+	verify := ix.verify && fileIndex.CRC32 != ""
+	hash := crc32.NewIEEE()
+	if verify {
+		r = io.TeeReader(r, hash)
+	}
+	if fileIndex.compressed() {
+		r = inflate(r, fileIndex)
+	}
+
+	n, err := io.Copy(w, r)
+	if err != nil {
+		return n, fmt.Errorf("failed to copy file data: %w", err)
+	}
+	if n != fileIndex.Size {
+		return n, fmt.Errorf("failed to read file data: %w", io.ErrUnexpectedEOF)
+	}
+
+	if verify {
+		return n, compareCRC32(fileIndex, hash.Sum32())
+	}
+	return n, nil
+}
+
+// Manifest returns the SHA-256 of every file, keyed by stored path (or hash
+// for bundles that don't store paths), for checking extracted files with
+// external tools. The CRC32 kept in the index only detects accidental
+// corruption, so the SHA-256 sums are computed by reading every file.
+func (ix *IxTar) Manifest() (map[string]string, error) {
+	manifest := make(map[string]string, len(ix.files()))
+	err := ix.ExtractAllTo(func(name string, r io.Reader, entry FileStat) error {
+		sum := sha256.New()
+		if _, err := io.Copy(sum, r); err != nil {
+			return fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		manifest[name] = hex.EncodeToString(sum.Sum(nil))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
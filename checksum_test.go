@@ -0,0 +1,258 @@
+package ixtar
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// corruptFile flips one byte of a file's data inside the bundle.
+func corruptFile(t *testing.T, bundlePath, filePath string) {
+	t.Helper()
+
+	ix, err := NewIxTar(bundlePath)
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	stat, err := ix.Stat(filePath)
+	ix.Close()
+	if err != nil {
+		t.Fatalf("Failed to stat %s: %v", filePath, err)
+	}
+
+	f, err := os.OpenFile(bundlePath, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatalf("Failed to open bundle for writing: %v", err)
+	}
+	defer f.Close()
+
+	b := make([]byte, 1)
+	if _, err := f.ReadAt(b, stat.Offset); err != nil {
+		t.Fatalf("Failed to read bundle byte: %v", err)
+	}
+	b[0] ^= 0xff
+	if _, err := f.WriteAt(b, stat.Offset); err != nil {
+		t.Fatalf("Failed to corrupt bundle: %v", err)
+	}
+}
+
+func TestVerifyOnReadDetectsCorruption(t *testing.T) {
+	bundlePath := createTestBundle(t, map[string]string{
+		"good.txt": "untouched content",
+		"bad.txt":  "content that will rot",
+	})
+	corruptFile(t, bundlePath, "bad.txt")
+
+	ix, err := NewIxTar(bundlePath, WithVerifyOnRead())
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	defer ix.Close()
+
+	if _, err := ix.ExtractBytesOfFile("bad.txt"); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("Expected ErrChecksumMismatch, got %v", err)
+	}
+	var buf bytes.Buffer
+	if _, err := ix.ExtractToWriter("bad.txt", &buf); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("Expected ErrChecksumMismatch from ExtractToWriter, got %v", err)
+	}
+
+	data, err := ix.ExtractBytesOfFile("good.txt")
+	if err != nil || string(data) != "untouched content" {
+		t.Errorf("Unexpected content of good file: %q, %v", data, err)
+	}
+
+	if err := ix.VerifyAll(); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("Expected VerifyAll to report the mismatch, got %v", err)
+	}
+
+	unverified, err := NewIxTar(bundlePath)
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	defer unverified.Close()
+	if _, err := unverified.ExtractBytesOfFile("bad.txt"); err != nil {
+		t.Errorf("Expected read without verification to succeed, got %v", err)
+	}
+}
+
+func TestVerifyOnReadWithoutStoredChecksum(t *testing.T) {
+	bundlePath := writeRawBundle(t, hashFilePath(md5Hasher{}, "a.txt")+",0,5,a.txt\n", "hello")
+
+	ix, err := NewIxTar(bundlePath, WithVerifyOnRead())
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	defer ix.Close()
+
+	var buf bytes.Buffer
+	if _, err := ix.ExtractToWriter("a.txt", &buf); err != nil {
+		t.Errorf("Expected no verification without checksum, got %v", err)
+	}
+}
+
+func TestVerifyAllCollectsAllMismatches(t *testing.T) {
+	files := map[string]string{}
+	for i := 0; i < 50; i++ {
+		files[fmt.Sprintf("file%02d.txt", i)] = strings.Repeat(fmt.Sprint(i), 100)
+	}
+	bundlePath := createTestBundle(t, files)
+	corruptFile(t, bundlePath, "file03.txt")
+	corruptFile(t, bundlePath, "file41.txt")
+
+	ix, err := NewIxTar(bundlePath)
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	defer ix.Close()
+
+	for _, workers := range []int{0, 1, 4} {
+		err := ix.VerifyAllWithOptions(VerifyOptions{Workers: workers})
+		if !errors.Is(err, ErrChecksumMismatch) {
+			t.Fatalf("Workers=%d: expected ErrChecksumMismatch, got %v", workers, err)
+		}
+		problems := err.(interface{ Unwrap() []error }).Unwrap()
+		if len(problems) != 2 {
+			t.Errorf("Workers=%d: expected 2 problems, got %d: %v", workers, len(problems), err)
+		}
+		if !strings.Contains(err.Error(), "file03.txt") || !strings.Contains(err.Error(), "file41.txt") {
+			t.Errorf("Workers=%d: mismatching files not reported: %v", workers, err)
+		}
+	}
+
+	if err := ix.VerifyAllWithOptions(VerifyOptions{Workers: -1}); err == nil {
+		t.Error("Expected error for negative worker count")
+	}
+}
+
+func benchmarkVerifyAll(b *testing.B, workers int) {
+	srcDir := b.TempDir()
+	content := bytes.Repeat([]byte{'x'}, 16<<10)
+	for i := 0; i < 4000; i++ {
+		if err := os.WriteFile(filepath.Join(srcDir, fmt.Sprintf("file%d.bin", i)), content, 0644); err != nil {
+			b.Fatal(err)
+		}
+	}
+	bundlePath := filepath.Join(b.TempDir(), "bench.ixtar")
+	if err := CreateBundle(srcDir, bundlePath); err != nil {
+		b.Fatal(err)
+	}
+
+	ix, err := NewIxTar(bundlePath)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer ix.Close()
+
+	b.SetBytes(int64(4000 * len(content)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := ix.VerifyAllWithOptions(VerifyOptions{Workers: workers}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkVerifyAllSerial(b *testing.B) { benchmarkVerifyAll(b, 1) }
+
+func BenchmarkVerifyAllParallel(b *testing.B) { benchmarkVerifyAll(b, 0) }
+
+func TestManifest(t *testing.T) {
+	testFiles := map[string]string{
+		"a.txt":     "alpha",
+		"dir/b.txt": "bravo",
+	}
+	bundlePath := createTestBundle(t, testFiles)
+
+	ix, err := NewIxTar(bundlePath)
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	defer ix.Close()
+
+	manifest, err := ix.Manifest()
+	if err != nil {
+		t.Fatalf("Failed to build manifest: %v", err)
+	}
+	if len(manifest) != len(testFiles) {
+		t.Errorf("Expected %d entries, got %v", len(testFiles), manifest)
+	}
+	for path, content := range testFiles {
+		sum := sha256.Sum256([]byte(content))
+		if want := hex.EncodeToString(sum[:]); manifest[path] != want {
+			t.Errorf("%s: expected %s, got %s", path, want, manifest[path])
+		}
+	}
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n *int64
+}
+
+func (c countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	*c.n += int64(n)
+	return n, err
+}
+
+func TestCreateChecksumsStoredBytes(t *testing.T) {
+	files := map[string]string{
+		"plain.txt":  "alpha",
+		"packed.txt": strings.Repeat("compress me ", 1000),
+		"empty.txt":  "",
+	}
+	srcDir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(srcDir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Each file is read once, by the copy that stores and checksums it
+	read := make(map[string]*int64)
+	bundlePath := filepath.Join(t.TempDir(), "test.ixtar")
+	_, err := CreateBundleWithOptions(srcDir, bundlePath, CreateOptions{
+		Compress: func(path string) bool { return path == "packed.txt" },
+		Transform: func(path string, r io.Reader) (io.Reader, error) {
+			read[path] = new(int64)
+			return countingReader{r, read[path]}, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create bundle: %v", err)
+	}
+	for name, content := range files {
+		if n := read[name]; n == nil || *n != int64(len(content)) {
+			t.Errorf("%s: expected %d bytes read once, got %v", name, len(content), n)
+		}
+	}
+
+	ix, err := NewIxTar(bundlePath)
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	defer ix.Close()
+	for name := range files {
+		fileIndex, err := ix.lookup(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stored, err := ix.readStored(fileIndex)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := formatCRC32(crc32.ChecksumIEEE(stored)); fileIndex.CRC32 != want {
+			t.Errorf("%s: stored crc32 %s, computed %s", name, fileIndex.CRC32, want)
+		}
+	}
+}
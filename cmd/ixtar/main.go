@@ -1,13 +1,42 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
+	"log/slog"
 	"os"
+	"os/signal"
+	"sort"
+	"sync/atomic"
+	"time"
 
 	"github.com/t0mk/ixtar"
 )
 
+// maxReportedProblems caps how many verification problems are printed.
+const maxReportedProblems = 10
+
+// failVerification prints the problems of err, which may join several, and
+// exits with status 2.
+func failVerification(bundlePath string, err error) {
+	problems := []error{err}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		problems = joined.Unwrap()
+	}
+	fmt.Fprintf(os.Stderr, "Bundle %s failed verification (%d problems):\n", bundlePath, len(problems))
+	for i, problem := range problems {
+		if i == maxReportedProblems {
+			fmt.Fprintf(os.Stderr, "  ...\n")
+			break
+		}
+		fmt.Fprintf(os.Stderr, "  %v\n", problem)
+	}
+	os.Exit(2)
+}
+
 func main() {
 	if len(os.Args) < 2 {
 		printUsage()
@@ -18,38 +47,142 @@ func main() {
 
 	switch command {
 	case "create":
-		if len(os.Args) != 4 {
-			fmt.Fprintf(os.Stderr, "Usage: ixtar create <directory> <output.ixtar>\n")
+		fs := flag.NewFlagSet("create", flag.ExitOnError)
+		baseDir := fs.String("base-dir", "", "store paths relative to this directory instead of <directory>")
+		continueOnError := fs.Bool("continue-on-error", false, "skip unreadable files instead of failing")
+		dryRun := fs.Bool("dry-run", false, "list the files that would be bundled without writing the bundle")
+		ignoreFile := fs.String("ignore-file", "", "exclude paths matching patterns in this file (default <directory>/.ixtarignore)")
+		trailer := fs.Bool("trailer", false, "append a copy of the index after the data")
+		skipHidden := fs.Bool("skip-hidden", false, "leave out files and directories whose name starts with a dot")
+		hash := fs.String("hash", "md5", "path hash algorithm of the index: md5 or xxh64")
+		tempDir := fs.String("temp-dir", "", "stage the index in this directory (default the output's directory)")
+		compress := fs.Bool("compress", false, "store files DEFLATE compressed")
+		verbose := fs.Bool("verbose", false, "log every skipped entry to stderr")
+		followSymlinks := fs.Bool("follow-symlinks", false, "store the targets of symlinks instead of leaving them out")
+		checkpoint := fs.String("checkpoint", "", "save progress to this file, and resume from it if it exists")
+		modifiedAfter := fs.String("modified-after", "", "only add files modified after this RFC 3339 time")
+		fs.Parse(os.Args[2:])
+		if fs.NArg() != 2 {
+			fmt.Fprintf(os.Stderr, "Usage: ixtar create [--base-dir DIR] [--continue-on-error] [--ignore-file FILE] [--dry-run] [--skip-hidden] [--trailer] [--hash ALG] [--temp-dir DIR] [--compress] [--verbose] [--follow-symlinks] [--checkpoint FILE] [--modified-after TIME] <directory> <output.ixtar>\n")
 			os.Exit(1)
 		}
-		sourceDir := os.Args[2]
-		outputPath := os.Args[3]
+		sourceDir := fs.Arg(0)
+		outputPath := fs.Arg(1)
+		hashAlgorithm, err := ixtar.ParseHashAlgorithm(*hash)
+		if err != nil {
+			log.Fatalf("Invalid --hash: %v", err)
+		}
+		var after time.Time
+		if *modifiedAfter != "" {
+			if after, err = time.Parse(time.RFC3339, *modifiedAfter); err != nil {
+				log.Fatalf("Invalid --modified-after: %v", err)
+			}
+		}
+		var logger *slog.Logger
+		if *verbose {
+			logger = slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug}))
+		}
+		// Ctrl-C stops at the next progress report, which cleans up the
+		// partial bundle or saves the checkpoint; a second one kills the
+		// process as usual
+		var interrupted atomic.Bool
+		interrupt := make(chan os.Signal, 1)
+		signal.Notify(interrupt, os.Interrupt)
+		go func() {
+			if _, ok := <-interrupt; ok {
+				interrupted.Store(true)
+				signal.Stop(interrupt)
+			}
+		}()
 		
-		err := ixtar.CreateBundleWithProgress(sourceDir, outputPath, func(current, total int, filename string) {
-			percent := float64(current) / float64(total) * 100
-			fmt.Printf("\r[%3.0f%%]", percent)
+		result, err := ixtar.CreateBundleWithOptions(sourceDir, outputPath, ixtar.CreateOptions{
+			BaseDir:         *baseDir,
+			ContinueOnError: *continueOnError,
+			IgnoreFile:      *ignoreFile,
+			DryRun:          *dryRun,
+			SkipHidden:      *skipHidden,
+			Trailer:         *trailer,
+			HashAlgorithm:   hashAlgorithm,
+			TempDir:         *tempDir,
+			Compress:        compressFunc(*compress),
+			Logger:          logger,
+			FollowSymlinks:  *followSymlinks,
+			Checkpoint:      *checkpoint,
+			ModifiedAfter:   after,
+			OnError: func(path string, err error) {
+				fmt.Fprintf(os.Stderr, "\rWarning: skipping %s: %v\n", path, err)
+			},
+			AbortableProgress: func(current, total int, filename string) error {
+				if interrupted.Load() {
+					return errors.New("interrupted")
+				}
+				percent := float64(current) / float64(total) * 100
+				fmt.Printf("\r[%3.0f%%]", percent)
+				return nil
+			},
 		})
+		signal.Stop(interrupt)
+		close(interrupt)
 		
 		if err != nil {
 			fmt.Println()
 			log.Fatalf("Failed to create bundle: %v", err)
 		}
 		
-		fmt.Printf("\nBundle created: %s\n", outputPath)
+		if *dryRun {
+			fmt.Println()
+			for _, path := range result.Paths {
+				fmt.Println(path)
+			}
+			fmt.Printf("Would bundle %d files, %d bytes, into a bundle of at most %d bytes\n", result.Files, result.Bytes, result.EstimatedSize)
+		} else {
+			fmt.Printf("\nBundle created: %s (%d files)\n", outputPath, result.Files)
+		}
+		if result.SkippedSpecial > 0 {
+			fmt.Printf("Skipped %d special files (devices, FIFOs, sockets)\n", result.SkippedSpecial)
+		}
+		if result.SkippedSymlinks > 0 {
+			fmt.Printf("Skipped %d symbolic links\n", result.SkippedSymlinks)
+		}
+		if result.SkippedIgnored > 0 {
+			fmt.Printf("Ignored %d entries\n", result.SkippedIgnored)
+		}
+		if result.SkippedHidden > 0 {
+			fmt.Printf("Skipped %d hidden entries\n", result.SkippedHidden)
+		}
+		if result.SkippedErrors > 0 {
+			fmt.Printf("Skipped %d unreadable entries\n", result.SkippedErrors)
+		}
+		if result.SkippedOlder > 0 {
+			fmt.Printf("Skipped %d files not modified after %s\n", result.SkippedOlder, *modifiedAfter)
+		}
+		for _, path := range result.Shrunk {
+			fmt.Fprintf(os.Stderr, "Warning: %s shrank while being read, stored truncated\n", path)
+		}
 
 	case "list":
-		if len(os.Args) != 3 {
-			fmt.Fprintf(os.Stderr, "Usage: ixtar list <bundle.ixtar>\n")
+		fs := flag.NewFlagSet("list", flag.ExitOnError)
+		jsonOutput := fs.Bool("json", false, "print JSON instead of text")
+		fs.Parse(os.Args[2:])
+		if fs.NArg() != 1 {
+			fmt.Fprintf(os.Stderr, "Usage: ixtar list [--json] <bundle.ixtar>\n")
 			os.Exit(1)
 		}
-		bundlePath := os.Args[2]
-		
+		bundlePath := fs.Arg(0)
+
 		ix, err := ixtar.NewIxTar(bundlePath)
 		if err != nil {
 			log.Fatalf("Failed to open bundle: %v", err)
 		}
 		defer ix.Close()
-		
+
+		if *jsonOutput {
+			printJSON(struct {
+				Files []ixtar.FileStat `json:"files"`
+			}{ix.Entries()})
+			break
+		}
+
 		files := ix.ListFiles()
 		fmt.Printf("Files in bundle (%d total):\n", len(files))
 		for _, hash := range files {
@@ -79,22 +212,67 @@ func main() {
 		}
 
 	case "info":
-		if len(os.Args) != 3 {
-			fmt.Fprintf(os.Stderr, "Usage: ixtar info <bundle.ixtar>\n")
+		fs := flag.NewFlagSet("info", flag.ExitOnError)
+		jsonOutput := fs.Bool("json", false, "print JSON instead of text")
+		fs.Parse(os.Args[2:])
+		if fs.NArg() != 1 {
+			fmt.Fprintf(os.Stderr, "Usage: ixtar info [--json] <bundle.ixtar>\n")
 			os.Exit(1)
 		}
-		bundlePath := os.Args[2]
-		
+		bundlePath := fs.Arg(0)
+
 		ix, err := ixtar.NewIxTar(bundlePath)
 		if err != nil {
 			log.Fatalf("Failed to open bundle: %v", err)
 		}
 		defer ix.Close()
-		
-		fileCount, csvSize := ix.Info()
+
+		stats := ix.Stats()
+		if *jsonOutput {
+			info := struct {
+				Bundle         string            `json:"bundle"`
+				CreatedAt      *time.Time        `json:"created_at,omitempty"`
+				CreatorVersion string            `json:"creator_version,omitempty"`
+				Metadata       map[string]string `json:"metadata,omitempty"`
+				PathHash       string            `json:"path_hash"`
+				RandomAccess   bool              `json:"random_access"`
+				ixtar.BundleStats
+			}{Bundle: bundlePath, CreatorVersion: ix.CreatorVersion(), Metadata: ix.Metadata(), PathHash: ix.KeyerID(), RandomAccess: ix.SupportsRandomAccess(), BundleStats: stats}
+			if createdAt := ix.CreatedAt(); !createdAt.IsZero() {
+				info.CreatedAt = &createdAt
+			}
+			printJSON(info)
+			break
+		}
+
 		fmt.Printf("Bundle: %s\n", bundlePath)
-		fmt.Printf("Files: %d\n", fileCount)
-		fmt.Printf("CSV index size: %d bytes\n", csvSize)
+		if createdAt := ix.CreatedAt(); !createdAt.IsZero() {
+			fmt.Printf("Created: %s\n", createdAt.Format(time.RFC3339))
+		}
+		if creator := ix.CreatorVersion(); creator != "" {
+			fmt.Printf("Creator: %s\n", creator)
+		}
+		fmt.Printf("Path hash: %s\n", ix.KeyerID())
+		if !ix.SupportsRandomAccess() {
+			fmt.Printf("Random access: no (gzip-compressed as a whole)\n")
+		}
+		fmt.Printf("Files: %d\n", stats.FileCount)
+		fmt.Printf("Source entries: %d regular files, %d directories, %d symlinks, %d other\n", stats.RegularFiles, stats.Directories, stats.Symlinks, stats.Other)
+		fmt.Printf("CSV index size: %d bytes\n", stats.CSVSize)
+		fmt.Printf("Logical size: %d bytes\n", stats.LogicalBytes)
+		fmt.Printf("Stored size: %d bytes (compression ratio %.2f)\n", stats.StoredBytes, stats.CompressionRatio())
+		fmt.Printf("Unique size: %d bytes (dedup ratio %.2f)\n", stats.UniqueBytes, stats.DedupRatio())
+		if metadata := ix.Metadata(); len(metadata) > 0 {
+			keys := make([]string, 0, len(metadata))
+			for k := range metadata {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			fmt.Printf("Metadata:\n")
+			for _, k := range keys {
+				fmt.Printf("  %s=%s\n", k, metadata[k])
+			}
+		}
 
 	case "extract-tar":
 		if len(os.Args) != 4 {
@@ -117,6 +295,279 @@ func main() {
 		
 		fmt.Printf("Bundle extracted to: %s\n", outputDir)
 
+	case "extract-all":
+		fs := flag.NewFlagSet("extract-all", flag.ExitOnError)
+		stripComponents := fs.Int("strip-components", 0, "strip this many leading path elements")
+		continueOnError := fs.Bool("continue-on-error", false, "report files that fail and extract the rest")
+		fs.Parse(os.Args[2:])
+		if fs.NArg() != 2 {
+			fmt.Fprintf(os.Stderr, "Usage: ixtar extract-all [--strip-components N] [--continue-on-error] <bundle.ixtar> <dest-dir>\n")
+			os.Exit(1)
+		}
+		bundlePath := fs.Arg(0)
+		destDir := fs.Arg(1)
+
+		ix, err := ixtar.NewIxTar(bundlePath)
+		if err != nil {
+			log.Fatalf("Failed to open bundle: %v", err)
+		}
+		defer ix.Close()
+
+		result, err := ix.ExtractAllWithOptions(destDir, ixtar.ExtractOptions{
+			StripComponents: *stripComponents,
+			ContinueOnError: *continueOnError,
+		})
+		if err != nil {
+			log.Fatalf("Failed to extract bundle: %v", err)
+		}
+
+		fmt.Printf("Extracted %d files, %d bytes to: %s\n", result.Files, result.Bytes, destDir)
+		if result.Skipped > 0 {
+			fmt.Printf("Skipped %d files stripped of their whole path\n", result.Skipped)
+		}
+		for _, err := range result.Errors {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
+		if len(result.Errors) > 0 {
+			fmt.Fprintf(os.Stderr, "Failed to extract %d files\n", len(result.Errors))
+			os.Exit(1)
+		}
+
+	case "sync":
+		fs := flag.NewFlagSet("sync", flag.ExitOnError)
+		prune := fs.Bool("prune", false, "delete files in dest-dir that are not in the bundle")
+		fs.Parse(os.Args[2:])
+		if fs.NArg() != 2 {
+			fmt.Fprintf(os.Stderr, "Usage: ixtar sync [--prune] <bundle.ixtar> <dest-dir>\n")
+			os.Exit(1)
+		}
+		bundlePath := fs.Arg(0)
+		destDir := fs.Arg(1)
+
+		result, err := ixtar.SyncWithOptions(bundlePath, destDir, ixtar.SyncOptions{Prune: *prune})
+		if err != nil {
+			log.Fatalf("Failed to sync bundle: %v", err)
+		}
+
+		fmt.Printf("Synced %s: %d added, %d updated, %d deleted, %d unchanged\n",
+			destDir, result.Added, result.Updated, result.Deleted, result.Unchanged)
+
+	case "stat":
+		fs := flag.NewFlagSet("stat", flag.ExitOnError)
+		jsonOutput := fs.Bool("json", false, "print JSON instead of text")
+		fs.Parse(os.Args[2:])
+		if fs.NArg() != 2 {
+			fmt.Fprintf(os.Stderr, "Usage: ixtar stat [--json] <bundle.ixtar> <file-path>\n")
+			os.Exit(1)
+		}
+		bundlePath := fs.Arg(0)
+		filePath := fs.Arg(1)
+
+		ix, err := ixtar.NewIxTar(bundlePath)
+		if err != nil {
+			log.Fatalf("Failed to open bundle: %v", err)
+		}
+		defer ix.Close()
+
+		stat, err := ix.Stat(filePath)
+		if err != nil {
+			log.Fatalf("Failed to stat file %s: %v", filePath, err)
+		}
+
+		if *jsonOutput {
+			printJSON(stat)
+			break
+		}
+
+		if stat.Path != "" {
+			fmt.Printf("Path: %s\n", stat.Path)
+		}
+		fmt.Printf("Hash: %s\n", stat.Hash)
+		fmt.Printf("Size: %d bytes\n", stat.Size)
+		fmt.Printf("Offset: %d\n", stat.Offset)
+		if stat.Compression != "" {
+			fmt.Printf("Compression: %s\n", stat.Compression)
+		}
+		if stat.Encryption != "" {
+			fmt.Printf("Encryption: %s\n", stat.Encryption)
+		}
+
+	case "layout":
+		if len(os.Args) != 3 {
+			fmt.Fprintf(os.Stderr, "Usage: ixtar layout <bundle.ixtar>\n")
+			os.Exit(1)
+		}
+		bundlePath := os.Args[2]
+
+		ix, err := ixtar.NewIxTar(bundlePath)
+		if err != nil {
+			log.Fatalf("Failed to open bundle: %v", err)
+		}
+		defer ix.Close()
+
+		layout := ix.Layout()
+		fmt.Printf("%-8s %12s %12s\n", "Section", "Offset", "Size")
+		fmt.Printf("%-8s %12d %12d\n", "header", 0, layout.HeaderSize)
+		fmt.Printf("%-8s %12d %12d\n", "csv", layout.CSVOffset, layout.CSVSize)
+		fmt.Printf("%-8s %12d %12d\n", "info", layout.InfoOffset, layout.InfoSize)
+		fmt.Printf("%-8s %12d %12d\n", "data", layout.DataOffset, layout.DataSize)
+		if layout.TrailerSize > 0 {
+			fmt.Printf("%-8s %12d %12d\n", "trailer", layout.TrailerOffset, layout.TrailerSize)
+		}
+		fmt.Printf("%-8s %12s %12d\n", "total", "", layout.TotalSize)
+
+	case "dump-index":
+		if len(os.Args) != 3 {
+			fmt.Fprintf(os.Stderr, "Usage: ixtar dump-index <bundle.ixtar>\n")
+			os.Exit(1)
+		}
+		bundlePath := os.Args[2]
+
+		ix, err := ixtar.NewIxTar(bundlePath)
+		if err != nil {
+			log.Fatalf("Failed to open bundle: %v", err)
+		}
+		defer ix.Close()
+
+		index, err := ix.RawIndex()
+		if err != nil {
+			log.Fatalf("Failed to read index: %v", err)
+		}
+		if _, err := os.Stdout.Write(index); err != nil {
+			log.Fatalf("Failed to write index: %v", err)
+		}
+
+	case "manifest":
+		if len(os.Args) != 3 {
+			fmt.Fprintf(os.Stderr, "Usage: ixtar manifest <bundle.ixtar>\n")
+			os.Exit(1)
+		}
+		bundlePath := os.Args[2]
+
+		ix, err := ixtar.NewIxTar(bundlePath)
+		if err != nil {
+			log.Fatalf("Failed to open bundle: %v", err)
+		}
+		defer ix.Close()
+
+		manifest, err := ix.Manifest()
+		if err != nil {
+			log.Fatalf("Failed to build manifest: %v", err)
+		}
+
+		paths := make([]string, 0, len(manifest))
+		for path := range manifest {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+		for _, path := range paths {
+			fmt.Printf("%s  %s\n", manifest[path], path)
+		}
+
+	case "verify":
+		if len(os.Args) != 3 {
+			fmt.Fprintf(os.Stderr, "Usage: ixtar verify <bundle.ixtar>\n")
+			os.Exit(1)
+		}
+		bundlePath := os.Args[2]
+
+		// A bundle too damaged to open fails verification like one
+		// whose files don't check out
+		ix, err := ixtar.NewIxTar(bundlePath)
+		if err != nil {
+			failVerification(bundlePath, err)
+		}
+		defer ix.Close()
+
+		if err := ix.VerifyAll(); err != nil {
+			ix.Close()
+			failVerification(bundlePath, err)
+		}
+
+		fmt.Println("OK")
+
+	case "repair":
+		if len(os.Args) != 3 {
+			fmt.Fprintf(os.Stderr, "Usage: ixtar repair <bundle.ixtar>\n")
+			os.Exit(1)
+		}
+		bundlePath := os.Args[2]
+
+		report, err := ixtar.Repair(bundlePath)
+		if err != nil {
+			log.Fatalf("Failed to repair bundle: %v", err)
+		}
+		if !report.Rewritten {
+			fmt.Printf("Nothing to repair (%d files)\n", report.Kept)
+			break
+		}
+		for _, name := range report.Dropped {
+			fmt.Printf("Dropped: %s\n", name)
+		}
+		fmt.Printf("Repaired %s: kept %d files, dropped %d\n", bundlePath, report.Kept, len(report.Dropped))
+
+	case "compact":
+		if len(os.Args) != 3 {
+			fmt.Fprintf(os.Stderr, "Usage: ixtar compact <bundle.ixtar>\n")
+			os.Exit(1)
+		}
+		bundlePath := os.Args[2]
+
+		reclaimed, err := ixtar.Compact(bundlePath)
+		if err != nil {
+			log.Fatalf("Failed to compact bundle: %v", err)
+		}
+		if reclaimed == 0 {
+			fmt.Println("Nothing to reclaim")
+			break
+		}
+		fmt.Printf("Compacted %s: reclaimed %d bytes\n", bundlePath, reclaimed)
+
+	case "recompress":
+		fs := flag.NewFlagSet("recompress", flag.ExitOnError)
+		decompress := fs.Bool("decompress", false, "store all files as is instead of DEFLATE compressed")
+		fs.Parse(os.Args[2:])
+		if fs.NArg() != 2 {
+			fmt.Fprintf(os.Stderr, "Usage: ixtar recompress [--decompress] <bundle.ixtar> <output.ixtar>\n")
+			os.Exit(1)
+		}
+		mode := ixtar.CompressionDeflate
+		if *decompress {
+			mode = ixtar.CompressionNone
+		}
+
+		result, err := ixtar.Recompress(fs.Arg(0), fs.Arg(1), mode)
+		if err != nil {
+			log.Fatalf("Failed to recompress bundle: %v", err)
+		}
+		fmt.Printf("Recompressed %d files: data %d -> %d bytes\n", result.Files, result.OldDataSize, result.NewDataSize)
+
+	case "add":
+		if len(os.Args) != 5 {
+			fmt.Fprintf(os.Stderr, "Usage: ixtar add <bundle.ixtar> <source-file> <archive-name>\n")
+			os.Exit(1)
+		}
+		bundlePath, sourcePath, name := os.Args[2], os.Args[3], os.Args[4]
+
+		count, err := ixtar.AppendFile(bundlePath, sourcePath, name)
+		if err != nil {
+			log.Fatalf("Failed to add %s: %v", sourcePath, err)
+		}
+		fmt.Printf("Added %s to %s: %d files\n", name, bundlePath, count)
+
+	case "remove":
+		if len(os.Args) != 4 {
+			fmt.Fprintf(os.Stderr, "Usage: ixtar remove <bundle.ixtar> <file-path>\n")
+			os.Exit(1)
+		}
+		bundlePath, filePath := os.Args[2], os.Args[3]
+
+		count, err := ixtar.RemoveFile(bundlePath, filePath)
+		if err != nil {
+			log.Fatalf("Failed to remove %s: %v", filePath, err)
+		}
+		fmt.Printf("Removed %s from %s: %d files\n", filePath, bundlePath, count)
+
 	default:
 		fmt.Fprintf(os.Stderr, "Unknown command: %s\n", command)
 		printUsage()
@@ -124,11 +575,39 @@ func main() {
 	}
 }
 
+// compressFunc returns the CreateOptions.Compress of the --compress flag.
+func compressFunc(compress bool) func(string) bool {
+	if !compress {
+		return nil
+	}
+	return func(string) bool { return true }
+}
+
+func printJSON(v any) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		log.Fatalf("Failed to encode JSON: %v", err)
+	}
+}
+
 func printUsage() {
 	fmt.Fprintf(os.Stderr, "Usage:\n")
-	fmt.Fprintf(os.Stderr, "  ixtar create <directory> <output.ixtar>\n")
-	fmt.Fprintf(os.Stderr, "  ixtar list <bundle.ixtar>\n")
+	fmt.Fprintf(os.Stderr, "  ixtar create [--base-dir DIR] [--continue-on-error] [--ignore-file FILE] [--dry-run] [--skip-hidden] [--trailer] [--hash ALG] [--temp-dir DIR] [--compress] [--verbose] [--follow-symlinks] [--checkpoint FILE] [--modified-after TIME] <directory> <output.ixtar>\n")
+	fmt.Fprintf(os.Stderr, "  ixtar list [--json] <bundle.ixtar>\n")
 	fmt.Fprintf(os.Stderr, "  ixtar extract <bundle.ixtar> <file-path> [file-path...]\n")
 	fmt.Fprintf(os.Stderr, "  ixtar extract-tar <bundle.ixtar> <output-directory>\n")
-	fmt.Fprintf(os.Stderr, "  ixtar info <bundle.ixtar>\n")
+	fmt.Fprintf(os.Stderr, "  ixtar extract-all [--strip-components N] [--continue-on-error] <bundle.ixtar> <dest-dir>\n")
+	fmt.Fprintf(os.Stderr, "  ixtar sync [--prune] <bundle.ixtar> <dest-dir>\n")
+	fmt.Fprintf(os.Stderr, "  ixtar info [--json] <bundle.ixtar>\n")
+	fmt.Fprintf(os.Stderr, "  ixtar stat [--json] <bundle.ixtar> <file-path>\n")
+	fmt.Fprintf(os.Stderr, "  ixtar layout <bundle.ixtar>\n")
+	fmt.Fprintf(os.Stderr, "  ixtar dump-index <bundle.ixtar>\n")
+	fmt.Fprintf(os.Stderr, "  ixtar manifest <bundle.ixtar>\n")
+	fmt.Fprintf(os.Stderr, "  ixtar verify <bundle.ixtar>\n")
+	fmt.Fprintf(os.Stderr, "  ixtar repair <bundle.ixtar>\n")
+	fmt.Fprintf(os.Stderr, "  ixtar compact <bundle.ixtar>\n")
+	fmt.Fprintf(os.Stderr, "  ixtar recompress [--decompress] <bundle.ixtar> <output.ixtar>\n")
+	fmt.Fprintf(os.Stderr, "  ixtar add <bundle.ixtar> <source-file> <archive-name>\n")
+	fmt.Fprintf(os.Stderr, "  ixtar remove <bundle.ixtar> <file-path>\n")
 }
\ No newline at end of file
@@ -0,0 +1,124 @@
+package ixtar
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Compact rewrites a bundle so that its data region only holds the data of
+// indexed files, packed back to back in offset order, and returns the number
+// of bytes reclaimed. Unreferenced data is left behind e.g. by files that
+// failed to read with ContinueOnError. Files sharing data keep sharing it.
+// The bundle is left untouched when there is nothing to reclaim. Bundles with
+// entries past the end of the data need Repair first, and gzip-compressed
+// bundles must be decompressed first. Bundles with an encrypted index are
+// refused with ErrKeyRequired.
+func Compact(bundlePath string) (int64, error) {
+	stat, err := os.Stat(bundlePath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to stat bundle file: %w", err)
+	}
+	ix, err := openForRewrite(bundlePath, "Compact")
+	if err != nil {
+		return 0, err
+	}
+	defer ix.Close()
+	if ix.tempPath != "" {
+		return 0, fmt.Errorf("can't compact a gzip-compressed bundle, decompress it first")
+	}
+
+	hashes := ix.entriesByOffset()
+	files, data, packed, err := ix.pack(hashes)
+	if err != nil {
+		return 0, err
+	}
+	reclaimed := ix.dataSize - packed
+	if reclaimed == 0 {
+		return 0, nil
+	}
+	if err := ix.rewrite(bundlePath, stat.Mode().Perm(), hashes, files, data); err != nil {
+		return 0, err
+	}
+	return reclaimed, nil
+}
+
+// openForRewrite opens the bundle at bundlePath for op, which rewrites it.
+// The index of the new bundle is written in the clear, so bundles with an
+// encrypted index are refused.
+func openForRewrite(bundlePath, op string) (*IxTar, error) {
+	ix, err := NewIxTar(bundlePath)
+	if errors.Is(err, ErrKeyRequired) {
+		return nil, fmt.Errorf("%s doesn't support bundles with an encrypted index: %w", op, err)
+	}
+	return ix, err
+}
+
+// pack returns the index entries of hashes, given in offset order, with
+// their data packed back to back, a reader over the packed data and its
+// size. Entries sharing or overlapping data keep sharing it.
+func (ix *IxTar) pack(hashes []string) (map[string]FileIndex, io.Reader, int64, error) {
+	// Regions of the old data region that are kept, merged where entries
+	// share or overlap data, with their start in the new data region
+	type span struct{ start, end, newStart int64 }
+	var spans []span
+	packed := int64(0)
+	files := make(map[string]FileIndex, len(hashes))
+	for _, hash := range hashes {
+		fileIndex := ix.files()[hash]
+		end := fileIndex.Start + fileIndex.storedSize()
+		if end > ix.dataSize {
+			return nil, nil, 0, fmt.Errorf("%s: data extends past the end of the bundle, repair it first", entryName(hash, fileIndex))
+		}
+
+		if n := len(spans); n > 0 && fileIndex.Start <= spans[n-1].end {
+			if end > spans[n-1].end {
+				packed += end - spans[n-1].end
+				spans[n-1].end = end
+			}
+		} else {
+			spans = append(spans, span{start: fileIndex.Start, end: end, newStart: packed})
+			packed += end - fileIndex.Start
+		}
+		last := spans[len(spans)-1]
+		fileIndex.Start = last.newStart + fileIndex.Start - last.start
+		files[hash] = fileIndex
+	}
+
+	readers := make([]io.Reader, len(spans))
+	for i, s := range spans {
+		readers[i] = io.NewSectionReader(ix.reader, ix.dataOffset+s.start, s.end-s.start)
+	}
+	return files, io.MultiReader(readers...), packed, nil
+}
+
+// rewrite replaces the bundle at bundlePath with one holding the entries
+// of hashes, in that order, and the given data region. The header flags,
+// creation time and info block of ix are kept.
+func (ix *IxTar) rewrite(bundlePath string, perm os.FileMode, hashes []string, files map[string]FileIndex, data io.Reader) error {
+	var newCSV bytes.Buffer
+	csvWriter := csv.NewWriter(&newCSV)
+	for _, hash := range hashes {
+		if err := writeCSVRecord(csvWriter, hash, files[hash]); err != nil {
+			return err
+		}
+	}
+	csvWriter.Flush()
+	if err := csvWriter.Error(); err != nil {
+		return fmt.Errorf("failed to flush CSV writer: %w", err)
+	}
+
+	infoData := make([]byte, ix.header.infoSize)
+	if _, err := ix.reader.ReadAt(infoData, headerSize+ix.csvSize); err != nil {
+		return fmt.Errorf("failed to read bundle info: %w", err)
+	}
+
+	header := ix.header
+	header.csvSize = int64(newCSV.Len())
+	return replaceBundle(bundlePath, perm, func(w io.Writer) error {
+		return writeBundle(w, header, bytes.NewReader(newCSV.Bytes()), infoData, data)
+	})
+}
@@ -0,0 +1,83 @@
+package ixtar
+
+import (
+	"bytes"
+	"encoding/csv"
+	"os"
+	"strings"
+	"testing"
+)
+
+// indexCSV returns the CSV index of files keyed by their stored paths.
+func indexCSV(t *testing.T, files map[string]FileIndex) string {
+	t.Helper()
+	var index bytes.Buffer
+	w := csv.NewWriter(&index)
+	for path, fileIndex := range files {
+		fileIndex.Path = path
+		if err := writeCSVRecord(w, pathKey(md5Hasher{}, path), fileIndex); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w.Flush()
+	return index.String()
+}
+
+func TestCompact(t *testing.T) {
+	data := strings.Repeat("a", 10) + strings.Repeat("x", 5) + strings.Repeat("b", 10) + strings.Repeat("y", 7) + "cc"
+	bundlePath := writeRawBundle(t, indexCSV(t, map[string]FileIndex{
+		"a.txt":     {Start: 0, Size: 10},
+		"copy.txt":  {Start: 0, Size: 10},
+		"b.txt":     {Start: 15, Size: 10},
+		"b-end.txt": {Start: 20, Size: 5},
+		"c.txt":     {Start: 32, Size: 2},
+		"empty.txt": {Start: 30, Size: 0},
+	}), data)
+	if err := os.Chmod(bundlePath, 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	reclaimed, err := Compact(bundlePath)
+	if err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+	if reclaimed != 12 {
+		t.Errorf("Expected 12 bytes reclaimed, got %d", reclaimed)
+	}
+
+	ix, err := NewIxTar(bundlePath)
+	if err != nil {
+		t.Fatalf("Failed to open compacted bundle: %v", err)
+	}
+	defer ix.Close()
+	want := map[string]string{
+		"a.txt":     strings.Repeat("a", 10),
+		"copy.txt":  strings.Repeat("a", 10),
+		"b.txt":     strings.Repeat("b", 10),
+		"b-end.txt": strings.Repeat("b", 5),
+		"c.txt":     "cc",
+		"empty.txt": "",
+	}
+	for name, content := range want {
+		if got, err := ix.ExtractBytesOfFile(name); err != nil || string(got) != content {
+			t.Errorf("%s: expected %q, got %q (%v)", name, content, got, err)
+		}
+	}
+	if layout := ix.Layout(); layout.DataSize != 22 {
+		t.Errorf("Expected 22 bytes of data, got %d", layout.DataSize)
+	}
+	if info, err := os.Stat(bundlePath); err != nil || info.Mode().Perm() != 0640 {
+		t.Errorf("Expected permissions to be kept, got %v (%v)", info.Mode().Perm(), err)
+	}
+
+	if reclaimed, err := Compact(bundlePath); err != nil || reclaimed != 0 {
+		t.Errorf("Expected nothing to reclaim, got %d (%v)", reclaimed, err)
+	}
+}
+
+func TestCompactTruncated(t *testing.T) {
+	bundlePath := writeRawBundle(t, indexCSV(t, map[string]FileIndex{"a.txt": {Start: 0, Size: 10}}), "short")
+	if _, err := Compact(bundlePath); err == nil {
+		t.Error("Expected an error compacting a truncated bundle")
+	}
+}
@@ -0,0 +1,126 @@
+package ixtar
+
+import (
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"io"
+)
+
+// compressionDeflate marks entries whose stored bytes are a raw DEFLATE
+// stream (RFC 1951) of the file content.
+const compressionDeflate = "deflate"
+
+// compressed reports whether the stored bytes of an entry are compressed.
+func (fi FileIndex) compressed() bool {
+	return fi.Compression != ""
+}
+
+// encoded reports whether the stored bytes of an entry differ from its
+// content, so reads have to go through extractEntry.
+func (fi FileIndex) encoded() bool {
+	return fi.Sparse != nil || fi.compressed() || fi.encrypted()
+}
+
+// maxDeflateRatio is the most a DEFLATE stream expands: a 258 byte match
+// takes at least two bits.
+const maxDeflateRatio = 1032
+
+// decodeStored turns the stored bytes of an entry into its content,
+// decompressing them or filling in the holes of a sparse file.
+func decodeStored(stored []byte, fileIndex FileIndex) ([]byte, error) {
+	if fileIndex.compressed() {
+		// Size comes from the index, so the buffer only starts out at what
+		// the stored bytes can inflate to and grows as content arrives
+		var data bytes.Buffer
+		data.Grow(int(min(fileIndex.Size, int64(len(stored))*maxDeflateRatio)))
+		if _, err := data.ReadFrom(inflate(bytes.NewReader(stored), fileIndex)); err != nil {
+			return nil, err
+		}
+		return data.Bytes(), nil
+	}
+	if fileIndex.Sparse != nil {
+		return expandSparse(stored, fileIndex), nil
+	}
+	return stored, nil
+}
+
+// inflate returns a reader over the content of a compressed entry, given a
+// reader over its stored bytes. It fails if the content isn't exactly Size
+// bytes long.
+func inflate(r io.Reader, fileIndex FileIndex) io.Reader {
+	return &inflateReader{r: flate.NewReader(r), left: fileIndex.Size, name: entryName("", fileIndex)}
+}
+
+type inflateReader struct {
+	r    io.ReadCloser
+	left int64
+	name string
+}
+
+func (z *inflateReader) Read(p []byte) (int, error) {
+	if z.left == 0 {
+		// The stream must end where the index says the file ends
+		var extra [1]byte
+		n, err := z.r.Read(extra[:])
+		if n > 0 {
+			return 0, fmt.Errorf("failed to decompress %s: data longer than its size", z.name)
+		}
+		if err != nil && err != io.EOF {
+			return 0, fmt.Errorf("failed to decompress %s: %w", z.name, err)
+		}
+		return 0, io.EOF
+	}
+
+	if int64(len(p)) > z.left {
+		p = p[:z.left]
+	}
+	n, err := z.r.Read(p)
+	z.left -= int64(n)
+	if err == io.EOF {
+		if z.left > 0 {
+			return n, fmt.Errorf("failed to decompress %s: %w", z.name, io.ErrUnexpectedEOF)
+		}
+		err = nil
+	} else if err != nil {
+		err = fmt.Errorf("failed to decompress %s: %w", z.name, err)
+	}
+	return n, err
+}
+
+// compressor deflates file data into the staging file while a bundle is
+// created. The flate writer is reused across files.
+type compressor struct {
+	fw *flate.Writer
+	cw countingWriter
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// copyCompressed deflates up to size bytes of r into w. It returns the
+// number of bytes read from r and the number of compressed bytes written.
+func (c *compressor) copyCompressed(w io.Writer, r io.Reader, size int64, buf []byte) (read, stored int64, err error) {
+	c.cw = countingWriter{w: w}
+	if c.fw == nil {
+		if c.fw, err = flate.NewWriter(&c.cw, flate.DefaultCompression); err != nil {
+			return 0, 0, err
+		}
+	} else {
+		c.fw.Reset(&c.cw)
+	}
+
+	read, err = copyFileData(c.fw, r, size, buf)
+	if closeErr := c.fw.Close(); err == nil {
+		err = closeErr
+	}
+	return read, c.cw.n, err
+}
@@ -0,0 +1,155 @@
+package ixtar
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCompressedEntries(t *testing.T) {
+	srcDir := t.TempDir()
+	testFiles := map[string]string{
+		"a.txt":     strings.Repeat("compressible text ", 1000),
+		"b.bin":     "stored as is",
+		"c.txt":     "short",
+		"empty.txt": "",
+	}
+	for name, content := range testFiles {
+		if err := os.WriteFile(filepath.Join(srcDir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	bundlePath := filepath.Join(t.TempDir(), "mixed.ixtar")
+	_, err := CreateBundleWithOptions(srcDir, bundlePath, CreateOptions{
+		Compress: func(path string) bool { return strings.HasSuffix(path, ".txt") },
+	})
+	if err != nil {
+		t.Fatalf("Failed to create bundle: %v", err)
+	}
+
+	ix, err := NewIxTar(bundlePath, WithVerifyOnRead())
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	defer ix.Close()
+
+	wantCompression := map[string]string{"a.txt": compressionDeflate, "c.txt": compressionDeflate}
+	for name, content := range testFiles {
+		stat, err := ix.Stat(name)
+		if err != nil {
+			t.Fatalf("Stat(%s) failed: %v", name, err)
+		}
+		if stat.Compression != wantCompression[name] {
+			t.Errorf("%s: expected compression %q, got %q", name, wantCompression[name], stat.Compression)
+		}
+		if stat.Size != int64(len(content)) {
+			t.Errorf("%s: expected size %d, got %d", name, len(content), stat.Size)
+		}
+
+		got, err := ix.ExtractBytesOfFile(name)
+		if err != nil || string(got) != content {
+			t.Errorf("ExtractBytesOfFile(%s): got %d bytes (%v)", name, len(got), err)
+		}
+
+		var buf bytes.Buffer
+		if _, err := ix.ExtractToWriter(name, &buf); err != nil || buf.String() != content {
+			t.Errorf("ExtractToWriter(%s): got %d bytes (%v)", name, buf.Len(), err)
+		}
+
+		rs, err := ix.OpenSeeker(name)
+		if err != nil {
+			t.Fatalf("OpenSeeker(%s) failed: %v", name, err)
+		}
+		if got, err := io.ReadAll(rs); err != nil || string(got) != content {
+			t.Errorf("OpenSeeker(%s): got %d bytes (%v)", name, len(got), err)
+		}
+
+		if len(content) > 2 {
+			got, err := ix.ExtractRange(name, 1, 2)
+			if err != nil || string(got) != content[1:3] {
+				t.Errorf("ExtractRange(%s): expected %q, got %q (%v)", name, content[1:3], got, err)
+			}
+		}
+	}
+
+	err = ix.WalkFiles(func(entry FileStat, r io.Reader) error {
+		got, err := io.ReadAll(r)
+		if err != nil || string(got) != testFiles[entry.Path] {
+			t.Errorf("WalkFiles %s: got %d bytes (%v)", entry.Path, len(got), err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Errorf("WalkFiles failed: %v", err)
+	}
+	if err := ix.VerifyAll(); err != nil {
+		t.Errorf("VerifyAll failed: %v", err)
+	}
+	if !ix.SupportsRandomAccess() {
+		t.Error("Expected random access with per-file compression")
+	}
+	if err := ix.Validate(); err != nil {
+		t.Errorf("Validate failed: %v", err)
+	}
+	if layout := ix.Layout(); layout.DataSize >= int64(len(testFiles["a.txt"])) {
+		t.Errorf("Expected compressed data smaller than %d bytes, got %d", len(testFiles["a.txt"]), layout.DataSize)
+	}
+
+	// Extracted compressed files count as unchanged when synced again
+	destDir := t.TempDir()
+	if err := Sync(bundlePath, destDir); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	result, err := SyncWithOptions(bundlePath, destDir, SyncOptions{})
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if result.Unchanged != len(testFiles) {
+		t.Errorf("Expected %d unchanged files, got %+v", len(testFiles), result)
+	}
+}
+
+func TestDecodeStoredSizeMismatch(t *testing.T) {
+	var c compressor
+	var stored bytes.Buffer
+	if _, _, err := c.copyCompressed(&stored, strings.NewReader("hello world"), 11, make([]byte, 4)); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, size := range []int64{5, 20} {
+		fileIndex := FileIndex{Size: size, Compression: compressionDeflate, CompressedSize: int64(stored.Len())}
+		if _, err := decodeStored(stored.Bytes(), fileIndex); err == nil {
+			t.Errorf("Expected an error for size %d of 11 bytes", size)
+		}
+	}
+	fileIndex := FileIndex{Size: 11, Compression: compressionDeflate, CompressedSize: int64(stored.Len())}
+	if got, err := decodeStored(stored.Bytes(), fileIndex); err != nil || string(got) != "hello world" {
+		t.Errorf("Expected %q, got %q (%v)", "hello world", got, err)
+	}
+}
+
+func TestCompressedEntryHugeSize(t *testing.T) {
+	var c compressor
+	var stored bytes.Buffer
+	if _, _, err := c.copyCompressed(&stored, strings.NewReader("hello world"), 11, make([]byte, 4)); err != nil {
+		t.Fatal(err)
+	}
+	// The index claims far more content than the stored bytes inflate to
+	bundlePath := writeRawBundle(t, indexCSV(t, map[string]FileIndex{
+		"bomb.txt": {Size: 1 << 44, Compression: compressionDeflate, CompressedSize: int64(stored.Len())},
+	}), stored.String())
+
+	ix, err := NewIxTar(bundlePath, WithValidate())
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	defer ix.Close()
+	if _, err := ix.ExtractBytesOfFile("bomb.txt"); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Expected io.ErrUnexpectedEOF, got %v", err)
+	}
+}
@@ -0,0 +1,156 @@
+package ixtar
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// sniffLen is how much of a file http.DetectContentType looks at.
+const sniffLen = 512
+
+// OpenSeeker returns a seekable reader over the content of a file, suitable
+// for http.ServeContent, which then serves range requests itself. Reads go
+// straight to the bundle and are not checked against the stored checksum,
+// even with WithVerifyOnRead. Sparse and compressed files are expanded into
+// memory. The reader ends at the end of the file, so reads never reach the
+// next file in the bundle.
+func (ix *IxTar) OpenSeeker(filePath string) (io.ReadSeeker, error) {
+	fileIndex, err := ix.lookup(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	if fileIndex.encoded() {
+		data, err := ix.extractEntry(fileIndex)
+		if err != nil {
+			return nil, err
+		}
+		return bytes.NewReader(data), nil
+	}
+	if err := ix.checkRegion(fileIndex); err != nil {
+		return nil, err
+	}
+	start := ix.dataOffset + fileIndex.Start
+	f := &fileReader{SectionReader: io.NewSectionReader(ix.reader, start, fileIndex.Size)}
+	if ix.mapping != nil {
+		f.mapping = ix.mapping[start : start+fileIndex.Size]
+	}
+	return f, nil
+}
+
+// Region returns where the content of a file lies in the bundle file: its
+// absolute offset and its length, for tools that do their own I/O, such as
+// handing the range to sendfile. Reads of the range aren't checked against
+// the stored checksum. It fails for files stored compressed, sparse or
+// encrypted, whose stored bytes aren't their content, and for bundles
+// without SupportsRandomAccess, whose data isn't in the bundle file.
+func (ix *IxTar) Region(filePath string) (offset, length int64, err error) {
+	fileIndex, err := ix.lookup(filePath)
+	if err != nil {
+		return 0, 0, err
+	}
+	if !ix.SupportsRandomAccess() {
+		return 0, 0, fmt.Errorf("bundle is compressed as a whole, its files have no region in it")
+	}
+	if fileIndex.encoded() {
+		return 0, 0, fmt.Errorf("%s is stored compressed, sparse or encrypted, its content has no region", filePath)
+	}
+	if err := ix.checkRegion(fileIndex); err != nil {
+		return 0, 0, err
+	}
+	return ix.dataOffset + fileIndex.Start, fileIndex.Size, nil
+}
+
+// writeToBufferSize bounds the reads of fileReader.WriteTo.
+const writeToBufferSize = 1 << 20
+
+// fileReader is the reader of OpenSeeker for files stored as is. Its
+// WriteTo, which io.Copy uses, writes the rest of the file in one call for
+// mapped bundles and in reads of up to 1MB otherwise, instead of the 32KB
+// reads of the default copy loop.
+type fileReader struct {
+	*io.SectionReader
+	mapping []byte // the file's bytes, set for bundles opened WithMmap
+}
+
+// WriteTo writes the file from the current offset to its end into w and
+// advances the offset by the bytes written.
+func (f *fileReader) WriteTo(w io.Writer) (int64, error) {
+	pos, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	left := f.Size() - pos
+	if left <= 0 {
+		return 0, nil
+	}
+
+	var n int64
+	if f.mapping != nil {
+		n, err = writeFull(w, f.mapping[pos:])
+	} else {
+		buf := make([]byte, min(left, writeToBufferSize))
+		for n < left && err == nil {
+			chunk := buf[:min(left-n, int64(len(buf)))]
+			m, readErr := f.ReadAt(chunk, pos+n)
+			var written int64
+			written, err = writeFull(w, chunk[:m])
+			n += written
+			if err == nil && readErr != nil {
+				// Chunks never reach past the file, so EOF means the bundle
+				// is shorter than its index says
+				if readErr == io.EOF && m < len(chunk) {
+					readErr = io.ErrUnexpectedEOF
+				}
+				err = readErr
+			}
+		}
+	}
+	if _, seekErr := f.Seek(pos+n, io.SeekStart); err == nil {
+		err = seekErr
+	}
+	return n, err
+}
+
+// ContentType returns the MIME type of a file: the "content-type" metadata
+// if it was set with Builder.SetMeta, otherwise the type the bundle's
+// ContentTypes map gives the file extension, otherwise the type registered
+// for the extension on the system, otherwise the type sniffed from the first
+// 512 bytes. It returns "" if the file is not in the bundle.
+func (ix *IxTar) ContentType(filePath string) string {
+	fileIndex, err := ix.lookup(filePath)
+	if err != nil {
+		return ""
+	}
+
+	if ctype := fileIndex.Meta["content-type"]; ctype != "" {
+		return ctype
+	}
+	ext := path.Ext(filePath)
+	if ctype := ix.info.ContentTypes[strings.ToLower(ext)]; ctype != "" {
+		return ctype
+	}
+	if ctype := mime.TypeByExtension(ext); ctype != "" {
+		return ctype
+	}
+
+	head, err := ix.readRange(fileIndex, 0, sniffLen)
+	if err != nil {
+		return ""
+	}
+	return http.DetectContentType(head)
+}
+
+// writeFull writes p to w, failing with io.ErrShortWrite if w accepts less.
+func writeFull(w io.Writer, p []byte) (int64, error) {
+	n, err := w.Write(p)
+	if err == nil && n < len(p) {
+		err = io.ErrShortWrite
+	}
+	return int64(n), err
+}
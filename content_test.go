@@ -0,0 +1,314 @@
+package ixtar
+
+import (
+	"errors"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOpenSeekerServeContent(t *testing.T) {
+	content := strings.Repeat("0123456789", 100)
+	bundlePath := createTestBundle(t, map[string]string{
+		"before.txt":    "padding",
+		"media/clip.js": content,
+	})
+
+	ix, err := NewIxTar(bundlePath)
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	defer ix.Close()
+
+	rs, err := ix.OpenSeeker("media/clip.js")
+	if err != nil {
+		t.Fatalf("Failed to open seeker: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/media/clip.js", nil)
+	req.Header.Set("Range", "bytes=10-19")
+	rec := httptest.NewRecorder()
+	http.ServeContent(rec, req, "clip.js", time.Time{}, rs)
+
+	if rec.Code != http.StatusPartialContent {
+		t.Fatalf("Expected 206, got %d", rec.Code)
+	}
+	if body := rec.Body.String(); body != content[10:20] {
+		t.Errorf("Expected range %q, got %q", content[10:20], body)
+	}
+
+	if _, err := rs.Seek(-5, io.SeekEnd); err != nil {
+		t.Fatalf("Failed to seek: %v", err)
+	}
+	tail, _ := io.ReadAll(rs)
+	if string(tail) != content[len(content)-5:] {
+		t.Errorf("Expected tail %q, got %q", content[len(content)-5:], tail)
+	}
+
+	if _, err := ix.OpenSeeker("missing"); err == nil {
+		t.Error("Expected error for missing file")
+	}
+}
+
+func TestContentType(t *testing.T) {
+	bundlePath := createTestBundle(t, map[string]string{
+		"page.html":   "<p>hi</p>",
+		"noext":       "<!DOCTYPE html><html></html>",
+		"data.binary": "\x00\x01\x02",
+	})
+
+	ix, err := NewIxTar(bundlePath)
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	defer ix.Close()
+
+	tests := map[string]string{
+		"page.html":   "text/html; charset=utf-8",
+		"noext":       "text/html; charset=utf-8",
+		"data.binary": "application/octet-stream",
+		"missing.txt": "",
+	}
+	for path, want := range tests {
+		if got := ix.ContentType(path); got != want {
+			t.Errorf("%s: expected %q, got %q", path, want, got)
+		}
+	}
+}
+
+func TestContentTypeFromMetadata(t *testing.T) {
+	b, err := NewBuilder()
+	if err != nil {
+		t.Fatalf("Failed to create builder: %v", err)
+	}
+	defer b.Close()
+	if err := b.AddBytes("feed", []byte("<rss></rss>")); err != nil {
+		t.Fatalf("Failed to add file: %v", err)
+	}
+	if err := b.SetMeta("feed", "content-type", "application/rss+xml"); err != nil {
+		t.Fatalf("Failed to set metadata: %v", err)
+	}
+	bundlePath := filepath.Join(t.TempDir(), "meta.ixtar")
+	if err := b.WriteFile(bundlePath); err != nil {
+		t.Fatalf("Failed to write bundle: %v", err)
+	}
+
+	ix, err := NewIxTar(bundlePath)
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	defer ix.Close()
+
+	if got := ix.ContentType("feed"); got != "application/rss+xml" {
+		t.Errorf("Expected content type from metadata, got %q", got)
+	}
+}
+
+func TestBundleContentTypes(t *testing.T) {
+	srcDir := t.TempDir()
+	for _, name := range []string{"app.wasm", "app.js.map", "page.html"} {
+		if err := os.WriteFile(filepath.Join(srcDir, name), []byte("data"), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	bundlePath := filepath.Join(t.TempDir(), "types.ixtar")
+
+	_, err := CreateBundleWithOptions(srcDir, bundlePath, CreateOptions{
+		ContentTypes: map[string]string{"bad": "not a type;;"},
+	})
+	if err == nil {
+		t.Error("Expected error for an invalid content type")
+	}
+
+	_, err = CreateBundleWithOptions(srcDir, bundlePath, CreateOptions{
+		ContentTypes: map[string]string{
+			".wasm": "application/wasm",
+			"MAP":   "application/json",
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create bundle: %v", err)
+	}
+
+	ix, err := NewIxTar(bundlePath)
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	defer ix.Close()
+
+	tests := map[string]string{
+		"app.wasm":   "application/wasm",
+		"app.js.map": "application/json",
+		"page.html":  "text/html; charset=utf-8",
+	}
+	for path, want := range tests {
+		if got := ix.ContentType(path); got != want {
+			t.Errorf("%s: expected %q, got %q", path, want, got)
+		}
+	}
+}
+
+func TestOpenSeekerEOF(t *testing.T) {
+	data := "alphabravo"
+	bundlePath := writeRawBundle(t, indexCSV(t, map[string]FileIndex{
+		"a.txt":     {Start: 0, Size: 5},
+		"empty.txt": {Start: 5, Size: 0},
+		"b.txt":     {Start: 5, Size: 5},
+		"long.txt":  {Start: 8, Size: 100},
+	}), data)
+	ix, err := NewIxTar(bundlePath)
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	defer ix.Close()
+
+	for name, want := range map[string]string{"a.txt": "alpha", "empty.txt": "", "b.txt": "bravo"} {
+		r, err := ix.OpenSeeker(name)
+		if err != nil {
+			t.Fatalf("OpenSeeker %s: %v", name, err)
+		}
+		if got, err := io.ReadAll(r); err != nil || string(got) != want {
+			t.Errorf("%s: read %q (%v)", name, got, err)
+		}
+		// Seeking past the end doesn't reach the next file either
+		if _, err := r.Seek(2, io.SeekEnd); err != nil {
+			t.Fatal(err)
+		}
+		if n, err := r.Read(make([]byte, 8)); n != 0 || err != io.EOF {
+			t.Errorf("%s: read past the end returned %d, %v", name, n, err)
+		}
+	}
+	if _, err := ix.OpenSeeker("long.txt"); !errors.Is(err, ErrBadFormat) {
+		t.Errorf("Expected ErrBadFormat for a region past the data, got %v", err)
+	}
+}
+
+func TestOpenSeekerWriteTo(t *testing.T) {
+	content := strings.Repeat("0123456789", 300000)
+	bundlePath := createTestBundle(t, map[string]string{
+		"big.bin":   content,
+		"after.txt": "must not leak",
+		"empty.txt": "",
+	})
+
+	for _, opts := range [][]OpenOption{nil, {WithMmap()}} {
+		ix, err := NewIxTar(bundlePath, opts...)
+		if err != nil {
+			t.Fatalf("Failed to open bundle: %v", err)
+		}
+
+		rs, err := ix.OpenSeeker("big.bin")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := rs.(io.WriterTo); !ok {
+			t.Fatal("Expected the reader to implement io.WriterTo")
+		}
+		// WriteTo starts at the current offset and moves it to the end
+		if _, err := rs.Seek(5, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		var buf strings.Builder
+		if n, err := io.Copy(&buf, rs); err != nil || n != int64(len(content)-5) || buf.String() != content[5:] {
+			t.Errorf("io.Copy: %d bytes (%v)", n, err)
+		}
+		if n, err := io.Copy(io.Discard, rs); n != 0 || err != nil {
+			t.Errorf("Expected nothing left, got %d (%v)", n, err)
+		}
+
+		empty, err := ix.OpenSeeker("empty.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n, err := empty.(io.WriterTo).WriteTo(&buf); n != 0 || err != nil {
+			t.Errorf("empty.txt: wrote %d (%v)", n, err)
+		}
+		ix.Close()
+	}
+}
+
+func benchmarkOpenSeekerCopy(b *testing.B, writeTo bool, opts ...OpenOption) {
+	content := strings.Repeat("x", 64<<20)
+	bundlePath := createTestBundle(b, map[string]string{"big.bin": content})
+	ix, err := NewIxTar(bundlePath, opts...)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer ix.Close()
+
+	b.SetBytes(int64(len(content)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rs, err := ix.OpenSeeker("big.bin")
+		if err != nil {
+			b.Fatal(err)
+		}
+		var r io.Reader = rs
+		if !writeTo {
+			// Hide WriteTo so io.Copy uses its 32KB loop
+			r = struct{ io.Reader }{rs}
+		}
+		// A checksum reads every byte, unlike io.Discard
+		if _, err := io.Copy(crc32.NewIEEE(), r); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkOpenSeekerCopyLoop(b *testing.B)     { benchmarkOpenSeekerCopy(b, false) }
+func BenchmarkOpenSeekerWriteTo(b *testing.B)      { benchmarkOpenSeekerCopy(b, true) }
+func BenchmarkOpenSeekerCopyLoopMmap(b *testing.B) { benchmarkOpenSeekerCopy(b, false, WithMmap()) }
+func BenchmarkOpenSeekerWriteToMmap(b *testing.B)  { benchmarkOpenSeekerCopy(b, true, WithMmap()) }
+
+func TestRegion(t *testing.T) {
+	content := strings.Repeat("0123456789", 100)
+	bundlePath := createTestBundle(t, map[string]string{
+		"before.txt":    "padding",
+		"media/clip.js": content,
+	})
+
+	ix, err := NewIxTar(bundlePath)
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	defer ix.Close()
+
+	offset, length, err := ix.Region("media/clip.js")
+	if err != nil {
+		t.Fatalf("Region failed: %v", err)
+	}
+	raw, err := os.ReadFile(bundlePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if length != int64(len(content)) || string(raw[offset:offset+length]) != content {
+		t.Errorf("Expected the region to hold the content, got %d bytes at %d", length, offset)
+	}
+	if _, _, err := ix.Region("missing"); !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("Expected ErrFileNotFound, got %v", err)
+	}
+
+	// Compressed content has no region
+	srcDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(srcDir, "packed.txt"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	packedPath := filepath.Join(t.TempDir(), "packed.ixtar")
+	if _, err := CreateBundleWithOptions(srcDir, packedPath, CreateOptions{Compress: func(string) bool { return true }}); err != nil {
+		t.Fatal(err)
+	}
+	packed, err := NewIxTar(packedPath)
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	defer packed.Close()
+	if _, _, err := packed.Region("packed.txt"); err == nil {
+		t.Error("Expected Region to fail for a compressed file")
+	}
+}
@@ -0,0 +1,59 @@
+package ixtar
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// NewIxTarAt opens a bundle stored at offset within a larger file, such as
+// assets appended to an executable. size is the length of the bundle; all
+// offsets of the bundle, including those reported by Layout, are relative to
+// its start. WithMmap and WithReaderPool are not supported. Close does not
+// close r.
+func NewIxTarAt(r io.ReaderAt, offset, size int64, opts ...OpenOption) (*IxTar, error) {
+	cfg, err := newOpenConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.mmap || cfg.poolSize > 0 {
+		return nil, fmt.Errorf("mmap and reader pool need a bundle file")
+	}
+	if offset < 0 || size < 0 {
+		return nil, fmt.Errorf("invalid bundle offset %d or size %d", offset, size)
+	}
+
+	return openReaderAt(io.NewSectionReader(r, offset, size), size, cfg)
+}
+
+// findChunkSize is how much FindBundle reads at a time while scanning.
+const findChunkSize = 64 << 10
+
+// FindBundle scans r, which is totalSize bytes long, for a bundle that
+// extends to its end, as when a bundle is appended to an executable, and
+// returns the bundle's offset for NewIxTarAt. Occurrences of the header
+// magic that don't start a bundle that opens, e.g. in the executable's own
+// data, are skipped. Bundles without a header magic can't be found.
+func FindBundle(r io.ReaderAt, totalSize int64) (int64, error) {
+	buf := make([]byte, findChunkSize+len(headerMagic)-1)
+	for chunkStart := int64(0); chunkStart < totalSize; chunkStart += findChunkSize {
+		n, err := r.ReadAt(buf[:min(int64(len(buf)), totalSize-chunkStart)], chunkStart)
+		if err != nil && err != io.EOF {
+			return 0, fmt.Errorf("failed to scan for bundle: %w", err)
+		}
+
+		for pos := 0; ; pos++ {
+			i := bytes.Index(buf[pos:n], headerMagic[:])
+			if i < 0 || pos+i >= findChunkSize {
+				break
+			}
+			pos += i
+			offset := chunkStart + int64(pos)
+			size := totalSize - offset
+			if _, err := openReaderAt(io.NewSectionReader(r, offset, size), size, openConfig{}); err == nil {
+				return offset, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("%w: no bundle found", ErrBadFormat)
+}
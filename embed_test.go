@@ -0,0 +1,54 @@
+package ixtar
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestNewIxTarAtAndFindBundle(t *testing.T) {
+	testFiles := map[string]string{"a.txt": "alpha", "dir/b.txt": "bravo"}
+	bundle, err := os.ReadFile(createTestBundle(t, testFiles))
+	if err != nil {
+		t.Fatalf("Failed to read bundle: %v", err)
+	}
+
+	// An executable-like prefix containing a stray magic, longer than one
+	// scan chunk so the bundle starts in a later chunk
+	prefix := bytes.Repeat([]byte{0x7f}, findChunkSize+100)
+	copy(prefix[10:], "IXTR\x01 not a header")
+	copy(prefix[findChunkSize-2:], "IXTR")
+	combined := append(prefix, bundle...)
+	r := bytes.NewReader(combined)
+
+	offset, err := FindBundle(r, int64(len(combined)))
+	if err != nil {
+		t.Fatalf("FindBundle failed: %v", err)
+	}
+	if offset != int64(len(prefix)) {
+		t.Fatalf("Expected bundle at %d, got %d", len(prefix), offset)
+	}
+
+	ix, err := NewIxTarAt(r, offset, int64(len(bundle)))
+	if err != nil {
+		t.Fatalf("Failed to open embedded bundle: %v", err)
+	}
+	defer ix.Close()
+	for name, content := range testFiles {
+		got, err := ix.ExtractBytesOfFile(name)
+		if err != nil || string(got) != content {
+			t.Errorf("%s: expected %q, got %q (%v)", name, content, got, err)
+		}
+	}
+	if err := ix.VerifyAll(); err != nil {
+		t.Errorf("VerifyAll failed: %v", err)
+	}
+	if layout := ix.Layout(); layout.TotalSize != int64(len(bundle)) {
+		t.Errorf("Expected layout relative to the bundle, got %+v", layout)
+	}
+
+	if _, err := FindBundle(bytes.NewReader(prefix), int64(len(prefix))); !errors.Is(err, ErrBadFormat) {
+		t.Errorf("Expected ErrBadFormat without a bundle, got %v", err)
+	}
+}
@@ -0,0 +1,300 @@
+package ixtar
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// ErrKeyRequired is returned when reading an encrypted file of a bundle that
+// was opened without WithKey.
+var ErrKeyRequired = errors.New("bundle is encrypted, open it WithKey")
+
+// ErrWrongKey is returned by NewIxTar when the key given WithKey isn't the
+// one the bundle was encrypted with.
+var ErrWrongKey = errors.New("wrong key for encrypted bundle")
+
+// encryptionAESGCM marks entries whose stored bytes are a nonce followed by
+// the AES-GCM sealed content, or the sealed DEFLATE stream of compressed
+// entries.
+const encryptionAESGCM = "aes-gcm"
+
+// gcmNonceSize is the size of the random nonce of every encrypted entry,
+// and gcmTagSize the size of the authentication tag sealed content ends
+// with.
+const (
+	gcmNonceSize = 12
+	gcmTagSize   = 16
+)
+
+// Encryption configures the encryption of a bundle being created.
+type Encryption struct {
+	// Key is the AES key, 16, 24 or 32 bytes for AES-128, AES-192 or
+	// AES-256.
+	Key []byte
+	// Password replaces Key with one derived from it by DeriveKey, with a
+	// random salt that is stored in the bundle along with the scrypt
+	// parameters. Open the bundle WithPassword.
+	Password string
+	// Index encrypts the CSV index too, so that paths, sizes and metadata
+	// can't be read without the key: opening the bundle then needs WithKey.
+	// The index is held in memory to be encrypted.
+	Index bool
+}
+
+// WithKey opens a bundle whose files were encrypted with key, see
+// CreateOptions.Encryption. Opening fails with ErrWrongKey if the bundle
+// was encrypted with another key. Without it the index can still be read,
+// but reading an encrypted file fails with ErrKeyRequired, unless the index
+// is encrypted too, in which case opening fails with ErrKeyRequired.
+func WithKey(key []byte) OpenOption {
+	return func(c *openConfig) {
+		c.key = key
+	}
+}
+
+// WithPassword opens a bundle encrypted with Encryption.Password, deriving
+// the key from password with the salt and parameters stored in the bundle.
+// It fails like WithKey with a wrong password, and with bundles encrypted
+// with a raw key.
+func WithPassword(password string) OpenOption {
+	return func(c *openConfig) {
+		c.password = &password
+	}
+}
+
+// encryptionInfo describes the encryption of a bundle in its info block.
+type encryptionInfo struct {
+	Cipher   string      `json:"cipher"`
+	KeyCheck string      `json:"key_check"`     // keyCheck of the key, to tell a wrong key from corrupt data
+	KDF      *scryptInfo `json:"kdf,omitempty"` // set if the key was derived from a password
+}
+
+// scryptInfo is the salt and cost parameters of a key derived with scrypt.
+type scryptInfo struct {
+	Name string `json:"name"` // "scrypt"
+	Salt []byte `json:"salt"`
+	N    int    `json:"n"`
+	R    int    `json:"r"`
+	P    int    `json:"p"`
+}
+
+// defaultScrypt is the cost DeriveKey uses: N=2^15, r=8, p=1, which takes
+// 32MB and about 100ms. Tests lower it.
+var defaultScrypt = scryptInfo{Name: "scrypt", N: 1 << 15, R: 8, P: 1}
+
+// maxScryptMemory bounds the memory of the parameters a bundle may ask for,
+// 128*N*r bytes, so opening a crafted bundle can't exhaust memory.
+const maxScryptMemory = 1 << 30
+
+// saltSize is the size of the random salt of Encryption.Password.
+const saltSize = 16
+
+// DeriveKey derives a 32 byte AES-256 key from password and salt with
+// scrypt, at a cost that makes guessing passwords slow. The same password
+// and salt always give the same key. Encryption.Password picks a random
+// salt and stores it; use DeriveKey to manage the salt yourself.
+func DeriveKey(password string, salt []byte) []byte {
+	key, err := defaultScrypt.derive(password, salt)
+	if err != nil {
+		// Only invalid parameters fail, and the defaults are valid
+		panic(err)
+	}
+	return key
+}
+
+// derive derives a 32 byte key from password with the salt and parameters
+// of s.
+func (s scryptInfo) derive(password string, salt []byte) ([]byte, error) {
+	if s.Name != "scrypt" {
+		return nil, fmt.Errorf("%w: unsupported key derivation %q", ErrBadFormat, s.Name)
+	}
+	if s.R <= 0 || s.P <= 0 || s.N > maxScryptMemory/128/s.R || s.P > 16 {
+		return nil, fmt.Errorf("%w: scrypt parameters N=%d r=%d p=%d out of range", ErrBadFormat, s.N, s.R, s.P)
+	}
+	return scrypt.Key([]byte(password), salt, s.N, s.R, s.P, 32)
+}
+
+// encryptionKey returns the key of enc and how it is described in the info
+// block, deriving it from the password with a fresh salt if there is one.
+// prev, if not nil, is the encryption of a create being resumed, whose salt
+// is kept and whose key must match.
+func encryptionKey(enc *Encryption, prev *encryptionInfo) ([]byte, *encryptionInfo, error) {
+	key := enc.Key
+	var kdf *scryptInfo
+	if enc.Password != "" {
+		if key != nil {
+			return nil, nil, fmt.Errorf("Encryption.Key and Encryption.Password are mutually exclusive")
+		}
+		if prev != nil && prev.KDF != nil {
+			params := *prev.KDF
+			kdf = &params
+		} else {
+			params := defaultScrypt
+			params.Salt = make([]byte, saltSize)
+			if _, err := rand.Read(params.Salt); err != nil {
+				return nil, nil, fmt.Errorf("failed to generate salt: %w", err)
+			}
+			kdf = &params
+		}
+		var err error
+		if key, err = kdf.derive(enc.Password, kdf.Salt); err != nil {
+			return nil, nil, err
+		}
+	}
+	info := &encryptionInfo{Cipher: encryptionAESGCM, KeyCheck: keyCheck(key), KDF: kdf}
+	if prev != nil && (prev.KeyCheck != info.KeyCheck || (prev.KDF == nil) != (kdf == nil)) {
+		return nil, nil, fmt.Errorf("%w: the checkpoint was saved with another key", ErrWrongKey)
+	}
+	return key, info, nil
+}
+
+// keyCheck derives a value from key that identifies it without revealing
+// it.
+func keyCheck(key []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("ixtar key check"))
+	return hex.EncodeToString(mac.Sum(nil)[:8])
+}
+
+// encrypted reports whether the stored bytes of an entry are encrypted.
+func (fi FileIndex) encrypted() bool {
+	return fi.Encryption != ""
+}
+
+// newGCM returns the AES-GCM cipher of key.
+func newGCM(key []byte, nonceSize int) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption key: %w", err)
+	}
+	return cipher.NewGCMWithNonceSize(block, nonceSize)
+}
+
+// openCipher returns the cipher that decrypts the files of a bundle, nil if
+// no key or password is given. The key is checked against the one recorded
+// by create.
+func (info bundleInfo) openCipher(header bundleHeader, cfg openConfig) (cipher.AEAD, error) {
+	key := cfg.key
+	if key == nil && cfg.password == nil || header.flags&flagEncrypted == 0 {
+		return nil, nil
+	}
+	if info.Encryption == nil || info.Encryption.Cipher != encryptionAESGCM {
+		return nil, fmt.Errorf("%w: encrypted bundle without a supported cipher", ErrBadFormat)
+	}
+	if cfg.password != nil {
+		kdf := info.Encryption.KDF
+		if kdf == nil {
+			return nil, fmt.Errorf("%w: bundle was encrypted with a key, not a password", ErrWrongKey)
+		}
+		var err error
+		if key, err = kdf.derive(*cfg.password, kdf.Salt); err != nil {
+			return nil, err
+		}
+	}
+	if !hmac.Equal([]byte(keyCheck(key)), []byte(info.Encryption.KeyCheck)) {
+		return nil, ErrWrongKey
+	}
+	return newGCM(key, gcmNonceSize)
+}
+
+// decrypt turns the stored bytes of an encrypted entry into what was
+// encrypted: its content, or its DEFLATE stream if it is also compressed.
+// Other entries are returned as they are.
+func (ix *IxTar) decrypt(stored []byte, fileIndex FileIndex) ([]byte, error) {
+	if !fileIndex.encrypted() {
+		return stored, nil
+	}
+	if ix.aead == nil {
+		return nil, fmt.Errorf("%w: %s", ErrKeyRequired, entryName("", fileIndex))
+	}
+	if fileIndex.NonceSize != ix.aead.NonceSize() || len(stored) < fileIndex.NonceSize {
+		return nil, fmt.Errorf("%w: %s: unsupported nonce size %d", ErrBadFormat, entryName("", fileIndex), fileIndex.NonceSize)
+	}
+	nonce, sealed := stored[:fileIndex.NonceSize], stored[fileIndex.NonceSize:]
+	plain, err := ix.aead.Open(sealed[:0:0], nonce, sealed, additionalData(fileIndex.key, fileIndex.Path))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s failed authentication", ErrChecksumMismatch, entryName("", fileIndex))
+	}
+	return plain, nil
+}
+
+// additionalData is what the content of an encrypted entry is
+// authenticated with besides itself: its index key and stored path. This
+// binds the content to its index record, so a tampered index that points
+// one path at another file's data fails authentication.
+func additionalData(key, storedPath string) []byte {
+	return []byte(key + "\x00" + storedPath)
+}
+
+// sealer encrypts file data while a bundle is created. The data of a file
+// is collected in buf, since AES-GCM authenticates a file as a whole.
+type sealer struct {
+	aead cipher.AEAD
+	buf  bytes.Buffer
+	out  []byte
+}
+
+func newSealer(key []byte) (*sealer, error) {
+	aead, err := newGCM(key, gcmNonceSize)
+	if err != nil {
+		return nil, err
+	}
+	return &sealer{aead: aead}, nil
+}
+
+// writeTo writes a fresh nonce followed by the sealed content of buf,
+// authenticated along with additional, to w and returns the number of bytes
+// written.
+func (s *sealer) writeTo(w io.Writer, additional []byte) (int64, error) {
+	s.out = append(s.out[:0], make([]byte, gcmNonceSize)...)
+	if _, err := rand.Read(s.out); err != nil {
+		return 0, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	s.out = s.aead.Seal(s.out, s.out, s.buf.Bytes(), additional)
+	n, err := w.Write(s.out)
+	return int64(n), err
+}
+
+// decryptIndex returns the CSV index of a bundle from the bytes of its index
+// region, which with flagEncryptedIndex hold a nonce followed by the sealed
+// index. aead is the cipher of the bundle, nil without a key.
+func decryptIndex(header bundleHeader, aead cipher.AEAD, csvData []byte) ([]byte, error) {
+	if header.flags&flagEncryptedIndex == 0 {
+		return csvData, nil
+	}
+	if aead == nil {
+		return nil, fmt.Errorf("%w: the index is encrypted", ErrKeyRequired)
+	}
+	if len(csvData) < gcmNonceSize {
+		return nil, fmt.Errorf("%w: encrypted index too short", ErrBadFormat)
+	}
+	plain, err := aead.Open(nil, csvData[:gcmNonceSize], csvData[gcmNonceSize:], nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: index failed authentication", ErrBadFormat)
+	}
+	return plain, nil
+}
+
+// sealIndex returns the CSV index read from r as it is stored with
+// flagEncryptedIndex.
+func (s *sealer) sealIndex(r io.Reader) ([]byte, error) {
+	s.buf.Reset()
+	if _, err := s.buf.ReadFrom(r); err != nil {
+		return nil, fmt.Errorf("failed to read CSV data: %w", err)
+	}
+	var sealed bytes.Buffer
+	if _, err := s.writeTo(&sealed, nil); err != nil {
+		return nil, err
+	}
+	return sealed.Bytes(), nil
+}
@@ -0,0 +1,335 @@
+package ixtar
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEncryption(t *testing.T) {
+	secret := strings.Repeat("top secret ", 500)
+	files := map[string]string{
+		"a.txt":      secret,
+		"copy.txt":   secret,
+		"dir/b.bin":  "bravo",
+		"empty.txt":  "",
+		"packed.txt": strings.Repeat("compress me ", 1000),
+	}
+	srcDir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(srcDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	key := bytes.Repeat([]byte{7}, 32)
+	bundlePath := filepath.Join(t.TempDir(), "secret.ixtar")
+	_, err := CreateBundleWithOptions(srcDir, bundlePath, CreateOptions{
+		Encryption: &Encryption{Key: key},
+		Compress:   func(path string) bool { return path == "packed.txt" },
+	})
+	if err != nil {
+		t.Fatalf("Failed to create bundle: %v", err)
+	}
+
+	raw, err := os.ReadFile(bundlePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(raw, []byte("top secret")) || bytes.Contains(raw, []byte("bravo")) {
+		t.Error("Expected no plaintext in the bundle")
+	}
+
+	// Without the key the index is readable, the files aren't
+	ix, err := NewIxTar(bundlePath)
+	if err != nil {
+		t.Fatalf("Failed to open bundle without key: %v", err)
+	}
+	if ix.Len() != len(files) {
+		t.Errorf("Expected %d files, got %d", len(files), ix.Len())
+	}
+	if _, err := ix.ExtractBytesOfFile("a.txt"); !errors.Is(err, ErrKeyRequired) {
+		t.Errorf("Expected ErrKeyRequired, got %v", err)
+	}
+	if err := ix.ExtractAll(t.TempDir()); !errors.Is(err, ErrKeyRequired) {
+		t.Errorf("Expected ErrKeyRequired extracting everything, got %v", err)
+	}
+	ix.Close()
+
+	if _, err := NewIxTar(bundlePath, WithKey(bytes.Repeat([]byte{8}, 32))); !errors.Is(err, ErrWrongKey) {
+		t.Errorf("Expected ErrWrongKey, got %v", err)
+	}
+
+	ix, err = NewIxTar(bundlePath, WithKey(key), WithVerifyOnRead())
+	if err != nil {
+		t.Fatalf("Failed to open bundle with key: %v", err)
+	}
+	defer ix.Close()
+	for name, content := range files {
+		if got, err := ix.ExtractBytesOfFile(name); err != nil || string(got) != content {
+			t.Errorf("%s: got %d bytes (%v)", name, len(got), err)
+		}
+		var buf bytes.Buffer
+		if _, err := ix.ExtractToWriter(name, &buf); err != nil || buf.String() != content {
+			t.Errorf("%s: ExtractToWriter got %d bytes (%v)", name, buf.Len(), err)
+		}
+	}
+	if got, err := ix.ExtractRange("packed.txt", 12, 7); err != nil || string(got) != "compres" {
+		t.Errorf("ExtractRange: got %q (%v)", got, err)
+	}
+	if stat, err := ix.Stat("packed.txt"); err != nil || stat.Encryption != "aes-gcm" || stat.Compression != "deflate" {
+		t.Errorf("Expected a compressed and encrypted entry, got %+v (%v)", stat, err)
+	}
+
+	outDir := t.TempDir()
+	if err := ix.ExtractAll(outDir); err != nil {
+		t.Fatalf("ExtractAll failed: %v", err)
+	}
+	if got, err := os.ReadFile(filepath.Join(outDir, "dir", "b.bin")); err != nil || string(got) != "bravo" {
+		t.Errorf("dir/b.bin: got %q (%v)", got, err)
+	}
+
+	// Every file gets its own nonce, so equal files are stored differently
+	a, _ := ix.Stat("a.txt")
+	c, _ := ix.Stat("copy.txt")
+	size := a.Size + gcmNonceSize + gcmTagSize
+	if bytes.Equal(raw[a.Offset:a.Offset+size], raw[c.Offset:c.Offset+size]) {
+		t.Error("Expected equal files to be encrypted differently")
+	}
+
+	// Each file's data is bound to its index entry, so swapping the data of
+	// two equal-size files fails authentication
+	swapped := append([]byte(nil), raw...)
+	copy(swapped[a.Offset:a.Offset+size], raw[c.Offset:c.Offset+size])
+	copy(swapped[c.Offset:c.Offset+size], raw[a.Offset:a.Offset+size])
+	swappedPath := filepath.Join(t.TempDir(), "swapped.ixtar")
+	if err := os.WriteFile(swappedPath, swapped, 0644); err != nil {
+		t.Fatal(err)
+	}
+	ix3, err := NewIxTar(swappedPath, WithKey(key))
+	if err != nil {
+		t.Fatalf("Failed to open swapped bundle: %v", err)
+	}
+	defer ix3.Close()
+	if _, err := ix3.ExtractBytesOfFile("a.txt"); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("Expected ErrChecksumMismatch for swapped data, got %v", err)
+	}
+
+	// Tampering is detected even without stored checksums being checked
+	raw[a.Offset+gcmNonceSize] ^= 1
+	tampered := filepath.Join(t.TempDir(), "tampered.ixtar")
+	if err := os.WriteFile(tampered, raw, 0644); err != nil {
+		t.Fatal(err)
+	}
+	ix2, err := NewIxTar(tampered, WithKey(key))
+	if err != nil {
+		t.Fatalf("Failed to open tampered bundle: %v", err)
+	}
+	defer ix2.Close()
+	if _, err := ix2.ExtractBytesOfFile("a.txt"); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("Expected ErrChecksumMismatch for tampered data, got %v", err)
+	}
+}
+
+func TestEncryptionInvalidKey(t *testing.T) {
+	_, err := CreateBundleWithOptions(t.TempDir(), filepath.Join(t.TempDir(), "bad.ixtar"), CreateOptions{
+		Encryption: &Encryption{Key: []byte("short")},
+	})
+	if err == nil || !strings.Contains(err.Error(), "invalid encryption key") {
+		t.Errorf("Expected an invalid key error, got %v", err)
+	}
+}
+
+func TestEncryptedIndex(t *testing.T) {
+	srcDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(srcDir, "confidential"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(srcDir, "confidential", "merger-plan.txt"), []byte("alpha"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	key := bytes.Repeat([]byte{7}, 16)
+	bundlePath := filepath.Join(t.TempDir(), "secret.ixtar")
+	opts := CreateOptions{Encryption: &Encryption{Key: key, Index: true}, Trailer: true}
+	if _, err := CreateBundleWithOptions(srcDir, bundlePath, opts); err != nil {
+		t.Fatalf("Failed to create bundle: %v", err)
+	}
+
+	raw, err := os.ReadFile(bundlePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(raw, []byte("merger-plan")) {
+		t.Error("Expected no plaintext path in the bundle")
+	}
+	estimate, err := EstimateBundleSize(srcDir, opts)
+	if err != nil || estimate < int64(len(raw)) {
+		t.Errorf("Expected an estimate of at least %d bytes, got %d (%v)", len(raw), estimate, err)
+	}
+
+	if _, err := NewIxTar(bundlePath); !errors.Is(err, ErrKeyRequired) {
+		t.Errorf("Expected ErrKeyRequired opening without the key, got %v", err)
+	}
+	if _, err := NewIxTar(bundlePath, WithKey(bytes.Repeat([]byte{8}, 16))); !errors.Is(err, ErrWrongKey) {
+		t.Errorf("Expected ErrWrongKey, got %v", err)
+	}
+	if _, err := LookupStreaming(bundlePath, "confidential/merger-plan.txt"); !errors.Is(err, ErrKeyRequired) {
+		t.Errorf("Expected LookupStreaming to need the key, got %v", err)
+	}
+
+	ix, err := NewIxTar(bundlePath, WithKey(key))
+	if err != nil {
+		t.Fatalf("Failed to open bundle with key: %v", err)
+	}
+	defer ix.Close()
+	if paths := ix.ListPaths(); len(paths) != 1 || paths[0] != "confidential/merger-plan.txt" {
+		t.Errorf("Unexpected paths %v", paths)
+	}
+	if got, err := ix.ExtractBytesOfFile("confidential/merger-plan.txt"); err != nil || string(got) != "alpha" {
+		t.Errorf("Got %q (%v)", got, err)
+	}
+	if index, err := ix.RawIndex(); err != nil || !bytes.Contains(index, []byte("merger-plan")) {
+		t.Errorf("Expected RawIndex to be decrypted, got %q (%v)", index, err)
+	}
+
+	f, err := os.Open(bundlePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	streamed, err := NewIxTarFromStream(f, WithKey(key))
+	if err != nil {
+		t.Fatalf("Failed to open stream with key: %v", err)
+	}
+	if got, err := streamed.ExtractBytesOfFile("confidential/merger-plan.txt"); err != nil || string(got) != "alpha" {
+		t.Errorf("Stream: got %q (%v)", got, err)
+	}
+
+	// Rewriting the bundle would store the index in the clear
+	if _, err := Compact(bundlePath); !errors.Is(err, ErrKeyRequired) {
+		t.Errorf("Compact: expected ErrKeyRequired, got %v", err)
+	}
+	if _, err := AppendFile(bundlePath, filepath.Join(srcDir, "confidential", "merger-plan.txt"), "b.txt"); !errors.Is(err, ErrKeyRequired) {
+		t.Errorf("AppendFile: expected ErrKeyRequired, got %v", err)
+	}
+	if _, err := RemoveFile(bundlePath, "confidential/merger-plan.txt"); !errors.Is(err, ErrKeyRequired) {
+		t.Errorf("RemoveFile: expected ErrKeyRequired, got %v", err)
+	}
+	if _, err := Recompress(bundlePath, bundlePath, CompressionDeflate); !errors.Is(err, ErrKeyRequired) {
+		t.Errorf("Recompress: expected ErrKeyRequired, got %v", err)
+	}
+}
+
+func TestEncryptionPassword(t *testing.T) {
+	defer func(params scryptInfo) { defaultScrypt = params }(defaultScrypt)
+	defaultScrypt.N = 1 << 10
+
+	if k1, k2 := DeriveKey("pw", []byte("salt")), DeriveKey("pw", []byte("salt")); !bytes.Equal(k1, k2) || len(k1) != 32 {
+		t.Errorf("Expected the same 32 byte key, got %x and %x", k1, k2)
+	}
+	if bytes.Equal(DeriveKey("pw", []byte("salt")), DeriveKey("pw", []byte("pepper"))) {
+		t.Error("Expected another salt to give another key")
+	}
+
+	srcDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("alpha"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var salts [][]byte
+	for _, name := range []string{"one.ixtar", "two.ixtar"} {
+		bundlePath := filepath.Join(t.TempDir(), name)
+		_, err := CreateBundleWithOptions(srcDir, bundlePath, CreateOptions{
+			Encryption: &Encryption{Password: "correct horse", Index: true},
+		})
+		if err != nil {
+			t.Fatalf("Failed to create bundle: %v", err)
+		}
+
+		if _, err := NewIxTar(bundlePath, WithPassword("wrong horse")); !errors.Is(err, ErrWrongKey) {
+			t.Errorf("Expected ErrWrongKey, got %v", err)
+		}
+		ix, err := NewIxTar(bundlePath, WithPassword("correct horse"))
+		if err != nil {
+			t.Fatalf("Failed to open bundle with password: %v", err)
+		}
+		if got, err := ix.ExtractBytesOfFile("a.txt"); err != nil || string(got) != "alpha" {
+			t.Errorf("a.txt: got %q (%v)", got, err)
+		}
+		kdf := ix.info.Encryption.KDF
+		ix.Close()
+		if kdf == nil || kdf.N != 1<<10 || kdf.R != 8 || kdf.P != 1 || len(kdf.Salt) != saltSize {
+			t.Fatalf("Expected the scrypt parameters to be stored, got %+v", kdf)
+		}
+		salts = append(salts, kdf.Salt)
+
+		// The stored salt gives the key back
+		ix, err = NewIxTar(bundlePath, WithKey(DeriveKey("correct horse", kdf.Salt)))
+		if err != nil {
+			t.Fatalf("Failed to open bundle with the derived key: %v", err)
+		}
+		ix.Close()
+	}
+	if bytes.Equal(salts[0], salts[1]) {
+		t.Error("Expected every bundle to get its own salt")
+	}
+
+	// A bundle encrypted with a raw key has no salt to derive a key with
+	bundlePath := filepath.Join(t.TempDir(), "key.ixtar")
+	if _, err := CreateBundleWithOptions(srcDir, bundlePath, CreateOptions{Encryption: &Encryption{Key: bytes.Repeat([]byte{7}, 32)}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewIxTar(bundlePath, WithPassword("correct horse")); !errors.Is(err, ErrWrongKey) {
+		t.Errorf("Expected ErrWrongKey for a password on a keyed bundle, got %v", err)
+	}
+	_, err := CreateBundleWithOptions(srcDir, filepath.Join(t.TempDir(), "both.ixtar"), CreateOptions{
+		Encryption: &Encryption{Key: bytes.Repeat([]byte{7}, 32), Password: "pw"},
+	})
+	if err == nil {
+		t.Error("Expected Key and Password together to be refused")
+	}
+}
+
+func TestEncryptedSyncAndUpdate(t *testing.T) {
+	srcDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("alpha"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	key := bytes.Repeat([]byte{7}, 32)
+	bundlePath := filepath.Join(t.TempDir(), "secret.ixtar")
+	create := CreateOptions{Encryption: &Encryption{Key: key, Index: true}}
+	if _, err := CreateBundleWithOptions(srcDir, bundlePath, create); err != nil {
+		t.Fatalf("Failed to create bundle: %v", err)
+	}
+
+	destDir := t.TempDir()
+	if _, err := SyncWithOptions(bundlePath, destDir, SyncOptions{}); !errors.Is(err, ErrKeyRequired) {
+		t.Errorf("Expected ErrKeyRequired syncing without a key, got %v", err)
+	}
+	for _, want := range []SyncResult{{Added: 1}, {Unchanged: 1}} {
+		got, err := SyncWithOptions(bundlePath, destDir, SyncOptions{Open: []OpenOption{WithKey(key)}})
+		if err != nil || *got != want {
+			t.Errorf("Expected %+v, got %+v (%v)", want, got, err)
+		}
+	}
+
+	update := UpdateOptions{Create: create, CompareBy: CompareChecksum}
+	if _, err := UpdateBundle(srcDir, bundlePath, update); !errors.Is(err, ErrKeyRequired) {
+		t.Errorf("Expected ErrKeyRequired updating without a key, got %v", err)
+	}
+	update.Open = []OpenOption{WithKey(key)}
+	if result, err := UpdateBundle(srcDir, bundlePath, update); err != nil || result.Updated {
+		t.Errorf("Expected an unchanged bundle, got %+v (%v)", result, err)
+	}
+	if err := os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("bravo"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if result, err := UpdateBundle(srcDir, bundlePath, update); err != nil || !result.Updated {
+		t.Errorf("Expected an updated bundle, got %+v (%v)", result, err)
+	}
+}
@@ -0,0 +1,90 @@
+package ixtar
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// walkFollowing is filepath.Walk, except that symlinks are followed: fn sees
+// a link with the info of its target under the link's name, and a link to a
+// directory is walked as if the directory were at the link's path. A
+// dangling link, or a link to a directory that is already being walked
+// further up, which would loop forever, is passed to fn as an error.
+func walkFollowing(root string, fn filepath.WalkFunc) error {
+	info, err := os.Lstat(root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = walkFollow(root, info, fn, make(map[string]bool))
+	}
+	if err == filepath.SkipDir || err == filepath.SkipAll {
+		return nil
+	}
+	return err
+}
+
+// walkFollow walks path, whose Lstat info is info. ancestors holds the real
+// paths of the directories being walked.
+func walkFollow(path string, info os.FileInfo, fn filepath.WalkFunc, ancestors map[string]bool) error {
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Stat(path)
+		if err != nil {
+			return fn(path, info, fmt.Errorf("dangling symlink %s: %w", path, err))
+		}
+		info = linkInfo{target, info.Name()}
+	}
+	if !info.IsDir() {
+		return fn(path, info, nil)
+	}
+
+	realPath, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return fn(path, info, err)
+	}
+	if ancestors[realPath] {
+		return fn(path, info, fmt.Errorf("symlink loop: %s leads back to %s", path, realPath))
+	}
+	if err := fn(path, info, nil); err != nil {
+		if err == filepath.SkipDir {
+			return nil
+		}
+		return err
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		if err := fn(path, info, err); err != nil && err != filepath.SkipDir {
+			return err
+		}
+		return nil
+	}
+	ancestors[realPath] = true
+	defer delete(ancestors, realPath)
+	for _, entry := range entries {
+		name := filepath.Join(path, entry.Name())
+		entryInfo, err := entry.Info()
+		if err != nil {
+			err = fn(name, nil, err)
+		} else {
+			err = walkFollow(name, entryInfo, fn, ancestors)
+		}
+		if err == filepath.SkipDir {
+			// Like filepath.Walk, a file returning SkipDir skips the rest
+			// of its directory
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// linkInfo is the info of a symlink's target under the link's name.
+type linkInfo struct {
+	os.FileInfo
+	name string
+}
+
+func (i linkInfo) Name() string { return i.name }
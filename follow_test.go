@@ -0,0 +1,99 @@
+package ixtar
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFollowSymlinks(t *testing.T) {
+	srcDir := t.TempDir()
+	outside := t.TempDir()
+	if err := os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("alpha"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(outside, "b.txt"), []byte("bravo"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("a.txt", filepath.Join(srcDir, "file-link")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+	if err := os.Symlink(outside, filepath.Join(srcDir, "dir-link")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without the option the links are left out
+	bundlePath := filepath.Join(t.TempDir(), "links.ixtar")
+	result, err := CreateBundleWithOptions(srcDir, bundlePath, CreateOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create bundle: %v", err)
+	}
+	if result.Files != 1 || result.SkippedSymlinks != 2 {
+		t.Errorf("Expected 1 file and 2 skipped links, got %+v", result)
+	}
+
+	result, err = CreateBundleWithOptions(srcDir, bundlePath, CreateOptions{FollowSymlinks: true})
+	if err != nil {
+		t.Fatalf("Failed to create bundle: %v", err)
+	}
+	if result.Files != 3 || result.SkippedSymlinks != 0 {
+		t.Errorf("Expected 3 files and no skipped links, got %+v", result)
+	}
+	ix, err := NewIxTar(bundlePath)
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	defer ix.Close()
+	for name, content := range map[string]string{"a.txt": "alpha", "file-link": "alpha", "dir-link/b.txt": "bravo"} {
+		if got, err := ix.ExtractBytesOfFile(name); err != nil || string(got) != content {
+			t.Errorf("%s: got %q (%v)", name, got, err)
+		}
+	}
+}
+
+func TestFollowSymlinksLoop(t *testing.T) {
+	srcDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(srcDir, "dir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(srcDir, "dir", "a.txt"), []byte("alpha"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("..", filepath.Join(srcDir, "dir", "up")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+
+	bundlePath := filepath.Join(t.TempDir(), "loop.ixtar")
+	_, err := CreateBundleWithOptions(srcDir, bundlePath, CreateOptions{FollowSymlinks: true})
+	if err == nil || !strings.Contains(err.Error(), "symlink loop") {
+		t.Fatalf("Expected a symlink loop error, got %v", err)
+	}
+
+	// With ContinueOnError the loop is skipped like an unreadable entry
+	var skipped []string
+	result, err := CreateBundleWithOptions(srcDir, bundlePath, CreateOptions{
+		FollowSymlinks:  true,
+		ContinueOnError: true,
+		OnError:         func(path string, err error) { skipped = append(skipped, path) },
+	})
+	if err != nil {
+		t.Fatalf("Failed to create bundle: %v", err)
+	}
+	if result.Files != 1 || result.SkippedErrors != 1 || len(skipped) != 1 || filepath.Base(skipped[0]) != "up" {
+		t.Errorf("Expected a.txt stored and the loop skipped, got %+v, skipped %v", result, skipped)
+	}
+}
+
+func TestFollowSymlinksDangling(t *testing.T) {
+	srcDir := t.TempDir()
+	if err := os.Symlink("missing.txt", filepath.Join(srcDir, "dangling")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+	bundlePath := filepath.Join(t.TempDir(), "dangling.ixtar")
+	_, err := CreateBundleWithOptions(srcDir, bundlePath, CreateOptions{FollowSymlinks: true})
+	if !errors.Is(err, os.ErrNotExist) || !strings.Contains(err.Error(), "dangling symlink") {
+		t.Errorf("Expected a dangling symlink error, got %v", err)
+	}
+}
@@ -0,0 +1,183 @@
+package ixtar
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// defaultFollowInterval is how often a Follower checks its bundle file.
+const defaultFollowInterval = time.Second
+
+// WithFollowInterval sets how often a bundle opened with OpenFollow checks
+// whether its file was replaced, one second by default. NewIxTar ignores it.
+func WithFollowInterval(d time.Duration) OpenOption {
+	return func(c *openConfig) {
+		c.followInterval = d
+	}
+}
+
+// Follower reads a bundle that another process keeps updating, e.g. with
+// AppendFile. Bundles are never changed in place: updates write a new file
+// and rename it over the old one. A Follower checks the bundle path every
+// follow interval and, once a different file is there or its size or
+// modification time changed, opens it and switches to it, so appended files
+// become visible without reopening by hand.
+//
+// Every call reads one complete version of the bundle, never a mix of two,
+// and a switch waits for the calls in progress. Consecutive calls may see
+// different versions, such as a file listed by ListPaths that is gone by
+// the time it is read; View runs several reads on the same version. New
+// files show up within one interval of the rename, or right away after
+// Reload.
+type Follower struct {
+	path   string
+	opts   []OpenOption
+	logger *slog.Logger
+
+	mu     sync.RWMutex
+	ix     *IxTar
+	stat   os.FileInfo // of the bundle file ix was opened from, taken before
+	closed bool
+
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// OpenFollow opens the bundle at bundlePath like NewIxTar with opts and
+// keeps following it until Close. WithFollowInterval sets how often it
+// checks for a new version; failures to open one are logged to WithLogger
+// and retried at the next check, while the current version stays in use.
+func OpenFollow(bundlePath string, opts ...OpenOption) (*Follower, error) {
+	cfg, err := newOpenConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.followInterval <= 0 {
+		return nil, fmt.Errorf("invalid follow interval: %v", cfg.followInterval)
+	}
+	f := &Follower{
+		path:   bundlePath,
+		opts:   opts,
+		logger: orDiscard(cfg.logger),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	if _, err := f.Reload(); err != nil {
+		return nil, err
+	}
+	go f.poll(cfg.followInterval)
+	return f, nil
+}
+
+// poll reloads the bundle every interval until Close.
+func (f *Follower) poll(interval time.Duration) {
+	defer close(f.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-f.stop:
+			return
+		case <-ticker.C:
+			if _, err := f.Reload(); err != nil {
+				f.logger.Warn("failed to reload bundle", "path", f.path, "error", err)
+			}
+		}
+	}
+}
+
+// Reload switches to the file at the bundle path if it changed since it was
+// opened, and reports whether it did. It is what the periodic checks call,
+// for callers that know the bundle was just updated.
+func (f *Follower) Reload() (bool, error) {
+	stat, err := os.Stat(f.path)
+	if err != nil {
+		return false, fmt.Errorf("failed to stat bundle file: %w", err)
+	}
+	f.mu.RLock()
+	unchanged := f.stat != nil && os.SameFile(f.stat, stat) && f.stat.Size() == stat.Size() && f.stat.ModTime().Equal(stat.ModTime())
+	f.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	ix, err := NewIxTar(f.path, f.opts...)
+	if err != nil {
+		return false, err
+	}
+	f.mu.Lock()
+	if f.closed {
+		f.mu.Unlock()
+		ix.Close()
+		return false, ErrClosed
+	}
+	old := f.ix
+	f.ix, f.stat = ix, stat
+	f.mu.Unlock()
+	if old != nil {
+		old.Close()
+	}
+	return true, nil
+}
+
+// View calls fn with the current version of the bundle, which stays open
+// and current until fn returns. fn must not keep ix or call Reload.
+func (f *Follower) View(fn func(ix *IxTar) error) error {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return fn(f.ix)
+}
+
+// Exists reports whether filePath is a file of the current version.
+func (f *Follower) Exists(filePath string) bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	_, err := f.ix.lookup(filePath)
+	return err == nil
+}
+
+// ExtractBytesOfFile is IxTar.ExtractBytesOfFile on the current version.
+func (f *Follower) ExtractBytesOfFile(filePath string) ([]byte, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.ix.ExtractBytesOfFile(filePath)
+}
+
+// Stat is IxTar.Stat on the current version.
+func (f *Follower) Stat(filePath string) (FileStat, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.ix.Stat(filePath)
+}
+
+// ListPaths is IxTar.ListPaths on the current version.
+func (f *Follower) ListPaths() []string {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.ix.ListPaths()
+}
+
+// Len is IxTar.Len on the current version.
+func (f *Follower) Len() int {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.ix.Len()
+}
+
+// Close stops following and closes the current version. It is safe to call
+// more than once; reads after Close fail with ErrClosed.
+func (f *Follower) Close() error {
+	f.closeOnce.Do(func() {
+		close(f.stop)
+	})
+	<-f.done
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = true
+	return f.ix.Close()
+}
@@ -0,0 +1,96 @@
+package ixtar
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestOpenFollow(t *testing.T) {
+	bundlePath := createTestBundle(t, map[string]string{"a.txt": "alpha"})
+	f, err := OpenFollow(bundlePath, WithFollowInterval(10*time.Millisecond))
+	if err != nil {
+		t.Fatalf("OpenFollow failed: %v", err)
+	}
+	defer f.Close()
+	if !f.Exists("a.txt") || f.Exists("b.txt") {
+		t.Errorf("Expected only a.txt, got %v", f.ListPaths())
+	}
+
+	newFile := filepath.Join(t.TempDir(), "b.txt")
+	if err := os.WriteFile(newFile, []byte("bravo"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := AppendFile(bundlePath, newFile, "b.txt"); err != nil {
+		t.Fatalf("AppendFile failed: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for !f.Exists("b.txt") && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got, err := f.ExtractBytesOfFile("b.txt"); err != nil || string(got) != "bravo" {
+		t.Errorf("Expected the appended file, got %q (%v)", got, err)
+	}
+	if f.Len() != 2 {
+		t.Errorf("Expected 2 files, got %d", f.Len())
+	}
+
+	if err := f.Close(); err != nil {
+		t.Errorf("Close failed: %v", err)
+	}
+	if _, err := f.ExtractBytesOfFile("a.txt"); !errors.Is(err, ErrClosed) {
+		t.Errorf("Expected ErrClosed, got %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Errorf("Second Close failed: %v", err)
+	}
+}
+
+func TestFollowerReload(t *testing.T) {
+	bundlePath := createTestBundle(t, map[string]string{"a.txt": "alpha"})
+	f, err := OpenFollow(bundlePath, WithFollowInterval(time.Hour))
+	if err != nil {
+		t.Fatalf("OpenFollow failed: %v", err)
+	}
+	defer f.Close()
+	if reloaded, err := f.Reload(); err != nil || reloaded {
+		t.Errorf("Expected no reload of an unchanged bundle, got %v (%v)", reloaded, err)
+	}
+
+	if _, err := RemoveFile(bundlePath, "a.txt"); err != nil {
+		t.Fatalf("RemoveFile failed: %v", err)
+	}
+	if reloaded, err := f.Reload(); err != nil || !reloaded {
+		t.Errorf("Expected a reload, got %v (%v)", reloaded, err)
+	}
+	if f.Exists("a.txt") {
+		t.Error("Expected a.txt to be gone")
+	}
+
+	// A file that isn't a bundle leaves the current version in use
+	broken := bundlePath + ".new"
+	if err := os.WriteFile(broken, []byte("not a bundle"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(broken, bundlePath); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Reload(); err == nil {
+		t.Error("Expected reloading a broken bundle to fail")
+	}
+	err = f.View(func(ix *IxTar) error {
+		if ix.Len() != 0 {
+			t.Errorf("Expected the empty version, got %v", ix.ListPaths())
+		}
+		return nil
+	})
+	if err != nil {
+		t.Errorf("View failed: %v", err)
+	}
+
+	if _, err := OpenFollow(bundlePath, WithFollowInterval(0)); err == nil {
+		t.Error("Expected an invalid interval to fail")
+	}
+}
@@ -0,0 +1,109 @@
+//go:build fuse
+
+package ixtar
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"syscall"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+// Mount serves the bundle as a read-only filesystem at mountpoint and blocks
+// until it is unmounted (e.g. with fusermount -u). Directories are derived
+// from the stored paths; bundles without stored paths show their files by
+// hash in the root directory. Build with -tags fuse to include it.
+func Mount(bundlePath, mountpoint string) error {
+	ix, err := NewIxTar(bundlePath)
+	if err != nil {
+		return err
+	}
+	defer ix.Close()
+
+	server, err := fs.Mount(mountpoint, &fuseDir{ix: ix}, &fs.Options{
+		MountOptions: fuse.MountOptions{
+			FsName: bundlePath,
+			Name:   "ixtar",
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to mount bundle: %w", err)
+	}
+
+	server.Wait()
+	return nil
+}
+
+type fuseDir struct {
+	fs.Inode
+	ix *IxTar
+}
+
+var _ = (fs.NodeOnAdder)((*fuseDir)(nil))
+
+// OnAdd builds the whole tree when the root is mounted.
+func (d *fuseDir) OnAdd(ctx context.Context) {
+	if d.ix == nil {
+		return
+	}
+
+	for _, entry := range d.ix.Entries() {
+		name := entry.Path
+		if name == "" {
+			name = entry.Hash
+		}
+
+		parent := &d.Inode
+		components := strings.Split(name, "/")
+		for _, dir := range components[:len(components)-1] {
+			child := parent.GetChild(dir)
+			if child == nil {
+				child = parent.NewPersistentInode(ctx, &fuseDir{}, fs.StableAttr{Mode: fuse.S_IFDIR})
+				parent.AddChild(dir, child, true)
+			}
+			parent = child
+		}
+
+		file := parent.NewPersistentInode(ctx, &fuseFile{ix: d.ix, stat: entry}, fs.StableAttr{})
+		parent.AddChild(components[len(components)-1], file, true)
+	}
+}
+
+type fuseFile struct {
+	fs.Inode
+	ix   *IxTar
+	stat FileStat
+}
+
+var _ = (fs.NodeGetattrer)((*fuseFile)(nil))
+var _ = (fs.NodeOpener)((*fuseFile)(nil))
+var _ = (fs.NodeReader)((*fuseFile)(nil))
+
+func (f *fuseFile) Getattr(ctx context.Context, fh fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	out.Mode = 0444
+	out.Size = uint64(f.stat.Size)
+	return 0
+}
+
+func (f *fuseFile) Open(ctx context.Context, flags uint32) (fs.FileHandle, uint32, syscall.Errno) {
+	if flags&(syscall.O_WRONLY|syscall.O_RDWR) != 0 {
+		return nil, 0, syscall.EROFS
+	}
+	return nil, fuse.FOPEN_KEEP_CACHE, 0
+}
+
+func (f *fuseFile) Read(ctx context.Context, fh fs.FileHandle, dest []byte, off int64) (fuse.ReadResult, syscall.Errno) {
+	if off >= f.stat.Size {
+		return fuse.ReadResultData(nil), 0
+	}
+
+	fileIndex := f.ix.files()[f.stat.Hash]
+	data, err := f.ix.readRange(fileIndex, off, int64(len(dest)))
+	if err != nil {
+		return nil, syscall.EIO
+	}
+	return fuse.ReadResultData(data), 0
+}
@@ -1,3 +1,14 @@
 module github.com/t0mk/ixtar
 
 go 1.22.2
+
+require (
+	github.com/cespare/xxhash/v2 v2.3.0
+	// Only imported by fuse.go, behind the fuse build tag. go.mod lists the
+	// requirements of every build configuration, so it stays, but builds
+	// without the tag neither compile nor link it.
+	github.com/hanwen/go-fuse/v2 v2.7.2
+	golang.org/x/crypto v0.31.0
+)
+
+require golang.org/x/sys v0.28.0 // indirect
@@ -0,0 +1,21 @@
+module github.com/t0mk/ixtar/grpc
+
+go 1.22.2
+
+require (
+	github.com/t0mk/ixtar v0.0.0
+	google.golang.org/grpc v1.71.3
+	google.golang.org/protobuf v1.36.6
+)
+
+require (
+	github.com/cespare/xxhash/v2 v2.3.0 // indirect
+	github.com/hanwen/go-fuse/v2 v2.7.2 // indirect
+	golang.org/x/crypto v0.33.0 // indirect
+	golang.org/x/net v0.35.0 // indirect
+	golang.org/x/sys v0.30.0 // indirect
+	golang.org/x/text v0.22.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20250115164207-1a7da9e5054f // indirect
+)
+
+replace github.com/t0mk/ixtar => ../
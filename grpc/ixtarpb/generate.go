@@ -0,0 +1,5 @@
+// Package ixtarpb holds the protobuf messages and gRPC stubs of the Bundle
+// service. The Go files are generated from ixtar.proto.
+package ixtarpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative ixtar.proto
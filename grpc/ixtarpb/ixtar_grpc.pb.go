@@ -0,0 +1,214 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.6.2
+// - protoc             (unknown)
+// source: ixtar.proto
+
+package ixtarpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Bundle_Stat_FullMethodName = "/ixtar.v1.Bundle/Stat"
+	Bundle_Read_FullMethodName = "/ixtar.v1.Bundle/Read"
+	Bundle_List_FullMethodName = "/ixtar.v1.Bundle/List"
+)
+
+// BundleClient is the client API for Bundle service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Bundle serves read-only access to the files of an ixtar bundle.
+type BundleClient interface {
+	// Stat returns the index information of a single file.
+	Stat(ctx context.Context, in *StatRequest, opts ...grpc.CallOption) (*FileInfo, error)
+	// Read streams the content of a file, or part of it, in chunks.
+	Read(ctx context.Context, in *ReadRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Chunk], error)
+	// List streams the index information of every file in offset order.
+	List(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[FileInfo], error)
+}
+
+type bundleClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewBundleClient(cc grpc.ClientConnInterface) BundleClient {
+	return &bundleClient{cc}
+}
+
+func (c *bundleClient) Stat(ctx context.Context, in *StatRequest, opts ...grpc.CallOption) (*FileInfo, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(FileInfo)
+	err := c.cc.Invoke(ctx, Bundle_Stat_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *bundleClient) Read(ctx context.Context, in *ReadRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Chunk], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Bundle_ServiceDesc.Streams[0], Bundle_Read_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ReadRequest, Chunk]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Bundle_ReadClient = grpc.ServerStreamingClient[Chunk]
+
+func (c *bundleClient) List(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[FileInfo], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Bundle_ServiceDesc.Streams[1], Bundle_List_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ListRequest, FileInfo]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Bundle_ListClient = grpc.ServerStreamingClient[FileInfo]
+
+// BundleServer is the server API for Bundle service.
+// All implementations must embed UnimplementedBundleServer
+// for forward compatibility.
+//
+// Bundle serves read-only access to the files of an ixtar bundle.
+type BundleServer interface {
+	// Stat returns the index information of a single file.
+	Stat(context.Context, *StatRequest) (*FileInfo, error)
+	// Read streams the content of a file, or part of it, in chunks.
+	Read(*ReadRequest, grpc.ServerStreamingServer[Chunk]) error
+	// List streams the index information of every file in offset order.
+	List(*ListRequest, grpc.ServerStreamingServer[FileInfo]) error
+	mustEmbedUnimplementedBundleServer()
+}
+
+// UnimplementedBundleServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedBundleServer struct{}
+
+func (UnimplementedBundleServer) Stat(context.Context, *StatRequest) (*FileInfo, error) {
+	return nil, status.Error(codes.Unimplemented, "method Stat not implemented")
+}
+func (UnimplementedBundleServer) Read(*ReadRequest, grpc.ServerStreamingServer[Chunk]) error {
+	return status.Error(codes.Unimplemented, "method Read not implemented")
+}
+func (UnimplementedBundleServer) List(*ListRequest, grpc.ServerStreamingServer[FileInfo]) error {
+	return status.Error(codes.Unimplemented, "method List not implemented")
+}
+func (UnimplementedBundleServer) mustEmbedUnimplementedBundleServer() {}
+func (UnimplementedBundleServer) testEmbeddedByValue()                {}
+
+// UnsafeBundleServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to BundleServer will
+// result in compilation errors.
+type UnsafeBundleServer interface {
+	mustEmbedUnimplementedBundleServer()
+}
+
+func RegisterBundleServer(s grpc.ServiceRegistrar, srv BundleServer) {
+	// If the following call panics, it indicates UnimplementedBundleServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Bundle_ServiceDesc, srv)
+}
+
+func _Bundle_Stat_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StatRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BundleServer).Stat(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Bundle_Stat_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BundleServer).Stat(ctx, req.(*StatRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Bundle_Read_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ReadRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(BundleServer).Read(m, &grpc.GenericServerStream[ReadRequest, Chunk]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Bundle_ReadServer = grpc.ServerStreamingServer[Chunk]
+
+func _Bundle_List_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ListRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(BundleServer).List(m, &grpc.GenericServerStream[ListRequest, FileInfo]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Bundle_ListServer = grpc.ServerStreamingServer[FileInfo]
+
+// Bundle_ServiceDesc is the grpc.ServiceDesc for Bundle service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Bundle_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "ixtar.v1.Bundle",
+	HandlerType: (*BundleServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Stat",
+			Handler:    _Bundle_Stat_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Read",
+			Handler:       _Bundle_Read_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "List",
+			Handler:       _Bundle_List_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "ixtar.proto",
+}
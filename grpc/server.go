@@ -0,0 +1,121 @@
+// Package grpc serves an open ixtar bundle over gRPC using the Bundle
+// service defined in ixtarpb/ixtar.proto. It is a separate module so that
+// users of the core package don't depend on gRPC.
+package grpc
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/t0mk/ixtar"
+	"github.com/t0mk/ixtar/grpc/ixtarpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// DefaultChunkSize is the size of the chunks Read streams file bodies in.
+const DefaultChunkSize = 64 << 10
+
+// Server implements ixtarpb.BundleServer on top of an open bundle. The
+// bundle must stay open while the server is in use.
+type Server struct {
+	ixtarpb.UnimplementedBundleServer
+
+	ix *ixtar.IxTar
+
+	// ChunkSize is the size of the chunks Read streams, DefaultChunkSize
+	// when zero.
+	ChunkSize int
+}
+
+// NewServer returns a Server reading from ix.
+func NewServer(ix *ixtar.IxTar) *Server {
+	return &Server{ix: ix}
+}
+
+// Register registers a Server reading from ix with s.
+func Register(s *grpc.Server, ix *ixtar.IxTar) {
+	ixtarpb.RegisterBundleServer(s, NewServer(ix))
+}
+
+func (s *Server) Stat(ctx context.Context, req *ixtarpb.StatRequest) (*ixtarpb.FileInfo, error) {
+	stat, err := s.ix.Stat(req.GetPath())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return s.fileInfo(stat), nil
+}
+
+func (s *Server) Read(req *ixtarpb.ReadRequest, stream ixtarpb.Bundle_ReadServer) error {
+	stat, err := s.ix.Stat(req.GetPath())
+	if err != nil {
+		return toStatus(err)
+	}
+
+	offset, length := req.GetOffset(), req.GetLength()
+	if offset < 0 || length < 0 || offset > stat.Size {
+		return status.Errorf(codes.InvalidArgument, "invalid range %d+%d for file of size %d", offset, length, stat.Size)
+	}
+	end := stat.Size
+	if length > 0 && length < end-offset {
+		end = offset + length
+	}
+
+	chunkSize := int64(s.ChunkSize)
+	if chunkSize <= 0 {
+		chunkSize = DefaultChunkSize
+	}
+
+	// One reader for the whole range, so compressed and encrypted files
+	// are decoded once rather than for every chunk
+	r, err := s.ix.OpenSeeker(req.GetPath())
+	if err != nil {
+		return toStatus(err)
+	}
+	if _, err := r.Seek(offset, io.SeekStart); err != nil {
+		return toStatus(err)
+	}
+	buf := make([]byte, min(chunkSize, end-offset))
+	for off := offset; off < end; off += chunkSize {
+		if err := stream.Context().Err(); err != nil {
+			return status.FromContextError(err).Err()
+		}
+		data := buf[:min(chunkSize, end-off)]
+		if _, err := io.ReadFull(r, data); err != nil {
+			return toStatus(err)
+		}
+		if err := stream.Send(&ixtarpb.Chunk{Data: data}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Server) List(req *ixtarpb.ListRequest, stream ixtarpb.Bundle_ListServer) error {
+	for _, entry := range s.ix.Entries() {
+		if err := stream.Send(s.fileInfo(entry)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Server) fileInfo(stat ixtar.FileStat) *ixtarpb.FileInfo {
+	info := &ixtarpb.FileInfo{Path: stat.Path, Hash: stat.Hash, Size: stat.Size}
+	if stat.Path != "" {
+		info.Meta = s.ix.FileMeta(stat.Path)
+	}
+	return info
+}
+
+func toStatus(err error) error {
+	if errors.Is(err, ixtar.ErrFileNotFound) {
+		return status.Error(codes.NotFound, err.Error())
+	}
+	if errors.Is(err, ixtar.ErrNotRegularFile) {
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
@@ -0,0 +1,150 @@
+package grpc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/t0mk/ixtar"
+	"github.com/t0mk/ixtar/grpc/ixtarpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func startServer(t *testing.T, files map[string]string, chunkSize int) ixtarpb.BundleClient {
+	t.Helper()
+
+	srcDir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(srcDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	bundlePath := filepath.Join(t.TempDir(), "test.ixtar")
+	if err := ixtar.CreateBundle(srcDir, bundlePath); err != nil {
+		t.Fatalf("Failed to create bundle: %v", err)
+	}
+	ix, err := ixtar.NewIxTar(bundlePath)
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	t.Cleanup(func() { ix.Close() })
+
+	lis := bufconn.Listen(1 << 20)
+	s := grpc.NewServer()
+	srv := NewServer(ix)
+	srv.ChunkSize = chunkSize
+	ixtarpb.RegisterBundleServer(s, srv)
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return lis.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return ixtarpb.NewBundleClient(conn)
+}
+
+func readAll(t *testing.T, client ixtarpb.BundleClient, req *ixtarpb.ReadRequest) ([]byte, int, error) {
+	t.Helper()
+
+	stream, err := client.Read(context.Background(), req)
+	if err != nil {
+		return nil, 0, err
+	}
+	var buf bytes.Buffer
+	chunks := 0
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return buf.Bytes(), chunks, nil
+		}
+		if err != nil {
+			return nil, chunks, err
+		}
+		buf.Write(chunk.GetData())
+		chunks++
+	}
+}
+
+func TestServer(t *testing.T) {
+	large := strings.Repeat("0123456789", 1000)
+	client := startServer(t, map[string]string{
+		"small.txt":     "hello",
+		"dir/large.txt": large,
+	}, 4096)
+	ctx := context.Background()
+
+	info, err := client.Stat(ctx, &ixtarpb.StatRequest{Path: "dir/large.txt"})
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if info.GetSize() != int64(len(large)) || info.GetPath() != "dir/large.txt" {
+		t.Errorf("Unexpected file info: %v", info)
+	}
+
+	_, err = client.Stat(ctx, &ixtarpb.StatRequest{Path: "missing.txt"})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("Expected NotFound, got %v", err)
+	}
+
+	data, chunks, err := readAll(t, client, &ixtarpb.ReadRequest{Path: "dir/large.txt"})
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if string(data) != large || chunks != 3 {
+		t.Errorf("Expected %d bytes in 3 chunks, got %d bytes in %d chunks", len(large), len(data), chunks)
+	}
+
+	data, _, err = readAll(t, client, &ixtarpb.ReadRequest{Path: "dir/large.txt", Offset: 5, Length: 7})
+	if err != nil || string(data) != large[5:12] {
+		t.Errorf("Unexpected range read: %q, %v", data, err)
+	}
+
+	// offset+length would overflow, the range still ends with the file
+	data, _, err = readAll(t, client, &ixtarpb.ReadRequest{Path: "dir/large.txt", Offset: 5, Length: math.MaxInt64})
+	if err != nil || string(data) != large[5:] {
+		t.Errorf("Expected the rest of the file for a huge length, got %d bytes (%v)", len(data), err)
+	}
+
+	_, _, err = readAll(t, client, &ixtarpb.ReadRequest{Path: "small.txt", Offset: 10})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument, got %v", err)
+	}
+
+	stream, err := client.List(ctx, &ixtarpb.ListRequest{})
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	var paths []string
+	for {
+		info, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("List failed: %v", err)
+		}
+		paths = append(paths, info.GetPath())
+	}
+	if len(paths) != 2 {
+		t.Errorf("Expected 2 files, got %v", paths)
+	}
+}
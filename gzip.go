@@ -0,0 +1,74 @@
+package ixtar
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+)
+
+var gzipMagic = [2]byte{0x1f, 0x8b}
+
+// defaultMaxDecompressedSize is the default of WithMaxDecompressedSize.
+const defaultMaxDecompressedSize = 64 << 30
+
+// WithMaxDecompressedSize bounds the size a bundle gzipped as a whole may
+// decompress to, 64GB by default. NewIxTar decompresses such bundles into
+// a temporary file, which a small gzip bomb could otherwise grow until the
+// temp directory is full.
+func WithMaxDecompressedSize(size int64) OpenOption {
+	return func(c *openConfig) {
+		c.maxDecompressedSize = size
+	}
+}
+
+// gunzipIfCompressed checks whether file is a gzip-compressed bundle, such as
+// bundle.ixtar.gz. If it is, the bundle is decompressed into a temporary
+// file of at most maxSize bytes, file is closed and the temporary file is
+// returned positioned at its start; the caller must remove it. Otherwise
+// file is returned unchanged. file is closed if an error is returned.
+func gunzipIfCompressed(file *os.File, maxSize int64) (*os.File, bool, error) {
+	var magic [2]byte
+	if n, _ := file.ReadAt(magic[:], 0); n < len(magic) || magic != gzipMagic {
+		return file, false, nil
+	}
+	defer file.Close()
+
+	zr, err := gzip.NewReader(io.NewSectionReader(file, 0, 1<<63-1))
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read gzip header: %w", err)
+	}
+	// Anything but a bundle fails before it is decompressed
+	var b [headerSize]byte
+	if _, err := io.ReadFull(zr, b[:]); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, false, fmt.Errorf("%w: decompressed file is shorter than the %d byte header", ErrNotABundle, headerSize)
+		}
+		return nil, false, fmt.Errorf("failed to decompress bundle: %w", err)
+	}
+	if _, err := parseHeader(b); err != nil {
+		return nil, false, err
+	}
+
+	tmp, err := os.CreateTemp("", "ixtar-gunzip-*.ixtar")
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	_, err = tmp.Write(b[:])
+	var n int64
+	if err == nil {
+		n, err = io.Copy(tmp, io.LimitReader(zr, maxSize-headerSize+1))
+	}
+	if err == nil && n > maxSize-headerSize {
+		err = fmt.Errorf("bundle decompresses to more than %d bytes, see WithMaxDecompressedSize", maxSize)
+	}
+	if err == nil {
+		_, err = tmp.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, false, fmt.Errorf("failed to decompress bundle: %w", err)
+	}
+	return tmp, true, nil
+}
@@ -0,0 +1,126 @@
+package ixtar
+
+import (
+	"compress/gzip"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func gzipFile(t *testing.T, src string) string {
+	t.Helper()
+
+	data, err := os.ReadFile(src)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", src, err)
+	}
+	dst := filepath.Join(t.TempDir(), filepath.Base(src)+".gz")
+	f, err := os.Create(dst)
+	if err != nil {
+		t.Fatalf("Failed to create %s: %v", dst, err)
+	}
+	defer f.Close()
+	zw := gzip.NewWriter(f)
+	if _, err := zw.Write(data); err != nil {
+		t.Fatalf("Failed to compress: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("Failed to compress: %v", err)
+	}
+	return dst
+}
+
+func TestOpenGzippedBundle(t *testing.T) {
+	gzPath := gzipFile(t, createTestBundle(t, map[string]string{
+		"a.txt":     "alpha",
+		"dir/b.txt": "bravo",
+	}))
+
+	for _, opts := range [][]OpenOption{nil, {WithMmap()}, {WithReaderPool(2)}} {
+		ix, err := NewIxTar(gzPath, opts...)
+		if err != nil {
+			t.Fatalf("Failed to open gzipped bundle: %v", err)
+		}
+		tempPath := ix.tempPath
+		if tempPath == "" {
+			t.Fatal("Expected gzipped bundle to be decompressed to a temp file")
+		}
+		if ix.SupportsRandomAccess() {
+			t.Error("Expected no random access for a gzipped bundle")
+		}
+
+		data, err := ix.ExtractBytesOfFile("dir/b.txt")
+		if err != nil || string(data) != "bravo" {
+			t.Errorf("Unexpected content: %q, %v", data, err)
+		}
+
+		if err := ix.Close(); err != nil {
+			t.Errorf("Failed to close bundle: %v", err)
+		}
+		if _, err := os.Stat(tempPath); !os.IsNotExist(err) {
+			t.Errorf("Expected temp file to be removed on Close, got %v", err)
+		}
+	}
+}
+
+func TestOpenCorruptGzippedBundle(t *testing.T) {
+	gzPath := gzipFile(t, createTestBundle(t, map[string]string{"a.txt": "alpha"}))
+	data, err := os.ReadFile(gzPath)
+	if err != nil {
+		t.Fatalf("Failed to read: %v", err)
+	}
+	if err := os.WriteFile(gzPath, data[:len(data)/2], 0644); err != nil {
+		t.Fatalf("Failed to truncate: %v", err)
+	}
+
+	if ix, err := NewIxTar(gzPath); err == nil {
+		ix.Close()
+		t.Error("Expected error for truncated gzip bundle")
+	}
+}
+
+func TestOpenGzipBomb(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("TMPDIR", tempDir)
+
+	// A valid header followed by far more data than the limit
+	bundle, err := os.ReadFile(createTestBundle(t, map[string]string{"a.txt": "alpha"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gzPath := filepath.Join(t.TempDir(), "bomb.ixtar.gz")
+	f, err := os.Create(gzPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := gzip.NewWriter(f)
+	zw.Write(bundle)
+	zw.Write(make([]byte, 4<<20))
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	if ix, err := NewIxTar(gzPath, WithMaxDecompressedSize(1<<20)); err == nil {
+		ix.Close()
+		t.Error("Expected a bundle decompressing past the limit to be refused")
+	}
+	if left, _ := filepath.Glob(filepath.Join(tempDir, "ixtar-gunzip-*")); len(left) != 0 {
+		t.Errorf("Expected the temp file to be removed, got %v", left)
+	}
+	ix, err := NewIxTar(gzPath)
+	if err != nil {
+		t.Fatalf("Expected the default limit to allow it: %v", err)
+	}
+	ix.Close()
+
+	// Anything but a bundle fails before it is decompressed
+	notBundle := filepath.Join(t.TempDir(), "notes.txt")
+	if err := os.WriteFile(notBundle, []byte("just some text, long enough for a header"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewIxTar(gzipFile(t, notBundle)); !errors.Is(err, ErrNotABundle) {
+		t.Errorf("Expected ErrNotABundle, got %v", err)
+	}
+}
@@ -0,0 +1,230 @@
+package ixtar
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+// HashAlgorithm selects how paths are hashed into index keys. It is recorded
+// in the bundle header, so lookups use the algorithm the bundle was created
+// with.
+type HashAlgorithm uint8
+
+const (
+	// HashMD5 keys paths by the first 64 bits of their MD5 sum. It is the
+	// default and the only algorithm of bundles without a header.
+	HashMD5 HashAlgorithm = iota
+	// HashXXH64 keys paths by their xxHash64, which is several times faster
+	// to compute than MD5.
+	HashXXH64
+)
+
+func (a HashAlgorithm) String() string {
+	switch a {
+	case HashMD5:
+		return "md5"
+	case HashXXH64:
+		return "xxh64"
+	}
+	return fmt.Sprintf("HashAlgorithm(%d)", uint8(a))
+}
+
+// ParseHashAlgorithm returns the algorithm named by String, e.g. "xxh64".
+func ParseHashAlgorithm(name string) (HashAlgorithm, error) {
+	for _, a := range []HashAlgorithm{HashMD5, HashXXH64} {
+		if a.String() == name {
+			return a, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown hash algorithm %q", name)
+}
+
+// hasher returns the path hasher of a, or an error for algorithms this
+// version doesn't know.
+func (a HashAlgorithm) hasher() (pathHasher, error) {
+	switch a {
+	case HashMD5:
+		return md5Hasher{}, nil
+	case HashXXH64:
+		return xxh64Hasher{}, nil
+	}
+	return nil, fmt.Errorf("unsupported path hash algorithm %d", uint8(a))
+}
+
+// pathHasher computes the hex-encoded index key of a normalized path.
+type pathHasher interface {
+	hashKey(filePath string) [HashLen]byte
+}
+
+type md5Hasher struct{}
+
+func (md5Hasher) hashKey(filePath string) [HashLen]byte {
+	sum := md5.Sum([]byte(filePath))
+	var key [HashLen]byte
+	hex.Encode(key[:], sum[:HashLen/2])
+	return key
+}
+
+type xxh64Hasher struct{}
+
+func (xxh64Hasher) hashKey(filePath string) [HashLen]byte {
+	var sum [HashLen / 2]byte
+	binary.BigEndian.PutUint64(sum[:], xxhash.Sum64String(filePath))
+	var key [HashLen]byte
+	hex.Encode(key[:], sum[:])
+	return key
+}
+
+// backslashHasher hashes paths with their forward slashes turned into
+// backslashes, for bundles with flagBackslashKeys.
+type backslashHasher struct {
+	pathHasher
+}
+
+func (h backslashHasher) hashKey(filePath string) [HashLen]byte {
+	return h.pathHasher.hashKey(strings.ReplaceAll(filePath, "/", `\`))
+}
+
+// keyHasher returns the hasher of the index keys of a bundle with header h.
+func (h bundleHeader) keyHasher() (pathHasher, error) {
+	hasher, err := h.hashAlg.hasher()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBadFormat, err)
+	}
+	if h.flags&flagBackslashKeys != 0 {
+		return backslashHasher{hasher}, nil
+	}
+	return hasher, nil
+}
+
+// legacyBackslashKeys reports whether an index without flagBackslashKeys is
+// keyed by backslash-separated paths anyway, like bundles created on Windows
+// before the separator was fixed. Any stored path with a separator tells.
+func legacyBackslashKeys(h pathHasher, index DataIndex) bool {
+	for hash, fileIndex := range index.Files {
+		if strings.Contains(fileIndex.Path, "/") {
+			return hash != hashFilePath(h, fileIndex.Path) && hash == hashFilePath(backslashHasher{h}, fileIndex.Path)
+		}
+	}
+	return false
+}
+
+// hashFilePath returns the index key of filePath as a string.
+func hashFilePath(h pathHasher, filePath string) string {
+	key := h.hashKey(filePath)
+	return string(key[:])
+}
+
+// pathKey returns the index key of a path.
+func pathKey(h pathHasher, filePath string) string {
+	return hashFilePath(h, normalizePath(filePath))
+}
+
+// Keyer computes the index key of a file from its path, for bundles keyed by
+// something other than a path hash, such as a logical id. When a bundle is
+// created Key receives the stored, slash-separated path; lookups pass the
+// path given by the caller unchanged, so Key must do its own normalization.
+// Keys must be non-empty and unique within a bundle.
+//
+// ID identifies the keyer. It is stored in the bundle so that lookups are
+// only answered with the same keyer, given to NewIxTar with WithKeyer.
+type Keyer interface {
+	ID() string
+	Key(filePath string) string
+}
+
+// HashKeyer returns the built-in keyer of a, which cleans the path and
+// hashes it. HashKeyer(HashMD5) is the default keying.
+func HashKeyer(a HashAlgorithm) Keyer {
+	return hashKeyer{a}
+}
+
+type hashKeyer struct {
+	alg HashAlgorithm
+}
+
+func (k hashKeyer) ID() string { return k.alg.String() }
+
+func (k hashKeyer) Key(filePath string) string {
+	h, err := k.alg.hasher()
+	if err != nil {
+		return ""
+	}
+	return pathKey(h, filePath)
+}
+
+// WithKeyer opens a bundle created with CreateOptions.Keyer. Lookups by
+// path in such a bundle fail without it; listing and extracting everything
+// work either way. Opening fails if k's ID differs from the bundle's keyer.
+func WithKeyer(k Keyer) OpenOption {
+	return func(c *openConfig) {
+		c.keyer = k
+	}
+}
+
+// createKeyer returns the hash algorithm and custom keyer CreateOptions ask
+// for. Built-in keyers given as Keyer are recorded in the header like
+// HashAlgorithm; others return a non-nil custom keyer.
+func createKeyer(opts CreateOptions) (HashAlgorithm, Keyer, error) {
+	if opts.Keyer == nil {
+		return opts.HashAlgorithm, nil, nil
+	}
+	if opts.HashAlgorithm != HashMD5 {
+		return 0, nil, fmt.Errorf("Keyer and HashAlgorithm are mutually exclusive")
+	}
+	if k, ok := opts.Keyer.(hashKeyer); ok {
+		return k.alg, nil, nil
+	}
+	id := opts.Keyer.ID()
+	if id == "" {
+		return 0, nil, fmt.Errorf("keyer has an empty ID")
+	}
+	if _, err := ParseHashAlgorithm(id); err == nil {
+		return 0, nil, fmt.Errorf("keyer ID %q is reserved for the built-in hash", id)
+	}
+	return HashMD5, opts.Keyer, nil
+}
+
+// resolveKeyer returns the hasher for a bundle's header and the keyer for
+// lookups in it, which is nil for bundles keyed by a built-in hash. A keyer
+// given with WithKeyer must match the bundle's.
+func resolveKeyer(header bundleHeader, info bundleInfo, index DataIndex, k Keyer) (pathHasher, Keyer, error) {
+	hasher, err := header.keyHasher()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	id := info.Keyer
+	if id == "" {
+		id = header.hashAlg.String()
+	}
+	if k != nil && k.ID() != id {
+		return nil, nil, fmt.Errorf("bundle is keyed by %q, not %q", id, k.ID())
+	}
+	if info.Keyer == "" {
+		if header.flags&flagBackslashKeys == 0 && legacyBackslashKeys(hasher, index) {
+			hasher = backslashHasher{hasher}
+		}
+		return hasher, nil, nil
+	}
+	return hasher, k, nil
+}
+
+// checkIndexKeys fails with ErrBadFormat if a key of an index keyed by a
+// built-in hash doesn't have the length of a hash.
+func checkIndexKeys(index DataIndex, info bundleInfo) error {
+	if info.Keyer != "" {
+		return nil
+	}
+	for hash := range index.Files {
+		if len(hash) != HashLen {
+			return fmt.Errorf("%w: index key %q is not a %d character hash", ErrBadFormat, hash, HashLen)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,308 @@
+package ixtar
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHashAlgorithmXXH64(t *testing.T) {
+	sourceDir := t.TempDir()
+	testFiles := map[string]string{"a.txt": "alpha", "dir/b.txt": "beta"}
+	for name, content := range testFiles {
+		path := filepath.Join(sourceDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	bundlePath := filepath.Join(t.TempDir(), "xxh.ixtar")
+	if _, err := CreateBundleWithOptions(sourceDir, bundlePath, CreateOptions{HashAlgorithm: HashXXH64}); err != nil {
+		t.Fatalf("Failed to create bundle: %v", err)
+	}
+
+	ix, err := NewIxTar(bundlePath)
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	if ix.HashAlgorithm() != HashXXH64 {
+		t.Errorf("Expected xxh64, got %v", ix.HashAlgorithm())
+	}
+	for name, content := range testFiles {
+		got, err := ix.ExtractBytesOfFile(name)
+		if err != nil || string(got) != content {
+			t.Errorf("%s: expected %q, got %q (%v)", name, content, got, err)
+		}
+		stat, err := ix.Stat(name)
+		if err != nil || stat.Hash != hashFilePath(xxh64Hasher{}, name) {
+			t.Errorf("%s: expected xxh64 key, got %q (%v)", name, stat.Hash, err)
+		}
+	}
+	ix.Close()
+
+	if _, err := LookupStreaming(bundlePath, "dir/b.txt"); err != nil {
+		t.Errorf("LookupStreaming failed: %v", err)
+	}
+
+	// An algorithm from a newer version is rejected
+	data, err := os.ReadFile(bundlePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[5] = 0xff
+	if err := os.WriteFile(bundlePath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewIxTar(bundlePath); !errors.Is(err, ErrBadFormat) {
+		t.Errorf("Expected ErrBadFormat for an unknown hash algorithm, got %v", err)
+	}
+}
+
+func TestParseHashAlgorithm(t *testing.T) {
+	for _, a := range []HashAlgorithm{HashMD5, HashXXH64} {
+		if got, err := ParseHashAlgorithm(a.String()); err != nil || got != a {
+			t.Errorf("ParseHashAlgorithm(%q) = %v, %v", a.String(), got, err)
+		}
+	}
+	if _, err := ParseHashAlgorithm("sha1"); err == nil {
+		t.Error("Expected error for an unknown algorithm")
+	}
+}
+
+func BenchmarkPathHash(b *testing.B) {
+	paths := make([]string, 1024)
+	for i := range paths {
+		paths[i] = fmt.Sprintf("src/module%d/internal/package/file%d.go", i%37, i)
+	}
+
+	for _, a := range []HashAlgorithm{HashMD5, HashXXH64} {
+		h, _ := a.hasher()
+		b.Run(a.String(), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				h.hashKey(paths[i%len(paths)])
+			}
+		})
+	}
+}
+
+// idKeyer keys files by their base name without extension, like a logical
+// id.
+type idKeyer struct{}
+
+func (idKeyer) ID() string { return "basename" }
+
+func (idKeyer) Key(filePath string) string {
+	base := filepath.Base(filePath)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+func TestCustomKeyer(t *testing.T) {
+	sourceDir := t.TempDir()
+	testFiles := map[string]string{"a/one.txt": "first", "b/two.txt": "second"}
+	for name, content := range testFiles {
+		path := filepath.Join(sourceDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	bundlePath := filepath.Join(t.TempDir(), "keyed.ixtar")
+	if _, err := CreateBundleWithOptions(sourceDir, bundlePath, CreateOptions{Keyer: idKeyer{}}); err != nil {
+		t.Fatalf("Failed to create bundle: %v", err)
+	}
+
+	ix, err := NewIxTar(bundlePath, WithKeyer(idKeyer{}))
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	if got, err := ix.ExtractBytesOfFile("two"); err != nil || string(got) != "second" {
+		t.Errorf("Expected lookup by id, got %q (%v)", got, err)
+	}
+	if stat, err := ix.Stat("one"); err != nil || stat.Path != "a/one.txt" || stat.Hash != "one" {
+		t.Errorf("Unexpected stat: %+v (%v)", stat, err)
+	}
+	if ix.KeyerID() != "basename" {
+		t.Errorf("Expected keyer ID basename, got %q", ix.KeyerID())
+	}
+	ix.Close()
+
+	// Without the keyer the bundle opens, but lookups by path fail
+	ix, err = NewIxTar(bundlePath)
+	if err != nil {
+		t.Fatalf("Failed to open bundle without keyer: %v", err)
+	}
+	if _, err := ix.ExtractBytesOfFile("one"); err == nil {
+		t.Error("Expected lookup without keyer to fail")
+	}
+	if err := ix.VerifyAll(); err != nil {
+		t.Errorf("VerifyAll failed: %v", err)
+	}
+	ix.Close()
+
+	if _, err := NewIxTar(bundlePath, WithKeyer(HashKeyer(HashMD5))); err == nil {
+		t.Error("Expected error opening with a different keyer")
+	}
+	if _, err := LookupStreaming(bundlePath, "one"); err == nil {
+		t.Error("Expected LookupStreaming to refuse a custom-keyed bundle")
+	}
+	if _, err := NewIxTar(bundlePath, WithKeyer(idKeyer{}), WithLowMemoryIndex()); err == nil {
+		t.Error("Expected WithLowMemoryIndex to refuse a custom-keyed bundle")
+	}
+
+	// Keys must be unique
+	if err := os.WriteFile(filepath.Join(sourceDir, "a", "two.md"), []byte("dup"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CreateBundleWithOptions(sourceDir, bundlePath, CreateOptions{Keyer: idKeyer{}}); err == nil {
+		t.Error("Expected error for duplicate keys")
+	}
+}
+
+func TestHashKeyer(t *testing.T) {
+	bundlePath := filepath.Join(t.TempDir(), "xxh.ixtar")
+	sourceDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(sourceDir, "a.txt"), []byte("alpha"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CreateBundleWithOptions(sourceDir, bundlePath, CreateOptions{Keyer: HashKeyer(HashXXH64)}); err != nil {
+		t.Fatalf("Failed to create bundle: %v", err)
+	}
+
+	ix, err := NewIxTar(bundlePath, WithKeyer(HashKeyer(HashXXH64)))
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	defer ix.Close()
+	if ix.HashAlgorithm() != HashXXH64 {
+		t.Errorf("Expected built-in keyer to be stored as the hash algorithm, got %v", ix.HashAlgorithm())
+	}
+	if got, err := ix.ExtractBytesOfFile("./a.txt"); err != nil || string(got) != "alpha" {
+		t.Errorf("Expected %q, got %q (%v)", "alpha", got, err)
+	}
+	if key := HashKeyer(HashMD5).Key("dir//a.txt"); key != hashFilePath(md5Hasher{}, "dir/a.txt") {
+		t.Errorf("Expected the default keyer to clean and hash paths, got %q", key)
+	}
+}
+
+func TestPathSeparator(t *testing.T) {
+	// Paths given with Windows separators are keyed like forward slash paths
+	osSeparator = '\\'
+	t.Cleanup(func() { osSeparator = filepath.Separator })
+	b, err := NewBuilder()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	if err := b.AddBytes(`sub\c.txt`, []byte("nested")); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.AddBytes(`.\dir\\d.txt`, []byte("deep")); err != nil {
+		t.Fatal(err)
+	}
+	winPath := filepath.Join(t.TempDir(), "windows.ixtar")
+	if err := b.WriteFile(winPath); err != nil {
+		t.Fatal(err)
+	}
+	ix, err := NewIxTar(winPath)
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	defer ix.Close()
+	if got, err := ix.ExtractBytesOfFile(`sub\c.txt`); err != nil || string(got) != "nested" {
+		t.Errorf(`sub\c.txt: got %q (%v)`, got, err)
+	}
+	osSeparator = '/'
+
+	if _, ok := ix.index.Files[hashFilePath(md5Hasher{}, "sub/c.txt")]; !ok {
+		t.Error("Expected sub/c.txt to be keyed by its forward slash path")
+	}
+	for name, content := range map[string]string{"sub/c.txt": "nested", "dir/d.txt": "deep"} {
+		if got, err := ix.ExtractBytesOfFile(name); err != nil || string(got) != content {
+			t.Errorf("%s: got %q (%v)", name, got, err)
+		}
+	}
+
+	// Backslash keys are recorded in the header and used by lookups
+	sourceDir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(sourceDir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(sourceDir, "sub", "c.txt"), []byte("nested"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	bundlePath := filepath.Join(t.TempDir(), "backslash.ixtar")
+	if _, err := CreateBundleWithOptions(sourceDir, bundlePath, CreateOptions{PathSeparator: '\\'}); err != nil {
+		t.Fatalf("Failed to create bundle: %v", err)
+	}
+	bix, err := NewIxTar(bundlePath)
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	defer bix.Close()
+	if _, ok := bix.index.Files[hashFilePath(md5Hasher{}, `sub\c.txt`)]; !ok {
+		t.Error(`Expected sub/c.txt to be keyed by sub\c.txt`)
+	}
+	if got, err := bix.ExtractBytesOfFile("sub/c.txt"); err != nil || string(got) != "nested" {
+		t.Errorf("sub/c.txt: got %q (%v)", got, err)
+	}
+	if fileIndex, err := LookupStreaming(bundlePath, "sub/c.txt"); err != nil || fileIndex.Path != "sub/c.txt" {
+		t.Errorf("LookupStreaming: got %+v (%v)", fileIndex, err)
+	}
+
+	for _, sep := range []rune{':', '\\'} {
+		opts := CreateOptions{PathSeparator: sep}
+		if sep == '\\' {
+			opts.Keyer = idKeyer{}
+		}
+		if _, err := CreateBundleWithOptions(sourceDir, filepath.Join(t.TempDir(), "bad.ixtar"), opts); err == nil {
+			t.Errorf("Expected error for %+v", opts)
+		}
+	}
+}
+
+func TestLegacyBackslashKeys(t *testing.T) {
+	// Created on Windows before the separator was recorded: backslash
+	// keys, forward slash paths and no flag
+	var index bytes.Buffer
+	w := csv.NewWriter(&index)
+	for _, name := range []string{"a.txt", "sub/c.txt"} {
+		if err := writeCSVRecord(w, hashFilePath(md5Hasher{}, strings.ReplaceAll(name, "/", `\`)), FileIndex{Size: 5, Path: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w.Flush()
+	bundlePath := writeRawBundle(t, index.String(), "alpha")
+
+	ix, err := NewIxTar(bundlePath)
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	defer ix.Close()
+	for _, name := range []string{"a.txt", "sub/c.txt", "./sub//c.txt"} {
+		if got, err := ix.ExtractBytesOfFile(name); err != nil || string(got) != "alpha" {
+			t.Errorf("%s: got %q (%v)", name, got, err)
+		}
+		if _, err := LookupStreaming(bundlePath, name); err != nil {
+			t.Errorf("LookupStreaming %s: %v", name, err)
+		}
+	}
+
+	low, err := NewIxTar(bundlePath, WithLowMemoryIndex())
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	defer low.Close()
+	if got, err := low.ExtractBytesOfFile("sub/c.txt"); err != nil || string(got) != "alpha" {
+		t.Errorf("low memory index: got %q (%v)", got, err)
+	}
+}
@@ -0,0 +1,293 @@
+package ixtar
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"log/slog"
+	"mime"
+	"strings"
+)
+
+// Version is the ixtar version recorded in bundles created by this package.
+const Version = "0.2.0"
+
+// headerSize is the size of the fixed bundle header. The header layout is
+//
+//	[0:4]   magic "IXTR"
+//	[4]     format version
+//	[5]     path hash algorithm
+//	[6:8]   flags
+//	[8:16]  creation time (unix nanoseconds)
+//	[16:20] info block size
+//	[20:24] CRC32 of header, CSV index and info block, with flagIndexCRC
+//	[24:32] CSV size
+//
+// Bundles written before the magic existed have zeros in bytes 0-23 and
+// carry only the CSV size.
+const headerSize = 32
+
+// formatVersion is the major format version. Readers fail on bundles with
+// a newer one. formatMinor, recorded in the info block, counts additions
+// that older readers can ignore, such as optional CSV columns, info fields
+// and flags in ignorableFlags; readers open bundles with a newer minor
+// version and skip what they don't know.
+const (
+	formatVersion = 1
+	formatMinor   = 0
+)
+
+var headerMagic = [4]byte{'I', 'X', 'T', 'R'}
+
+// flagTrailer marks bundles that end with a trailer: a copy of the CSV index
+// followed by a footer laid out as
+//
+//	[0:4]   magic "IXTI"
+//	[4:8]   reserved
+//	[8:16]  CSV size
+const flagTrailer uint16 = 1 << 0
+
+// flagIndexCRC marks bundles whose header holds a CRC32 over the header,
+// with the CRC32 field zeroed, the CSV index and the info block. Bundles
+// without it are not checked.
+const flagIndexCRC uint16 = 1 << 1
+
+// flagBackslashKeys marks bundles whose index keys are hashed from paths
+// separated by backslashes rather than forward slashes, created with
+// CreateOptions.PathSeparator '\\'. Stored paths use forward slashes either
+// way.
+const flagBackslashKeys uint16 = 1 << 2
+
+// flagEncrypted marks bundles created with CreateOptions.Encryption, whose
+// info block describes the cipher. Readers that don't know it would return
+// encrypted files as they are stored.
+const flagEncrypted uint16 = 1 << 3
+
+// flagEncryptedIndex marks bundles created with Encryption.Index, whose CSV
+// index region holds a nonce followed by the AES-GCM sealed index. The
+// trailer copy of the index is sealed the same way. It is only set along
+// with flagEncrypted.
+const flagEncryptedIndex uint16 = 1 << 4
+
+// knownFlags are the flags this version understands.
+const knownFlags = flagTrailer | flagIndexCRC | flagBackslashKeys | flagEncrypted | flagEncryptedIndex
+
+// ignorableFlags are reserved for features that readers which don't know
+// them can ignore. An unknown flag outside them changes how the bundle must
+// be read, so opening fails.
+const ignorableFlags uint16 = 0xff00
+
+const trailerFooterSize = 16
+
+var trailerMagic = [4]byte{'I', 'X', 'T', 'I'}
+
+func marshalTrailerFooter(csvSize int64) [trailerFooterSize]byte {
+	var b [trailerFooterSize]byte
+	copy(b[0:4], trailerMagic[:])
+	binary.BigEndian.PutUint64(b[8:16], uint64(csvSize))
+	return b
+}
+
+// readTrailerFooter checks the trailer footer at the end of a bundle of size
+// bytes against its header and returns the size of the whole trailer.
+func readTrailerFooter(r io.ReaderAt, size int64, h bundleHeader) (int64, error) {
+	if size < headerSize+trailerFooterSize {
+		return 0, fmt.Errorf("%w: bundle too small for trailer", ErrBadFormat)
+	}
+	var b [trailerFooterSize]byte
+	if _, err := r.ReadAt(b[:], size-trailerFooterSize); err != nil {
+		return 0, fmt.Errorf("failed to read trailer footer: %w", err)
+	}
+	if [4]byte(b[0:4]) != trailerMagic {
+		return 0, fmt.Errorf("%w: missing trailer footer", ErrBadFormat)
+	}
+	if csvSize := int64(binary.BigEndian.Uint64(b[8:16])); csvSize != h.csvSize {
+		return 0, fmt.Errorf("%w: trailer CSV size %d does not match header CSV size %d", ErrBadFormat, csvSize, h.csvSize)
+	}
+	return h.csvSize + trailerFooterSize, nil
+}
+
+type bundleHeader struct {
+	version  uint8
+	hashAlg  HashAlgorithm
+	flags    uint16
+	created  int64
+	infoSize uint32
+	indexCRC uint32
+	csvSize  int64
+}
+
+func (h bundleHeader) marshal() [headerSize]byte {
+	var b [headerSize]byte
+	copy(b[0:4], headerMagic[:])
+	b[4] = h.version
+	b[5] = byte(h.hashAlg)
+	binary.BigEndian.PutUint16(b[6:8], h.flags)
+	binary.BigEndian.PutUint64(b[8:16], uint64(h.created))
+	binary.BigEndian.PutUint32(b[16:20], h.infoSize)
+	binary.BigEndian.PutUint32(b[20:24], h.indexCRC)
+	binary.BigEndian.PutUint64(b[24:32], uint64(h.csvSize))
+	return b
+}
+
+// indexSum returns a CRC32 that has been fed the header with the CRC32
+// field zeroed. Feeding it the CSV index and the info block gives the
+// checksum of flagIndexCRC.
+func (h bundleHeader) indexSum() hash.Hash32 {
+	h.indexCRC = 0
+	b := h.marshal()
+	sum := crc32.NewIEEE()
+	sum.Write(b[:])
+	return sum
+}
+
+// checkIndexCRC fails with ErrBadFormat if the bundle has flagIndexCRC and
+// its header, CSV index and info block don't match the stored checksum.
+func (h bundleHeader) checkIndexCRC(csvData, infoData []byte) error {
+	return h.checkIndexCRCFrom(bytes.NewReader(csvData), infoData)
+}
+
+// checkIndexCRCFrom is checkIndexCRC with the CSV index read from csvData.
+func (h bundleHeader) checkIndexCRCFrom(csvData io.Reader, infoData []byte) error {
+	if h.flags&flagIndexCRC == 0 {
+		return nil
+	}
+	sum := h.indexSum()
+	if _, err := io.Copy(sum, csvData); err != nil {
+		return fmt.Errorf("failed to read CSV data: %w", err)
+	}
+	sum.Write(infoData)
+	if got := sum.Sum32(); got != h.indexCRC {
+		return fmt.Errorf("%w: header and index checksum mismatch: expected %08x, got %08x", ErrBadFormat, h.indexCRC, got)
+	}
+	return nil
+}
+
+// readHeader reads and parses the header at the start of r. A file too
+// short to hold it fails with ErrNotABundle.
+func readHeader(r io.Reader) (bundleHeader, error) {
+	var b [headerSize]byte
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return bundleHeader{}, fmt.Errorf("%w: file is shorter than the %d byte header", ErrNotABundle, headerSize)
+		}
+		return bundleHeader{}, fmt.Errorf("failed to read bundle header: %w", err)
+	}
+	return parseHeader(b)
+}
+
+func parseHeader(b [headerSize]byte) (bundleHeader, error) {
+	h := bundleHeader{csvSize: int64(binary.BigEndian.Uint64(b[24:32]))}
+
+	if [4]byte(b[0:4]) != headerMagic {
+		for _, c := range b[:24] {
+			if c != 0 {
+				return bundleHeader{}, fmt.Errorf("%w: the file doesn't start with the %q magic", ErrNotABundle, headerMagic[:])
+			}
+		}
+		return h, nil
+	}
+
+	h.version = b[4]
+	h.hashAlg = HashAlgorithm(b[5])
+	h.flags = binary.BigEndian.Uint16(b[6:8])
+	h.created = int64(binary.BigEndian.Uint64(b[8:16]))
+	h.infoSize = binary.BigEndian.Uint32(b[16:20])
+	h.indexCRC = binary.BigEndian.Uint32(b[20:24])
+
+	if h.version > formatVersion {
+		return bundleHeader{}, fmt.Errorf("%w: format version %d is newer than %d, the latest this version of ixtar reads", ErrUnsupportedVersion, h.version, formatVersion)
+	}
+	if unknown := h.flags &^ knownFlags &^ ignorableFlags; unknown != 0 {
+		return bundleHeader{}, fmt.Errorf("%w: bundle requires unknown features (flags %04x)", ErrUnsupportedVersion, unknown)
+	}
+	return h, nil
+}
+
+// checkSize verifies that the sections described by the header fit in a
+// bundle of fileSize bytes, so a corrupt size field fails before the CSV
+// buffer is allocated.
+func (h bundleHeader) checkSize(fileSize int64) error {
+	avail := fileSize - headerSize
+	if h.csvSize < 0 || h.csvSize > avail {
+		return fmt.Errorf("%w: CSV size %d exceeds bundle size %d", ErrBadFormat, h.csvSize, fileSize)
+	}
+	if int64(h.infoSize) > avail-h.csvSize {
+		return fmt.Errorf("%w: info block size %d exceeds bundle size %d", ErrBadFormat, h.infoSize, fileSize)
+	}
+	return nil
+}
+
+// bundleInfo is the JSON block stored between the CSV index and the data.
+type bundleInfo struct {
+	Creator      string            `json:"creator,omitempty"`
+	Metadata     map[string]string `json:"metadata,omitempty"`
+	ContentTypes map[string]string `json:"content_types,omitempty"`
+	Keyer        string            `json:"keyer,omitempty"` // ID of a custom Keyer
+	Entries      *entryCounts      `json:"entries,omitempty"`
+	FormatMinor  int               `json:"format_minor,omitempty"`
+	Encryption   *encryptionInfo   `json:"encryption,omitempty"`
+}
+
+// warnNewerMinor logs a warning if a bundle was written with a newer minor
+// format version than this package writes.
+func (info bundleInfo) warnNewerMinor(logger *slog.Logger, header bundleHeader) {
+	if info.FormatMinor > formatMinor {
+		logger.Warn("bundle has a newer format version, data this version doesn't know is ignored",
+			"version", fmt.Sprintf("%d.%d", header.version, info.FormatMinor),
+			"supported", fmt.Sprintf("%d.%d", formatVersion, formatMinor))
+	}
+}
+
+// entryCounts counts the entries of the source tree that aren't stored as
+// files, recorded by create.
+type entryCounts struct {
+	Directories int `json:"directories"`
+	Symlinks    int `json:"symlinks"`
+	Other       int `json:"other"` // Devices, FIFOs and sockets
+}
+
+// encodeBundleInfo validates info and encodes it for the info block.
+// Content type extensions are lower-cased and given a leading dot, and the
+// minor format version is the one this package writes.
+func encodeBundleInfo(info bundleInfo) ([]byte, error) {
+	info.FormatMinor = formatMinor
+	if info.ContentTypes != nil {
+		contentTypes := make(map[string]string, len(info.ContentTypes))
+		for ext, ctype := range info.ContentTypes {
+			if _, _, err := mime.ParseMediaType(ctype); err != nil {
+				return nil, fmt.Errorf("invalid content type %q for %s: %w", ctype, ext, err)
+			}
+			ext = strings.ToLower(ext)
+			if !strings.HasPrefix(ext, ".") {
+				ext = "." + ext
+			}
+			contentTypes[ext] = ctype
+		}
+		info.ContentTypes = contentTypes
+	}
+
+	infoData, err := json.Marshal(info)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode bundle info: %w", err)
+	}
+	if len(infoData) > maxMetadataSize {
+		return nil, fmt.Errorf("bundle metadata too large: %d bytes, limit %d", len(infoData), maxMetadataSize)
+	}
+	return infoData, nil
+}
+
+func parseBundleInfo(data []byte) (bundleInfo, error) {
+	var info bundleInfo
+	if len(data) == 0 {
+		return info, nil
+	}
+	if err := json.Unmarshal(data, &info); err != nil {
+		return bundleInfo{}, fmt.Errorf("invalid bundle info: %w", err)
+	}
+	return info, nil
+}
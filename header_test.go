@@ -0,0 +1,320 @@
+package ixtar
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCreationInfo(t *testing.T) {
+	before := time.Now()
+	bundlePath := createTestBundle(t, map[string]string{"a.txt": "alpha"})
+	after := time.Now()
+
+	ix, err := NewIxTar(bundlePath)
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	defer ix.Close()
+
+	createdAt := ix.CreatedAt()
+	if createdAt.Before(before) || createdAt.After(after) {
+		t.Errorf("CreatedAt %v not between %v and %v", createdAt, before, after)
+	}
+	if ix.CreatorVersion() != "ixtar "+Version {
+		t.Errorf("Unexpected creator version %q", ix.CreatorVersion())
+	}
+	if major, minor := ix.Version(); major != formatVersion || minor != formatMinor {
+		t.Errorf("Unexpected format version %d.%d", major, minor)
+	}
+
+	data, err := ix.ExtractBytesOfFile("a.txt")
+	if err != nil || string(data) != "alpha" {
+		t.Errorf("Failed to extract file after header change: %q, %v", data, err)
+	}
+}
+
+func TestLegacyHeaderHasNoCreationInfo(t *testing.T) {
+	bundlePath := writeRawBundle(t, "0123456789abcdef,0,5\n", "hello")
+
+	ix, err := NewIxTar(bundlePath)
+	if err != nil {
+		t.Fatalf("Failed to open legacy bundle: %v", err)
+	}
+	defer ix.Close()
+
+	if !ix.CreatedAt().IsZero() {
+		t.Errorf("Expected zero CreatedAt, got %v", ix.CreatedAt())
+	}
+	if ix.CreatorVersion() != "" {
+		t.Errorf("Expected empty creator version, got %q", ix.CreatorVersion())
+	}
+	if major, minor := ix.Version(); major != 0 || minor != 0 {
+		t.Errorf("Expected format version 0.0, got %d.%d", major, minor)
+	}
+}
+
+func TestBundleMetadata(t *testing.T) {
+	srcDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("alpha"), 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	bundlePath := filepath.Join(t.TempDir(), "meta.ixtar")
+	metadata := map[string]string{"commit": "abc123", "env": "prod"}
+	result, err := CreateBundleWithOptions(srcDir, bundlePath, CreateOptions{Metadata: metadata})
+	if err != nil {
+		t.Fatalf("Failed to create bundle: %v", err)
+	}
+	if result.Files != 1 || result.Bytes != 5 {
+		t.Errorf("Unexpected create result: %+v", result)
+	}
+
+	ix, err := NewIxTar(bundlePath)
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	defer ix.Close()
+
+	if got := ix.Metadata(); !reflect.DeepEqual(got, metadata) {
+		t.Errorf("Expected metadata %v, got %v", metadata, got)
+	}
+
+	tooLarge := map[string]string{"blob": strings.Repeat("x", maxMetadataSize)}
+	if _, err := CreateBundleWithOptions(srcDir, bundlePath, CreateOptions{Metadata: tooLarge}); err == nil {
+		t.Error("Expected error for oversized metadata")
+	}
+}
+
+func TestLayout(t *testing.T) {
+	bundlePath := createTestBundle(t, map[string]string{"a.txt": "alpha", "b.txt": "bravo"})
+
+	ix, err := NewIxTar(bundlePath)
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	defer ix.Close()
+
+	stat, err := os.Stat(bundlePath)
+	if err != nil {
+		t.Fatalf("Failed to stat bundle: %v", err)
+	}
+
+	layout := ix.Layout()
+	if layout.TotalSize != stat.Size() {
+		t.Errorf("Expected total size %d, got %d", stat.Size(), layout.TotalSize)
+	}
+	if layout.CSVOffset != layout.HeaderSize || layout.InfoOffset != layout.CSVOffset+layout.CSVSize {
+		t.Errorf("Sections are not contiguous: %+v", layout)
+	}
+	if layout.DataOffset != layout.InfoOffset+layout.InfoSize {
+		t.Errorf("Data does not follow info block: %+v", layout)
+	}
+	if layout.DataSize != 10 || layout.DataOffset+layout.DataSize != layout.TotalSize {
+		t.Errorf("Unexpected data section: %+v", layout)
+	}
+}
+
+func TestInflatedSizeFields(t *testing.T) {
+	tests := []struct {
+		name  string
+		patch func(b []byte)
+	}{
+		{"csv size", func(b []byte) { binary.BigEndian.PutUint64(b[24:32], 1<<40) }},
+		{"negative csv size", func(b []byte) { binary.BigEndian.PutUint64(b[24:32], 1<<63) }},
+		{"info size", func(b []byte) { binary.BigEndian.PutUint32(b[16:20], 1<<30) }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bundlePath := createTestBundle(t, map[string]string{"a.txt": "alpha"})
+			data, err := os.ReadFile(bundlePath)
+			if err != nil {
+				t.Fatalf("Failed to read bundle: %v", err)
+			}
+			tt.patch(data)
+			if err := os.WriteFile(bundlePath, data, 0644); err != nil {
+				t.Fatalf("Failed to write bundle: %v", err)
+			}
+
+			ix, err := NewIxTar(bundlePath)
+			if err == nil {
+				ix.Close()
+				t.Fatal("Expected error for inflated size field")
+			}
+			if !errors.Is(err, ErrBadFormat) {
+				t.Errorf("Expected ErrBadFormat, got %v", err)
+			}
+		})
+	}
+}
+
+func TestDataReader(t *testing.T) {
+	bundlePath := createTestBundle(t, map[string]string{"a.txt": "alpha", "b.txt": "bravo"})
+
+	ix, err := NewIxTar(bundlePath)
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	defer ix.Close()
+
+	data, err := io.ReadAll(ix.DataReader())
+	if err != nil {
+		t.Fatalf("Failed to read data region: %v", err)
+	}
+	for _, entry := range ix.Entries() {
+		content, err := ix.ExtractBytesOfFile(entry.Path)
+		if err != nil {
+			t.Fatalf("Failed to extract %s: %v", entry.Path, err)
+		}
+		if got := string(data[entry.Start : entry.Start+entry.Size]); got != string(content) {
+			t.Errorf("%s: expected %q in data region, got %q", entry.Path, content, got)
+		}
+	}
+}
+
+func TestIndexCRC(t *testing.T) {
+	bundlePath := createTestBundle(t, map[string]string{"a.txt": "alpha", "b.txt": "bravo"})
+	original, err := os.ReadFile(bundlePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if flags := binary.BigEndian.Uint16(original[6:8]); flags&flagIndexCRC == 0 {
+		t.Fatalf("Expected new bundles to have flagIndexCRC, got flags %04x", flags)
+	}
+	csvSize := int64(binary.BigEndian.Uint64(original[24:32]))
+
+	for name, offset := range map[string]int64{
+		"header": 12,
+		"csv":    headerSize + 3,
+		"info":   headerSize + csvSize + 1,
+	} {
+		corrupt := append([]byte(nil), original...)
+		corrupt[offset] ^= 0x01
+		if err := os.WriteFile(bundlePath, corrupt, 0644); err != nil {
+			t.Fatal(err)
+		}
+		_, err := NewIxTar(bundlePath)
+		if !errors.Is(err, ErrBadFormat) || !strings.Contains(err.Error(), "checksum") {
+			t.Errorf("Corrupt %s: expected a checksum error, got %v", name, err)
+		}
+	}
+
+	// Bundles without the flag aren't checked
+	corrupt := append([]byte(nil), original...)
+	binary.BigEndian.PutUint16(corrupt[6:8], 0)
+	corrupt[12] ^= 0x01
+	if err := os.WriteFile(bundlePath, corrupt, 0644); err != nil {
+		t.Fatal(err)
+	}
+	ix, err := NewIxTar(bundlePath)
+	if err != nil {
+		t.Fatalf("Expected a bundle without flagIndexCRC to open, got %v", err)
+	}
+	ix.Close()
+}
+
+func TestNewerMinorVersion(t *testing.T) {
+	// Written by a future minor version: an extra CSV column, an unknown
+	// info field and a flag this version doesn't know but may ignore
+	csvData := fmt.Sprintf("%s,0,5,a.txt,crc32=%s,future-column\n",
+		hashFilePath(md5Hasher{}, "a.txt"), formatCRC32(crc32.ChecksumIEEE([]byte("alpha"))))
+	infoData := []byte(`{"creator":"ixtar 9.9.0","format_minor":3,"future":{"x":1}}`)
+	var bundle bytes.Buffer
+	header := bundleHeader{flags: 1 << 9, csvSize: int64(len(csvData))}
+	if err := writeBundle(&bundle, header, strings.NewReader(csvData), infoData, strings.NewReader("alpha")); err != nil {
+		t.Fatal(err)
+	}
+	bundlePath := filepath.Join(t.TempDir(), "future.ixtar")
+	if err := os.WriteFile(bundlePath, bundle.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var logs bytes.Buffer
+	for _, opts := range [][]OpenOption{
+		{WithVerifyOnRead()},
+		{WithLowMemoryIndex()},
+	} {
+		opts = append(opts, WithLogger(slog.New(slog.NewTextHandler(&logs, nil))))
+		ix, err := NewIxTar(bundlePath, opts...)
+		if err != nil {
+			t.Fatalf("Failed to open a newer minor version: %v", err)
+		}
+		if major, minor := ix.Version(); major != formatVersion || minor != 3 {
+			t.Errorf("Expected format version %d.3, got %d.%d", formatVersion, major, minor)
+		}
+		if got, err := ix.ExtractBytesOfFile("a.txt"); err != nil || string(got) != "alpha" {
+			t.Errorf("a.txt: got %q (%v)", got, err)
+		}
+		ix.Close()
+	}
+	if !strings.Contains(logs.String(), "newer format version") {
+		t.Errorf("Expected a warning about the newer version, got %q", logs.String())
+	}
+	if _, err := LookupStreaming(bundlePath, "a.txt"); err != nil {
+		t.Errorf("LookupStreaming failed: %v", err)
+	}
+
+	// A newer major version or an unknown required flag is refused
+	for name, change := range map[string]func(b []byte){
+		"major": func(b []byte) { b[4] = formatVersion + 1 },
+		"flag":  func(b []byte) { b[7] |= 1 << 5 },
+	} {
+		changed := append([]byte(nil), bundle.Bytes()...)
+		change(changed)
+		if err := os.WriteFile(bundlePath, changed, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := NewIxTar(bundlePath); !errors.Is(err, ErrUnsupportedVersion) {
+			t.Errorf("%s: expected ErrUnsupportedVersion, got %v", name, err)
+		}
+	}
+}
+
+func TestNotABundle(t *testing.T) {
+	var tarData bytes.Buffer
+	tw := tar.NewWriter(&tarData)
+	if err := tw.WriteHeader(&tar.Header{Name: "a.txt", Mode: 0644, Size: 5}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write([]byte("alpha")); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	for name, content := range map[string][]byte{
+		"archive.tar": tarData.Bytes(),
+		"notes.txt":   []byte(strings.Repeat("just some text\n", 10)),
+		"short.bin":   []byte("IXTR"),
+		"empty":       nil,
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, content, 0644); err != nil {
+			t.Fatal(err)
+		}
+		_, err := NewIxTar(path)
+		if !errors.Is(err, ErrNotABundle) || !strings.Contains(err.Error(), "not an ixtar bundle") {
+			t.Errorf("%s: expected ErrNotABundle, got %v", name, err)
+		}
+		if _, err := NewIxTarFromStream(bytes.NewReader(content)); !errors.Is(err, ErrNotABundle) {
+			t.Errorf("%s: expected ErrNotABundle from a stream, got %v", name, err)
+		}
+		if _, err := LookupStreaming(path, "a.txt"); !errors.Is(err, ErrNotABundle) {
+			t.Errorf("%s: expected ErrNotABundle from LookupStreaming, got %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package ixtar
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// IgnoreFileName is the ignore file CreateBundleWithOptions reads from the
+// root of the source directory when CreateOptions.IgnoreFile is empty.
+const IgnoreFileName = ".ixtarignore"
+
+// ignoreRule is one pattern of an ignore file.
+type ignoreRule struct {
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// ignoreMatcher decides which paths an ignore file excludes, following
+// .gitignore rules: blank lines and lines starting with # are skipped, !
+// re-includes, a trailing / only matches directories, patterns containing a
+// / are anchored to the source root and others match at any depth, * and ?
+// don't match /, and ** matches across directories. The last matching rule
+// wins. Nested ignore files are not supported.
+type ignoreMatcher struct {
+	rules []ignoreRule
+}
+
+func loadIgnoreFile(path string) (*ignoreMatcher, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	m, err := parseIgnore(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse ignore file %s: %w", path, err)
+	}
+	return m, nil
+}
+
+func parseIgnore(r io.Reader) (*ignoreMatcher, error) {
+	m := &ignoreMatcher{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var rule ignoreRule
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		} else if strings.HasPrefix(line, `\#`) || strings.HasPrefix(line, `\!`) {
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+
+		anchored := strings.Contains(line, "/")
+		line = strings.TrimPrefix(line, "/")
+		expr := globToRegexp(line)
+		if anchored {
+			expr = "^" + expr + "$"
+		} else {
+			expr = "^(?:.*/)?" + expr + "$"
+		}
+
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", scanner.Text(), err)
+		}
+		rule.re = re
+		m.rules = append(m.rules, rule)
+	}
+	return m, scanner.Err()
+}
+
+// globToRegexp translates a gitignore glob to a regular expression.
+func globToRegexp(glob string) string {
+	var b strings.Builder
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(glob):
+			i++
+			b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return b.String()
+}
+
+// match reports whether relPath, slash-separated and relative to the source
+// root, is excluded.
+func (m *ignoreMatcher) match(relPath string, isDir bool) bool {
+	ignored := false
+	for _, rule := range m.rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		if rule.re.MatchString(relPath) {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
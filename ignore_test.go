@@ -0,0 +1,113 @@
+package ixtar
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestIgnoreMatcher(t *testing.T) {
+	m, err := parseIgnore(strings.NewReader(`
+# comment
+*.log
+/build
+node_modules/
+docs/**/*.tmp
+!keep.log
+\#literal
+file?.txt
+[ab].bin
+`))
+	if err != nil {
+		t.Fatalf("Failed to parse patterns: %v", err)
+	}
+
+	tests := []struct {
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{"app.log", false, true},
+		{"deep/dir/app.log", false, true},
+		{"keep.log", false, false},
+		{"sub/keep.log", false, false},
+		{"build", true, true},
+		{"sub/build", true, false},
+		{"node_modules", true, true},
+		{"sub/node_modules", true, true},
+		{"node_modules", false, false},
+		{"docs/a.tmp", false, true},
+		{"docs/x/y/a.tmp", false, true},
+		{"a.tmp", false, false},
+		{"#literal", false, true},
+		{"file1.txt", false, true},
+		{"file10.txt", false, false},
+		{"a.bin", false, true},
+		{"c.bin", false, false},
+		{"main.go", false, false},
+	}
+	for _, tt := range tests {
+		if got := m.match(tt.path, tt.isDir); got != tt.want {
+			t.Errorf("match(%q, %v) = %v, want %v", tt.path, tt.isDir, got, tt.want)
+		}
+	}
+}
+
+func TestCreateWithIgnoreFile(t *testing.T) {
+	srcDir := t.TempDir()
+	files := map[string]string{
+		".ixtarignore":        "*.log\ncache/\n",
+		"main.go":             "package main",
+		"debug.log":           "noise",
+		"cache/blob":          "cached",
+		"cache/nested/blob":   "cached",
+		"src/cache/more.blob": "cached",
+		"src/lib.go":          "package src",
+	}
+	for name, content := range files {
+		path := filepath.Join(srcDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	bundlePath := filepath.Join(t.TempDir(), "ignore.ixtar")
+
+	result, err := CreateBundleWithOptions(srcDir, bundlePath, CreateOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create bundle: %v", err)
+	}
+	if result.SkippedIgnored != 3 {
+		t.Errorf("Expected 3 ignored entries, got %d", result.SkippedIgnored)
+	}
+
+	ix, err := NewIxTar(bundlePath)
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	defer ix.Close()
+	want := []string{".ixtarignore", "main.go", "src/lib.go"}
+	if paths := ix.ListPaths(); !reflect.DeepEqual(paths, want) {
+		t.Errorf("Expected %v, got %v", want, paths)
+	}
+
+	explicit := filepath.Join(t.TempDir(), "patterns")
+	if err := os.WriteFile(explicit, []byte("*.go\n"), 0644); err != nil {
+		t.Fatalf("Failed to write ignore file: %v", err)
+	}
+	result, err = CreateBundleWithOptions(srcDir, bundlePath, CreateOptions{IgnoreFile: explicit})
+	if err != nil {
+		t.Fatalf("Failed to create bundle: %v", err)
+	}
+	if result.SkippedIgnored != 2 || result.Files != 5 {
+		t.Errorf("Expected the explicit ignore file to replace the default, got %+v", *result)
+	}
+
+	if _, err := CreateBundleWithOptions(srcDir, bundlePath, CreateOptions{IgnoreFile: filepath.Join(srcDir, "missing")}); err == nil {
+		t.Error("Expected error for a missing explicit ignore file")
+	}
+}
@@ -0,0 +1,192 @@
+package ixtar
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// inPlaceOutput writes a bundle straight into its final file format instead
+// of staging the data in a temporary file and copying it. The data is
+// written behind a region reserved for the header, index and info block,
+// sized from a count of the files before they are read, and the region is
+// filled in once the data is complete. The file is a partial file next to
+// the bundle, renamed over it by finish, so a failed create leaves an
+// existing bundle as it was.
+type inPlaceOutput struct {
+	file *os.File
+	path string // the bundle file that finish replaces
+	*sizeEstimate
+}
+
+func createInPlace(bundlePath string) (*inPlaceOutput, error) {
+	file, err := createPartial(bundlePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create bundle file: %w", err)
+	}
+	return &inPlaceOutput{file: file, path: bundlePath, sizeEstimate: newSizeEstimate()}, nil
+}
+
+// createPartial creates the partial file of a bundle in the directory of
+// bundlePath. It gets the permissions of an existing bundle, or those
+// os.Create would give a new one.
+func createPartial(bundlePath string) (*os.File, error) {
+	dir, base := filepath.Split(bundlePath)
+	for {
+		name := filepath.Join(dir, "."+base+"."+strconv.FormatUint(rand.Uint64(), 36)+".partial")
+		file, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+		if os.IsExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if info, err := os.Stat(bundlePath); err == nil {
+			if err := file.Chmod(info.Mode().Perm()); err != nil {
+				file.Close()
+				os.Remove(name)
+				return nil, err
+			}
+		}
+		return file, nil
+	}
+}
+
+// sizeEstimate bounds the size of the index and data of a bundle from the
+// stored paths and sizes of its files.
+type sizeEstimate struct {
+	files     int64
+	indexSize int64 // bound of the CSV index with every start written as 0
+	dataSize  int64 // bound of the data region
+	sealSize  int64 // added to the index by Encryption.Index
+
+	est *csv.Writer
+	n   countingWriter
+}
+
+func newSizeEstimate() *sizeEstimate {
+	e := &sizeEstimate{n: countingWriter{w: io.Discard}}
+	e.est = csv.NewWriter(&e.n)
+	return e
+}
+
+// canWriteInPlace reports whether a bundle at bundlePath can be written in
+// place, which needs a regular file that can seek.
+func canWriteInPlace(bundlePath string) bool {
+	info, err := os.Stat(bundlePath)
+	if os.IsNotExist(err) {
+		return true
+	}
+	return err == nil && info.Mode().IsRegular()
+}
+
+// placeholderKey stands in for the index keys of a built-in hash, which all
+// have the same length.
+var placeholderKey = strings.Repeat("0", HashLen)
+
+// add accounts for a file that will be added with its index key, stored
+// path and size.
+func (e *sizeEstimate) add(key, storedPath string, size int64, compress, encrypt bool) {
+	fileIndex := FileIndex{Size: size, Path: storedPath, CRC32: formatCRC32(0)}
+	stored := size
+	if compress {
+		// DEFLATE grows incompressible data by a few bytes per block
+		stored = size + size/1000 + 64
+		fileIndex.Compression = compressionDeflate
+		fileIndex.CompressedSize = stored
+	}
+	if encrypt {
+		fileIndex.Encryption, fileIndex.NonceSize = encryptionAESGCM, gcmNonceSize
+		stored += gcmNonceSize + gcmTagSize
+	}
+	before := e.n.n
+	writeCSVRecord(e.est, key, fileIndex)
+	e.est.Flush()
+
+	e.files++
+	e.indexSize += e.n.n - before
+	e.dataSize += stored
+}
+
+// dataOffset returns where the data starts: after the header, the estimated
+// index and the info block.
+func (e *sizeEstimate) dataOffset(infoSize int) int64 {
+	return headerSize + e.csvSize() + int64(infoSize)
+}
+
+// csvSize bounds the size of the CSV index, with every start as long as the
+// largest possible one.
+func (e *sizeEstimate) csvSize() int64 {
+	startDigits := int64(len(strconv.FormatInt(e.dataSize, 10)))
+	return e.indexSize + e.files*(startDigits-1) + e.sealSize
+}
+
+// bundleSize bounds the size of the whole bundle.
+func (e *sizeEstimate) bundleSize(infoSize int, trailer bool) int64 {
+	size := e.dataOffset(infoSize) + e.dataSize
+	if trailer {
+		size += e.csvSize() + trailerFooterSize
+	}
+	return size
+}
+
+// finish writes the header, index and info block in front of the dataSize
+// bytes of data at dataOffset, followed by the trailer if any, closes the
+// file and renames it over the bundle. The info block is padded with spaces,
+// which JSON ignores, to fill the reserved region. If files were added after
+// they were counted and the index doesn't fit, the data is moved back
+// instead.
+func (o *inPlaceOutput) finish(header bundleHeader, csvData io.ReadSeeker, infoData []byte, dataOffset, dataSize int64) error {
+	need := headerSize + header.csvSize + int64(len(infoData))
+	if need > dataOffset {
+		if err := shiftData(o.file, dataOffset, dataSize, need-dataOffset); err != nil {
+			return fmt.Errorf("failed to move data for a larger index: %w", err)
+		}
+		dataOffset = need
+	}
+	infoData = append(infoData, bytes.Repeat([]byte{' '}, int(dataOffset-need))...)
+
+	if _, err := o.file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to seek bundle file: %w", err)
+	}
+	header, err := writeBundlePrefix(o.file, header, csvData, infoData)
+	if err != nil {
+		return err
+	}
+	if _, err := o.file.Seek(dataOffset+dataSize, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to seek bundle file: %w", err)
+	}
+	if err := writeTrailer(o.file, header, csvData); err != nil {
+		return err
+	}
+	if err := o.file.Close(); err != nil {
+		return fmt.Errorf("failed to close bundle file: %w", err)
+	}
+	if err := os.Rename(o.file.Name(), o.path); err != nil {
+		return fmt.Errorf("failed to replace bundle: %w", err)
+	}
+	return nil
+}
+
+// shiftData moves the size bytes at off in f by delta bytes towards the end,
+// copying from the back so that no byte is overwritten before it is moved.
+func shiftData(f *os.File, off, size, delta int64) error {
+	buf := make([]byte, defaultCopyBufferSize)
+	for end := off + size; end > off; {
+		n := min(int64(len(buf)), end-off)
+		end -= n
+		if _, err := f.ReadAt(buf[:n], end); err != nil {
+			return err
+		}
+		if _, err := f.WriteAt(buf[:n], end+delta); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,265 @@
+package ixtar
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestCreateInPlace(t *testing.T) {
+	srcDir := t.TempDir()
+	testFiles := map[string]string{
+		"a.txt":         strings.Repeat("compressible text ", 1000),
+		"b.bin":         "stored as is",
+		"sub/c.txt":     "nested",
+		"sub/empty.txt": "",
+	}
+	for name, content := range testFiles {
+		path := filepath.Join(srcDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The bundle is written into the tree it is created from
+	bundlePath := filepath.Join(srcDir, "self.ixtar")
+	result, err := CreateBundleWithOptions(srcDir, bundlePath, CreateOptions{
+		Trailer:  true,
+		Compress: func(path string) bool { return strings.HasSuffix(path, ".txt") },
+	})
+	if err != nil {
+		t.Fatalf("Failed to create bundle: %v", err)
+	}
+	if result.Files != len(testFiles) {
+		t.Errorf("Expected %d files added, got %d", len(testFiles), result.Files)
+	}
+
+	ix, err := NewIxTar(bundlePath, WithVerifyOnRead())
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	defer ix.Close()
+	if _, err := ix.Stat("self.ixtar"); err == nil {
+		t.Error("Expected the bundle to leave itself out")
+	}
+	for name, content := range testFiles {
+		if got, err := ix.ExtractBytesOfFile(name); err != nil || string(got) != content {
+			t.Errorf("%s: got %d bytes (%v)", name, len(got), err)
+		}
+	}
+	if err := ix.VerifyAll(); err != nil {
+		t.Errorf("VerifyAll failed: %v", err)
+	}
+	if err := ix.Validate(); err != nil {
+		t.Errorf("Validate failed: %v", err)
+	}
+}
+
+func TestCreateInPlaceIndexGrows(t *testing.T) {
+	srcDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("first"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(srcDir, "z"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// Files show up after they were counted, so the reserved index region
+	// is too small and the data has to move
+	visits := 0
+	filter := func(path string, info os.FileInfo) error {
+		if info.Name() != "a.txt" {
+			return nil
+		}
+		if visits++; visits == 2 {
+			for i := 0; i < 50; i++ {
+				name := filepath.Join(srcDir, "z", fmt.Sprintf("late%02d.txt", i))
+				if err := os.WriteFile(name, []byte(strconv.Itoa(i)), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		return nil
+	}
+	bundlePath := filepath.Join(t.TempDir(), "grown.ixtar")
+	if _, err := CreateBundleWithOptions(srcDir, bundlePath, CreateOptions{Filter: filter}); err != nil {
+		t.Fatalf("Failed to create bundle: %v", err)
+	}
+
+	ix, err := NewIxTar(bundlePath)
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	defer ix.Close()
+	if got, err := ix.ExtractBytesOfFile("a.txt"); err != nil || string(got) != "first" {
+		t.Errorf("a.txt: got %q (%v)", got, err)
+	}
+	for i := 0; i < 50; i++ {
+		name := fmt.Sprintf("z/late%02d.txt", i)
+		if got, err := ix.ExtractBytesOfFile(name); err != nil || string(got) != strconv.Itoa(i) {
+			t.Errorf("%s: got %q (%v)", name, got, err)
+		}
+	}
+	if err := ix.VerifyAll(); err != nil {
+		t.Errorf("VerifyAll failed: %v", err)
+	}
+}
+
+// benchmarkCreateTree creates a tree of 8MB files adding up to
+// IXTAR_BENCH_SIZE bytes, 256MB by default.
+func TestCreateInPlaceFailureKeepsBundle(t *testing.T) {
+	srcDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("alpha"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// The bundle is inside the tree, and isn't added to itself
+	bundlePath := filepath.Join(srcDir, "test.ixtar")
+	if _, err := CreateBundleWithOptions(srcDir, bundlePath, CreateOptions{}); err != nil {
+		t.Fatalf("Failed to create bundle: %v", err)
+	}
+	if err := os.Chmod(bundlePath, 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	stop := errors.New("stop")
+	_, err := CreateBundleWithOptions(srcDir, bundlePath, CreateOptions{
+		Filter: func(path string, info os.FileInfo) error { return stop },
+	})
+	if !errors.Is(err, stop) {
+		t.Fatalf("Expected the filter error, got %v", err)
+	}
+	if entries, _ := os.ReadDir(srcDir); len(entries) != 2 {
+		t.Errorf("Expected no partial file to be left, got %v", entries)
+	}
+	ix, err := NewIxTar(bundlePath)
+	if err != nil {
+		t.Fatalf("Expected the bundle to survive a failed create: %v", err)
+	}
+	if got, err := ix.ExtractBytesOfFile("a.txt"); err != nil || string(got) != "alpha" {
+		t.Errorf("a.txt: got %q (%v)", got, err)
+	}
+	ix.Close()
+
+	// A successful create replaces it, keeping its permissions
+	if err := os.WriteFile(filepath.Join(srcDir, "b.txt"), []byte("bravo"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CreateBundleWithOptions(srcDir, bundlePath, CreateOptions{}); err != nil {
+		t.Fatalf("Failed to recreate bundle: %v", err)
+	}
+	if info, err := os.Stat(bundlePath); err != nil || info.Mode().Perm() != 0640 {
+		t.Errorf("Expected the permissions to be kept, got %v (%v)", info.Mode(), err)
+	}
+	ix, err = NewIxTar(bundlePath)
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	defer ix.Close()
+	if got, want := ix.ListPaths(), []string{"a.txt", "b.txt"}; strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("Expected paths %v, got %v", want, got)
+	}
+}
+
+func benchmarkCreateTree(b *testing.B) (string, int64) {
+	total := int64(256 << 20)
+	if s := os.Getenv("IXTAR_BENCH_SIZE"); s != "" {
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			b.Fatalf("invalid IXTAR_BENCH_SIZE: %v", err)
+		}
+		total = n
+	}
+	srcDir := b.TempDir()
+	content := bytes.Repeat([]byte{'x'}, 8<<20)
+	for i := int64(0); i*int64(len(content)) < total; i++ {
+		if err := os.WriteFile(filepath.Join(srcDir, fmt.Sprintf("file%04d.bin", i)), content, 0644); err != nil {
+			b.Fatal(err)
+		}
+	}
+	return srcDir, total
+}
+
+func BenchmarkCreateInPlace(b *testing.B) {
+	srcDir, total := benchmarkCreateTree(b)
+	bundlePath := filepath.Join(b.TempDir(), "bench.ixtar")
+
+	b.SetBytes(total)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := CreateBundle(srcDir, bundlePath); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkCreateStaged writes the same bundle file through
+// CreateBundleToWriter, which stages the data and copies it.
+func BenchmarkCreateStaged(b *testing.B) {
+	srcDir, total := benchmarkCreateTree(b)
+	outDir := b.TempDir()
+	bundlePath := filepath.Join(outDir, "bench.ixtar")
+
+	b.SetBytes(total)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		f, err := os.Create(bundlePath)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := CreateBundleToWriter(srcDir, f, CreateOptions{TempDir: outDir}); err != nil {
+			b.Fatal(err)
+		}
+		if err := f.Close(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestEstimateBundleSize(t *testing.T) {
+	srcDir := t.TempDir()
+	for i := 0; i < 20; i++ {
+		path := filepath.Join(srcDir, fmt.Sprintf("dir%d", i%3), fmt.Sprintf("file%d.txt", i))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, bytes.Repeat([]byte{byte('a' + i)}, i*500), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tc := range []struct {
+		name  string
+		opts  CreateOptions
+		exact bool
+	}{
+		{"plain", CreateOptions{}, true},
+		{"xxh64", CreateOptions{HashAlgorithm: HashXXH64}, true},
+		{"trailer", CreateOptions{Trailer: true}, false},
+		{"compressed", CreateOptions{Compress: func(string) bool { return true }}, false},
+		{"keyer", CreateOptions{Keyer: idKeyer{}}, false},
+	} {
+		estimate, err := EstimateBundleSize(srcDir, tc.opts)
+		if err != nil {
+			t.Fatalf("%s: EstimateBundleSize failed: %v", tc.name, err)
+		}
+		bundlePath := filepath.Join(t.TempDir(), "estimate.ixtar")
+		if _, err := CreateBundleWithOptions(srcDir, bundlePath, tc.opts); err != nil {
+			t.Fatalf("%s: failed to create bundle: %v", tc.name, err)
+		}
+		info, err := os.Stat(bundlePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if estimate < info.Size() || tc.exact && estimate != info.Size() {
+			t.Errorf("%s: estimated %d bytes, bundle has %d", tc.name, estimate, info.Size())
+		}
+	}
+}
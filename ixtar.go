@@ -1,23 +1,84 @@
 package ixtar
 
 import (
+	"bufio"
 	"bytes"
-	"crypto/md5"
-	"encoding/binary"
+	"crypto/cipher"
 	"encoding/csv"
-	"encoding/hex"
+	"errors"
 	"fmt"
+	"hash/crc32"
 	"io"
+	"log/slog"
+	"math"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"runtime"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
 const HashLen = 16
 
+// ErrFileNotFound is returned when a path is not present in the bundle index.
+var ErrFileNotFound = errors.New("file not found")
+
+// ErrNotRegularFile is returned when a path names a directory of the bundle
+// rather than a file.
+var ErrNotRegularFile = errors.New("not a regular file")
+
+// ErrClosed is returned when reading from a bundle after Close.
+var ErrClosed = errors.New("bundle is closed")
+
+// ErrTooLarge is returned when a file is too large to be returned as a byte
+// slice on this platform, e.g. over 2GB on 32-bit builds. ExtractToWriter
+// streams such files instead.
+var ErrTooLarge = errors.New("file too large to hold in memory")
+
+// maxInMemorySize is the largest file ExtractBytesOfFile and friends
+// allocate a buffer for. Tests lower it.
+var maxInMemorySize int64 = math.MaxInt
+
+// ErrBadFormat is returned when a bundle's header or index is inconsistent
+// with the file, e.g. because it was truncated or corrupted.
+var ErrBadFormat = errors.New("bad bundle format")
+
+// ErrNotABundle is returned when a file isn't an ixtar bundle at all, e.g.
+// a tar or text file: it is shorter than the header or doesn't start with
+// the header magic. Damaged bundles fail with ErrBadFormat instead.
+var ErrNotABundle = errors.New("not an ixtar bundle")
+
+// ErrUnsupportedVersion is returned when a bundle was written with a newer
+// major format version, or uses required features this version doesn't
+// know.
+var ErrUnsupportedVersion = errors.New("unsupported bundle format version")
+
 type FileIndex struct {
-	Start int64 `json:"start"`
-	Size  int64 `json:"size"`
+	Start  int64             `json:"start"`
+	Size   int64             `json:"size"`
+	Path   string            `json:"path,omitempty"`
+	Sparse []SparseSegment   `json:"sparse,omitempty"`
+	Meta   map[string]string `json:"meta,omitempty"`
+	CRC32  string            `json:"crc32,omitempty"` // Of the stored bytes, hex encoded
+
+	// Compression is "deflate" if the file is stored compressed, taking
+	// CompressedSize bytes of the data region.
+	Compression    string `json:"compression,omitempty"`
+	CompressedSize int64  `json:"compressed_size,omitempty"`
+
+	// Encryption is "aes-gcm" if the file is stored encrypted, as a nonce
+	// of NonceSize bytes followed by the sealed content.
+	Encryption string `json:"encryption,omitempty"`
+	NonceSize  int    `json:"nonce_size,omitempty"`
+
+	key string // index key of an encrypted entry, see additionalData
 }
 
 type DataIndex struct {
@@ -26,320 +87,2604 @@ type DataIndex struct {
 
 type IxTar struct {
 	bundlePath string
+	tempPath   string // decompressed copy of a gzipped bundle, removed on Close
 	index      DataIndex
+	low        *lowMemIndex // set when opened WithLowMemoryIndex, see files
+	loadMu     sync.Mutex
 	csvSize    int64
 	file       *os.File
+	bundleSize int64
 	dataOffset int64
+	dataSize   int64       // data region size, excluding any trailer
+	reader     io.ReaderAt // file or mapping, used for all data reads
+	mapping    []byte      // set when opened WithMmap
+	pool       *readerPool // set when opened WithReaderPool
+	header     bundleHeader
+	hasher     pathHasher
+	keyer      Keyer // custom keyer, nil for bundles keyed by a built-in hash
+	readAhead  int
+	verify     bool        // verify checksums on read
+	aead       cipher.AEAD // decrypts encrypted files, nil without WithKey
+
+	dirsOnce sync.Once
+	dirs     map[string]bool // directories implied by stored paths, built on first miss
+	info     bundleInfo
+
+	orderOnce sync.Once
+	order     []string // index hashes by offset, see entriesByOffset
 }
 
-func hashFilePath(filePath string) string {
-	h := md5.New()
-	h.Write([]byte(filePath))
-	return hex.EncodeToString(h.Sum(nil))[:HashLen]
+// OpenOption configures how NewIxTar opens a bundle.
+type OpenOption func(*openConfig)
+
+type openConfig struct {
+	mmap          bool
+	poolSize      int
+	readAheadSize int
+	verifyOnRead  bool
+	validate      bool
+	keyer         Keyer
+	lowMemory     bool
+	logger        *slog.Logger
+	key           []byte
+	password      *string
+
+	maxDecompressedSize int64
+	followInterval      time.Duration
 }
 
-func NewIxTar(bundlePath string) (*IxTar, error) {
-	file, err := os.Open(bundlePath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open bundle: %w", err)
+// WithMmap memory-maps the bundle so reads are served from the mapping
+// instead of issuing a syscall per read. The mapping is released by Close.
+func WithMmap() OpenOption {
+	return func(c *openConfig) {
+		c.mmap = true
 	}
+}
 
-	var csvSizeBytes [32]byte
-	if _, err := io.ReadFull(file, csvSizeBytes[:]); err != nil {
-		file.Close()
-		return nil, fmt.Errorf("failed to read CSV size: %w", err)
+// WithValidate makes opening fail with ErrBadFormat if an index entry lies
+// outside the data region, which starts right after the header, index and
+// info block. A wrong index size in the header of a bundle without a header
+// checksum shifts that region, which otherwise only shows as wrong content
+// or a failed read later on. Entries sharing data are allowed; Validate
+// reports them too.
+func WithValidate() OpenOption {
+	return func(c *openConfig) {
+		c.validate = true
 	}
+}
 
-	csvSize := int64(binary.BigEndian.Uint64(csvSizeBytes[24:]))
+// WithLogger sets where warnings found while opening a bundle go, such as a
+// bundle written by a newer minor format version. Nil logs nothing.
+func WithLogger(l *slog.Logger) OpenOption {
+	return func(c *openConfig) {
+		c.logger = l
+	}
+}
 
-	csvData := make([]byte, csvSize)
-	if _, err := io.ReadFull(file, csvData); err != nil {
-		file.Close()
-		return nil, fmt.Errorf("failed to read CSV data: %w", err)
+// normalizePath brings a path into the form that is hashed, both when a
+// bundle is created and when a file is looked up: separators become forward
+// slashes on every OS, and a leading "./", repeated separators and a
+// trailing separator (except for the root) are removed.
+func normalizePath(filePath string) string {
+	if osSeparator != '/' {
+		filePath = strings.ReplaceAll(filePath, string(osSeparator), "/")
 	}
+	return path.Clean(filePath)
+}
 
-	index, err := parseCSVIndex(csvData)
-	if err != nil {
-		file.Close()
-		return nil, fmt.Errorf("failed to parse CSV index: %w", err)
+// osSeparator is the path separator of the OS, a variable so that tests can
+// simulate Windows paths.
+var osSeparator = filepath.Separator
+
+// checkStoredName fails if a stored path contains NUL or another control
+// character. The CSV index can hold them quoted, but they break extraction
+// on most filesystems and usually come from a corrupted or hostile tree.
+func checkStoredName(storedPath string) error {
+	if i := strings.IndexFunc(storedPath, unicode.IsControl); i >= 0 {
+		r, _ := utf8.DecodeRuneInString(storedPath[i:])
+		return fmt.Errorf("path %q contains control character %U", storedPath, r)
 	}
+	return nil
+}
 
-	dataOffset := 32 + csvSize
+// unmodified reports whether a file is left out by
+// CreateOptions.ModifiedAfter.
+func unmodified(info os.FileInfo, after time.Time) bool {
+	return !after.IsZero() && !info.ModTime().After(after)
+}
 
-	return &IxTar{
-		bundlePath: bundlePath,
-		index:      index,
-		csvSize:    csvSize,
-		file:       file,
-		dataOffset: dataOffset,
-	}, nil
+// sanitizeName replaces the control characters of a stored path with
+// underscores, for CreateOptions.SanitizeNames.
+func sanitizeName(storedPath string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return '_'
+		}
+		return r
+	}, storedPath)
 }
 
-func parseCSVIndex(csvData []byte) (DataIndex, error) {
-	reader := csv.NewReader(bytes.NewReader(csvData))
-	records, err := reader.ReadAll()
+// WithReaderPool gives each concurrent extraction its own file handle,
+// opening at most size handles. Extractions beyond that wait for a free
+// handle. Ignored together with WithMmap, which needs no handles.
+func WithReaderPool(size int) OpenOption {
+	return func(c *openConfig) {
+		c.poolSize = size
+	}
+}
+
+// NewIxTar opens a bundle. A bundle that was gzipped as a whole is detected
+// and decompressed into a temporary file first, which is removed on Close.
+func NewIxTar(bundlePath string, opts ...OpenOption) (*IxTar, error) {
+	cfg, err := newOpenConfig(opts)
 	if err != nil {
-		return DataIndex{}, fmt.Errorf("failed to parse CSV: %w", err)
+		return nil, err
 	}
 
-	index := DataIndex{Files: make(map[string]FileIndex)}
-	for _, record := range records {
-		if len(record) != 3 {
-			return DataIndex{}, fmt.Errorf("invalid CSV record: expected 3 fields, got %d", len(record))
-		}
+	file, err := os.Open(bundlePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bundle: %w", err)
+	}
 
-		hash := record[0]
-		start, err := strconv.ParseInt(record[1], 10, 64)
-		if err != nil {
-			return DataIndex{}, fmt.Errorf("invalid start position: %w", err)
-		}
+	// A gzipped bundle is decompressed to a temporary file, which is read
+	// in place of bundlePath and removed on Close, or below on failure
+	openPath := bundlePath
+	tempPath := ""
+	gzipped := false
+	if file, gzipped, err = gunzipIfCompressed(file, cfg.maxDecompressedSize); err != nil {
+		return nil, err
+	}
+	if gzipped {
+		openPath = file.Name()
+		tempPath = openPath
+		defer func() {
+			if tempPath != "" {
+				os.Remove(tempPath)
+			}
+		}()
+	}
+
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to stat bundle: %w", err)
+	}
+
+	ix, err := openReaderAt(file, stat.Size(), cfg)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	ix.bundlePath = bundlePath
+	ix.file = file
 
-		size, err := strconv.ParseInt(record[2], 10, 64)
+	if cfg.mmap {
+		mapping, err := mmapFile(file)
 		if err != nil {
-			return DataIndex{}, fmt.Errorf("invalid file size: %w", err)
+			file.Close()
+			return nil, fmt.Errorf("failed to mmap bundle: %w", err)
 		}
-
-		index.Files[hash] = FileIndex{Start: start, Size: size}
+		ix.mapping = mapping
+		ix.reader = bytes.NewReader(mapping)
+	} else if cfg.poolSize > 0 {
+		ix.pool = newReaderPool(openPath, cfg.poolSize)
+		ix.reader = readerAtFunc(ix.pool.readAt)
 	}
 
-	return index, nil
+	ix.tempPath, tempPath = tempPath, ""
+	return ix, nil
 }
 
-func (ix *IxTar) Close() error {
-	if ix.file != nil {
-		return ix.file.Close()
+func newOpenConfig(opts []OpenOption) (openConfig, error) {
+	cfg := openConfig{readAheadSize: defaultReadAheadSize, maxDecompressedSize: defaultMaxDecompressedSize, followInterval: defaultFollowInterval}
+	for _, opt := range opts {
+		opt(&cfg)
 	}
-	return nil
-}
 
-func (ix *IxTar) ExtractBytesOfFile(filePath string) ([]byte, error) {
-	if ix == nil {
-		return nil, fmt.Errorf("IxTar instance is nil")
+	if cfg.poolSize < 0 {
+		return cfg, fmt.Errorf("invalid reader pool size: %d", cfg.poolSize)
 	}
-	
-	cleanPath := filepath.Clean(filePath)
-	hash := hashFilePath(cleanPath)
-
-	fileIndex, exists := ix.index.Files[hash]
-	if !exists {
-		return nil, fmt.Errorf("file not found: %s", filePath)
+	if cfg.readAheadSize < 0 {
+		return cfg, fmt.Errorf("invalid read-ahead size: %d", cfg.readAheadSize)
+	}
+	if cfg.maxDecompressedSize < headerSize {
+		return cfg, fmt.Errorf("invalid maximum decompressed size: %d", cfg.maxDecompressedSize)
 	}
+	return cfg, nil
+}
+
+// openReaderAt reads the header, index and info block of a bundle of size
+// bytes and returns an IxTar reading its data from r.
+func openReaderAt(r io.ReaderAt, size int64, cfg openConfig) (*IxTar, error) {
+	sr := io.NewSectionReader(r, 0, size)
 
-	// Seek to the file position within the raw data
-	fileOffset := ix.dataOffset + fileIndex.Start
-	if _, err := ix.file.Seek(fileOffset, io.SeekStart); err != nil {
-		return nil, fmt.Errorf("failed to seek to file position: %w", err)
+	header, err := readHeader(sr)
+	if err != nil {
+		return nil, err
+	}
+	if err := header.checkSize(size); err != nil {
+		return nil, err
 	}
+	csvSize := header.csvSize
 
-	// Read the file data directly
-	data := make([]byte, fileIndex.Size)
-	if _, err := io.ReadFull(ix.file, data); err != nil {
-		return nil, fmt.Errorf("failed to read file data: %w", err)
+	if cfg.lowMemory {
+		return openLowMemory(r, size, header, cfg)
 	}
 
-	return data, nil
-}
+	csvData := make([]byte, csvSize)
+	if _, err := io.ReadFull(sr, csvData); err != nil {
+		return nil, fmt.Errorf("failed to read CSV data: %w", err)
+	}
 
-func (ix *IxTar) ListFiles() []string {
-	var files []string
-	for hash := range ix.index.Files {
-		files = append(files, hash)
+	infoData := make([]byte, header.infoSize)
+	if _, err := io.ReadFull(sr, infoData); err != nil {
+		return nil, fmt.Errorf("failed to read bundle info: %w", err)
+	}
+	// Checked first, so corruption isn't reported as a parse error
+	if err := header.checkIndexCRC(csvData, infoData); err != nil {
+		return nil, err
 	}
-	return files
-}
 
-func (ix *IxTar) Info() (fileCount int, csvSizeBytes int64) {
-	return len(ix.index.Files), ix.csvSize
-}
+	info, err := parseBundleInfo(infoData)
+	if err != nil {
+		return nil, err
+	}
+	info.warnNewerMinor(orDiscard(cfg.logger), header)
+	aead, err := info.openCipher(header, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if csvData, err = decryptIndex(header, aead, csvData); err != nil {
+		return nil, err
+	}
 
-func (ix *IxTar) ExtractAll(outputDir string) error {
-	if err := os.MkdirAll(outputDir, 0755); err != nil {
-		return fmt.Errorf("failed to create output directory: %w", err)
+	index, err := parseCSVIndex(csvData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CSV index: %w", err)
+	}
+	hasher, keyer, err := resolveKeyer(header, info, index, cfg.keyer)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkIndexKeys(index, info); err != nil {
+		return nil, err
 	}
 
-	for hash, fileIndex := range ix.index.Files {
-		fileOffset := ix.dataOffset + fileIndex.Start
-		if _, err := ix.file.Seek(fileOffset, io.SeekStart); err != nil {
-			return fmt.Errorf("failed to seek to file position: %w", err)
-		}
+	dataOffset, dataSize, err := dataRegion(r, size, header)
+	if err != nil {
+		return nil, err
+	}
 
-		data := make([]byte, fileIndex.Size)
-		if _, err := io.ReadFull(ix.file, data); err != nil {
-			return fmt.Errorf("failed to read file data: %w", err)
+	ix := &IxTar{
+		index:      index,
+		csvSize:    csvSize,
+		bundleSize: size,
+		dataOffset: dataOffset,
+		dataSize:   dataSize,
+		reader:     r,
+		header:     header,
+		hasher:     hasher,
+		keyer:      keyer,
+		info:       info,
+		readAhead:  cfg.readAheadSize,
+		verify:     cfg.verifyOnRead,
+		aead:       aead,
+	}
+	if cfg.validate {
+		for _, hash := range ix.entriesByOffset() {
+			if err := checkDataRegion(hash, index.Files[hash], dataOffset, dataSize); err != nil {
+				return nil, err
+			}
 		}
+	}
+	return ix, nil
+}
 
-		outputPath := filepath.Join(outputDir, hash)
-		outputFile, err := os.Create(outputPath)
+// dataRegion returns the offset and size of the data region of a bundle of
+// size bytes with header, which ends at the trailer if there is one.
+func dataRegion(r io.ReaderAt, size int64, header bundleHeader) (int64, int64, error) {
+	dataOffset := headerSize + header.csvSize + int64(header.infoSize)
+	dataSize := size - dataOffset
+	if header.flags&flagTrailer != 0 {
+		trailerSize, err := readTrailerFooter(r, size, header)
 		if err != nil {
-			return fmt.Errorf("failed to create output file %s: %w", outputPath, err)
+			return 0, 0, err
 		}
-
-		if _, err := outputFile.Write(data); err != nil {
-			outputFile.Close()
-			return fmt.Errorf("failed to write file %s: %w", outputPath, err)
+		if trailerSize > dataSize {
+			return 0, 0, fmt.Errorf("%w: trailer size %d exceeds data region %d", ErrBadFormat, trailerSize, dataSize)
 		}
-		outputFile.Close()
+		dataSize -= trailerSize
 	}
+	return dataOffset, dataSize, nil
+}
 
+// checkDataRegion fails with ErrBadFormat if the data of an entry lies
+// outside the data region of dataSize bytes at dataOffset, for WithValidate.
+func checkDataRegion(hash string, fileIndex FileIndex, dataOffset, dataSize int64) error {
+	if end := fileIndex.Start + fileIndex.storedSize(); fileIndex.Start < 0 || end > dataSize {
+		return fmt.Errorf("%w: %s: region %d-%d is outside the %d byte data region at offset %d, the index size in the header may be wrong",
+			ErrBadFormat, entryName(hash, fileIndex), fileIndex.Start, end, dataSize, dataOffset)
+	}
 	return nil
 }
 
-type ProgressCallback func(current, total int, filename string)
+// readerAtFunc adapts a function to io.ReaderAt.
+type readerAtFunc func(p []byte, off int64) (int, error)
 
-func CreateBundle(sourceDir, bundlePath string) error {
-	return CreateBundleWithProgress(sourceDir, bundlePath, nil)
+func (f readerAtFunc) ReadAt(p []byte, off int64) (int, error) {
+	return f(p, off)
 }
 
-func CreateBundleWithProgress(sourceDir, bundlePath string, progress ProgressCallback) error {
-	// Create temporary file for raw file data
-	tmpDataFile, err := os.CreateTemp("", "ixtar-data-*.tmp")
+// closedReader replaces the reader of a closed bundle.
+var closedReader = readerAtFunc(func(p []byte, off int64) (int, error) {
+	return 0, ErrClosed
+})
+
+func parseCSVIndex(csvData []byte) (DataIndex, error) {
+	reader := csv.NewReader(bytes.NewReader(csvData))
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
 	if err != nil {
-		return fmt.Errorf("failed to create temp data file: %w", err)
+		return DataIndex{}, fmt.Errorf("failed to parse CSV: %w", err)
 	}
-	defer os.Remove(tmpDataFile.Name())
-	defer tmpDataFile.Close()
 
-	// Create temporary CSV file
-	tmpCsvFile, err := os.CreateTemp("", "ixtar-csv-*.tmp")
-	if err != nil {
-		return fmt.Errorf("failed to create temp csv file: %w", err)
+	index := DataIndex{Files: make(map[string]FileIndex)}
+	for _, record := range records {
+		hash, fileIndex, err := parseCSVRecord(record)
+		if err != nil {
+			return DataIndex{}, err
+		}
+		index.Files[hash] = fileIndex
 	}
-	defer os.Remove(tmpCsvFile.Name())
-	defer tmpCsvFile.Close()
 
-	csvWriter := csv.NewWriter(tmpCsvFile)
+	return index, nil
+}
 
-	// Count files first if progress callback is provided
-	totalFiles := 0
-	if progress != nil {
-		filepath.Walk(sourceDir, func(path string, info os.FileInfo, err error) error {
-			if err != nil {
-				return nil
-			}
-			relPath, err := filepath.Rel(sourceDir, path)
-			if err != nil || relPath == "." || info.IsDir() {
-				return nil
-			}
-			totalFiles++
-			return nil
-		})
+func parseCSVRecord(record []string) (string, FileIndex, error) {
+	// Older bundles have only hash,start,size or hash,start,size,path.
+	// Columns after the attributes are optional additions of newer minor
+	// format versions and are ignored.
+	if len(record) < 3 {
+		return "", FileIndex{}, fmt.Errorf("invalid CSV record: expected at least 3 fields, got %d", len(record))
 	}
 
-	// Phase 1: Create raw data file and build index simultaneously
-	currentFile := 0
-	currentPos := int64(0) // Track position in raw data file
-	csvFileCount := 0
+	hash := record[0]
+	if hash == "" {
+		return "", FileIndex{}, fmt.Errorf("invalid CSV record: empty hash")
+	}
+	start, err := strconv.ParseInt(record[1], 10, 64)
+	if err != nil {
+		return "", FileIndex{}, fmt.Errorf("invalid start position: %w", err)
+	}
 
-	err = filepath.Walk(sourceDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
+	size, err := strconv.ParseInt(record[2], 10, 64)
+	if err != nil {
+		return "", FileIndex{}, fmt.Errorf("invalid file size: %w", err)
+	}
+	// Checked here so that offset arithmetic on entries can't overflow
+	if start < 0 || size < 0 || start > math.MaxInt64-size {
+		return "", FileIndex{}, fmt.Errorf("invalid CSV record: region %d+%d out of range", start, size)
+	}
+
+	fileIndex := FileIndex{Start: start, Size: size}
+	if len(record) >= 4 {
+		fileIndex.Path = record[3]
+	}
+	if len(record) >= 5 {
+		if err := parseAttrs(&fileIndex, record[4]); err != nil {
+			return "", FileIndex{}, err
 		}
+		if start > math.MaxInt64-fileIndex.storedSize() {
+			return "", FileIndex{}, fmt.Errorf("invalid CSV record: region %d+%d out of range", start, fileIndex.storedSize())
+		}
+		if fileIndex.encrypted() {
+			fileIndex.key = hash
+		}
+	}
+	return hash, fileIndex, nil
+}
 
-		relPath, err := filepath.Rel(sourceDir, path)
+// parseAttrs decodes the optional fifth CSV field, a URL-encoded set of
+// per-file attributes.
+func parseAttrs(fileIndex *FileIndex, field string) error {
+	attrs, err := url.ParseQuery(field)
+	if err != nil {
+		return fmt.Errorf("invalid attributes: %w", err)
+	}
+
+	if attrs.Has("sparse") {
+		segs, err := parseSparse(attrs.Get("sparse"), fileIndex.Size)
 		if err != nil {
 			return err
 		}
+		fileIndex.Sparse = segs
+	}
 
-		if relPath == "." || info.IsDir() {
-			return nil
-		}
+	fileIndex.CRC32 = attrs.Get("crc32")
 
-		currentFile++
-		if currentFile%1000 == 0 {
-			if progress != nil {
-				progress(currentFile, totalFiles, "")
-			}
+	if attrs.Has("compression") {
+		if fileIndex.Compression = attrs.Get("compression"); fileIndex.Compression != compressionDeflate {
+			return fmt.Errorf("unsupported compression %q", fileIndex.Compression)
+		}
+		if fileIndex.Sparse != nil {
+			return fmt.Errorf("sparse files can't be compressed")
 		}
+		csize, err := strconv.ParseInt(attrs.Get("csize"), 10, 64)
+		if err != nil || csize < 0 {
+			return fmt.Errorf("invalid compressed size %q", attrs.Get("csize"))
+		}
+		fileIndex.CompressedSize = csize
+	}
 
-		if info.Mode().IsRegular() {
-			cleanPath := filepath.Clean(relPath)
-			hash := hashFilePath(cleanPath)
+	if attrs.Has("encryption") {
+		if fileIndex.Encryption = attrs.Get("encryption"); fileIndex.Encryption != encryptionAESGCM {
+			return fmt.Errorf("unsupported encryption %q", fileIndex.Encryption)
+		}
+		if fileIndex.Sparse != nil {
+			return fmt.Errorf("sparse files can't be encrypted")
+		}
+		nonceSize, err := strconv.Atoi(attrs.Get("nonce"))
+		if err != nil || nonceSize <= 0 || nonceSize > 64 {
+			return fmt.Errorf("invalid nonce size %q", attrs.Get("nonce"))
+		}
+		fileIndex.NonceSize = nonceSize
+	}
 
-			// Record position in CSV - this is where file data starts
-			record := []string{
-				hash,
-				strconv.FormatInt(currentPos, 10),
-				strconv.FormatInt(info.Size(), 10),
-			}
-			if err := csvWriter.Write(record); err != nil {
-				return fmt.Errorf("failed to write CSV record: %w", err)
+	for key, values := range attrs {
+		if name, ok := strings.CutPrefix(key, metaAttrPrefix); ok {
+			if fileIndex.Meta == nil {
+				fileIndex.Meta = make(map[string]string)
 			}
+			fileIndex.Meta[name] = values[0]
+		}
+	}
+	return nil
+}
 
-			csvFileCount++
-			if csvFileCount%1000 == 0 {
-				csvWriter.Flush()
-				if err := csvWriter.Error(); err != nil {
-					return fmt.Errorf("CSV flush error: %w", err)
-				}
-			}
+// metaAttrPrefix marks attributes holding user metadata of a file.
+const metaAttrPrefix = "m."
 
-			// Write file data directly to raw data file
-			file, err := os.Open(path)
-			if err != nil {
-				return err
-			}
+// writeCSVRecord writes the index record of an entry.
+func writeCSVRecord(w *csv.Writer, hash string, fileIndex FileIndex) error {
+	record := []string{
+		hash,
+		strconv.FormatInt(fileIndex.Start, 10),
+		strconv.FormatInt(fileIndex.Size, 10),
+		fileIndex.Path,
+		formatAttrs(fileIndex),
+	}
+	if err := w.Write(record); err != nil {
+		return fmt.Errorf("failed to write CSV record: %w", err)
+	}
+	return nil
+}
 
-			buf := make([]byte, 32*1024) // 32KB buffer
-			written, err := io.CopyBuffer(tmpDataFile, file, buf)
-			file.Close()
-			if err != nil {
-				return err
-			}
+// formatAttrs encodes the per-file attributes for the fifth CSV field.
+func formatAttrs(fileIndex FileIndex) string {
+	attrs := url.Values{}
+	if fileIndex.Sparse != nil {
+		attrs.Set("sparse", formatSparse(fileIndex.Sparse))
+	}
+	if fileIndex.CRC32 != "" {
+		attrs.Set("crc32", fileIndex.CRC32)
+	}
+	if fileIndex.Compression != "" {
+		attrs.Set("compression", fileIndex.Compression)
+		attrs.Set("csize", strconv.FormatInt(fileIndex.CompressedSize, 10))
+	}
+	if fileIndex.Encryption != "" {
+		attrs.Set("encryption", fileIndex.Encryption)
+		attrs.Set("nonce", strconv.Itoa(fileIndex.NonceSize))
+	}
+	for key, value := range fileIndex.Meta {
+		attrs.Set(metaAttrPrefix+key, value)
+	}
+	return attrs.Encode()
+}
 
-			// Update position
-			currentPos += written
-		}
+// Close releases the file handle, reader pool, memory mapping and temporary
+// file of the bundle and returns their errors joined. It is safe to call more
+// than once; reads after Close fail with ErrClosed.
+func (ix *IxTar) Close() error {
+	ix.reader = closedReader
 
-		return nil
-	})
+	var errs []error
+	if ix.pool != nil {
+		errs = append(errs, ix.pool.close())
+		ix.pool = nil
+	}
+	if ix.mapping != nil {
+		errs = append(errs, munmapFile(ix.mapping))
+		ix.mapping = nil
+	}
+	if ix.file != nil {
+		errs = append(errs, ix.file.Close())
+		ix.file = nil
+	}
+	if ix.tempPath != "" {
+		errs = append(errs, os.Remove(ix.tempPath))
+		ix.tempPath = ""
+	}
+	return errors.Join(errs...)
+}
 
+func (ix *IxTar) ExtractBytesOfFile(filePath string) ([]byte, error) {
+	if ix == nil {
+		return nil, fmt.Errorf("IxTar instance is nil")
+	}
+	
+	fileIndex, err := ix.lookup(filePath)
 	if err != nil {
-		return fmt.Errorf("failed to walk directory: %w", err)
+		return nil, err
 	}
+	return ix.extractEntry(fileIndex)
+}
 
-	csvWriter.Flush()
-	if err := csvWriter.Error(); err != nil {
-		return fmt.Errorf("failed to flush CSV writer: %w", err)
+// extractEntry returns the content of an entry, holes included.
+func (ix *IxTar) extractEntry(fileIndex FileIndex) ([]byte, error) {
+	data, err := ix.readStored(fileIndex)
+	if err != nil {
+		return nil, err
+	}
+	if data, err = ix.decrypt(data, fileIndex); err != nil {
+		return nil, err
 	}
+	return decodeStored(data, fileIndex)
+}
 
-	// Get CSV size
-	csvSize, err := tmpCsvFile.Seek(0, io.SeekCurrent)
+// Bytes returns the content of a file like ExtractBytesOfFile, but for
+// bundles opened WithMmap it returns a slice of the mapping instead of a
+// copy. That slice must not be modified and is only valid until Close.
+// Sparse and compressed files and other backends always get a copy.
+func (ix *IxTar) Bytes(filePath string) ([]byte, error) {
+	fileIndex, err := ix.lookup(filePath)
 	if err != nil {
-		return fmt.Errorf("failed to get CSV size: %w", err)
+		return nil, err
 	}
 
-	// Phase 2: Assemble final bundle
-	bundleFile, err := os.Create(bundlePath)
-	if err != nil {
-		return fmt.Errorf("failed to create bundle file: %w", err)
+	if ix.mapping != nil && !fileIndex.encoded() {
+		start := ix.dataOffset + fileIndex.Start
+		end := start + fileIndex.Size
+		if start < 0 || end > int64(len(ix.mapping)) {
+			return nil, fmt.Errorf("file data of %s exceeds bundle size", filePath)
+		}
+		return ix.mapping[start:end:end], nil
 	}
-	defer bundleFile.Close()
 
-	var csvSizeBytes [32]byte
-	binary.BigEndian.PutUint64(csvSizeBytes[24:], uint64(csvSize))
+	return ix.ExtractBytesOfFile(filePath)
+}
 
-	if _, err := bundleFile.Write(csvSizeBytes[:]); err != nil {
-		return fmt.Errorf("failed to write CSV size: %w", err)
+// ExtractRange returns length bytes of a file starting at offset. The range
+// is clipped to the end of the file. Compressed files can't be read in the
+// middle, so the whole file is decompressed for every call; read them with
+// ExtractToWriter instead of in many small ranges.
+func (ix *IxTar) ExtractRange(filePath string, offset, length int64) ([]byte, error) {
+	fileIndex, err := ix.lookup(filePath)
+	if err != nil {
+		return nil, err
 	}
+	return ix.readRange(fileIndex, offset, length)
+}
 
-	// Copy CSV data
-	if _, err := tmpCsvFile.Seek(0, io.SeekStart); err != nil {
-		return fmt.Errorf("failed to seek CSV temp file: %w", err)
+func (ix *IxTar) readRange(fileIndex FileIndex, offset, length int64) ([]byte, error) {
+	if offset < 0 || length < 0 || offset > fileIndex.Size {
+		return nil, fmt.Errorf("invalid range %d+%d for file of size %d", offset, length, fileIndex.Size)
+	}
+	if length > fileIndex.Size-offset {
+		length = fileIndex.Size - offset
 	}
 
-	if _, err := io.Copy(bundleFile, tmpCsvFile); err != nil {
-		return fmt.Errorf("failed to copy CSV data: %w", err)
+	if fileIndex.encoded() {
+		data, err := ix.extractEntry(fileIndex)
+		if err != nil {
+			return nil, err
+		}
+		return data[offset : offset+length], nil
 	}
 
-	// Copy raw data
-	if _, err := tmpDataFile.Seek(0, io.SeekStart); err != nil {
-		return fmt.Errorf("failed to seek data temp file: %w", err)
+	if err := checkInMemory(entryName("", fileIndex), length); err != nil {
+		return nil, err
+	}
+	if err := ix.checkRegion(fileIndex); err != nil {
+		return nil, err
+	}
+	data := make([]byte, length)
+	if _, err := ix.reader.ReadAt(data, ix.dataOffset+fileIndex.Start+offset); err != nil {
+		return nil, fmt.Errorf("failed to read file data: %w", err)
 	}
+	return data, nil
+}
 
-	if _, err := io.Copy(bundleFile, tmpDataFile); err != nil {
-		return fmt.Errorf("failed to copy raw data: %w", err)
+// checkInMemory fails with ErrTooLarge if size bytes can't be allocated as
+// a single slice, so a huge entry doesn't overflow int on 32-bit platforms.
+func checkInMemory(name string, size int64) error {
+	if size > maxInMemorySize {
+		return fmt.Errorf("%w: %s is %d bytes, use ExtractToWriter to stream it", ErrTooLarge, name, size)
 	}
+	return nil
+}
 
+// checkRegion fails with ErrBadFormat if the data of an entry extends past
+// the data region, before a buffer for it is allocated.
+func (ix *IxTar) checkRegion(fileIndex FileIndex) error {
+	if fileIndex.Start+fileIndex.storedSize() > ix.dataSize {
+		return fmt.Errorf("%w: data of %s exceeds the data region", ErrBadFormat, entryName("", fileIndex))
+	}
 	return nil
 }
 
+// readStored reads the bytes an entry occupies in the data region.
+func (ix *IxTar) readStored(fileIndex FileIndex) ([]byte, error) {
+	if err := checkInMemory(entryName("", fileIndex), max(fileIndex.Size, fileIndex.storedSize())); err != nil {
+		return nil, err
+	}
+	if err := ix.checkRegion(fileIndex); err != nil {
+		return nil, err
+	}
+	data := make([]byte, fileIndex.storedSize())
+	if _, err := ix.reader.ReadAt(data, ix.dataOffset+fileIndex.Start); err != nil {
+		return nil, fmt.Errorf("failed to read file data: %w", err)
+	}
+
+	if ix.verify {
+		if err := checkCRC32(fileIndex, data); err != nil {
+			return nil, err
+		}
+	}
+
+	return data, nil
+}
+
+// lookup resolves a path to its index entry, without allocating for
+// bundles keyed by a built-in hash.
+func (ix *IxTar) lookup(filePath string) (FileIndex, error) {
+	var fileIndex FileIndex
+	var exists bool
+	if ix.info.Keyer != "" {
+		if ix.keyer == nil {
+			return FileIndex{}, fmt.Errorf("bundle is keyed by %q, open it WithKeyer to look up paths", ix.info.Keyer)
+		}
+		fileIndex, exists = ix.files()[ix.keyer.Key(filePath)]
+	} else if ix.low != nil {
+		var err error
+		if fileIndex, exists, err = ix.low.find(ix.reader, pathKey(ix.hasher, filePath)); err != nil {
+			return FileIndex{}, err
+		}
+	} else {
+		key := ix.hasher.hashKey(normalizePath(filePath))
+		fileIndex, exists = ix.files()[string(key[:])]
+	}
+	if !exists {
+		if ix.isDir(filePath) {
+			return FileIndex{}, fmt.Errorf("%w: %s is a directory", ErrNotRegularFile, filePath)
+		}
+		return FileIndex{}, fmt.Errorf("%w: %s", ErrFileNotFound, filePath)
+	}
+	return fileIndex, nil
+}
+
+// key returns the index key of filePath.
+func (ix *IxTar) key(filePath string) string {
+	if ix.keyer != nil {
+		return ix.keyer.Key(filePath)
+	}
+	return pathKey(ix.hasher, filePath)
+}
+
+// isDir reports whether filePath is a directory implied by the stored paths.
+func (ix *IxTar) isDir(filePath string) bool {
+	if ix.low != nil {
+		found, err := ix.low.hasDir(ix.reader, filepath.ToSlash(normalizePath(filePath)))
+		return err == nil && found
+	}
+	ix.dirsOnce.Do(func() {
+		ix.dirs = make(map[string]bool)
+		for _, fileIndex := range ix.files() {
+			for dir := path.Dir(fileIndex.Path); dir != "." && dir != "/" && !ix.dirs[dir]; dir = path.Dir(dir) {
+				ix.dirs[dir] = true
+			}
+		}
+	})
+	return ix.dirs[filepath.ToSlash(normalizePath(filePath))]
+}
+
+// LookupStreaming finds the index entry of a single file by scanning the CSV
+// index of the bundle record by record, stopping at the first match, instead
+// of loading the whole index like NewIxTar. It is meant for one-off lookups
+// in bundles with very large indexes; each call re-reads the index from the
+// start, so open the bundle with NewIxTar for repeated access. Start in the
+// returned entry is relative to the data region.
+func LookupStreaming(bundlePath, filePath string) (FileIndex, error) {
+	file, err := os.Open(bundlePath)
+	if err != nil {
+		return FileIndex{}, fmt.Errorf("failed to open bundle: %w", err)
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return FileIndex{}, fmt.Errorf("failed to stat bundle: %w", err)
+	}
+
+	header, err := readHeader(file)
+	if err != nil {
+		return FileIndex{}, err
+	}
+	if err := header.checkSize(stat.Size()); err != nil {
+		return FileIndex{}, err
+	}
+
+	hasher, err := header.keyHasher()
+	if err != nil {
+		return FileIndex{}, err
+	}
+	infoData := make([]byte, header.infoSize)
+	if _, err := file.ReadAt(infoData, headerSize+header.csvSize); err != nil {
+		return FileIndex{}, fmt.Errorf("failed to read bundle info: %w", err)
+	}
+	info, err := parseBundleInfo(infoData)
+	if err != nil {
+		return FileIndex{}, err
+	}
+	if info.Keyer != "" {
+		return FileIndex{}, fmt.Errorf("bundle is keyed by %q, open it with NewIxTar WithKeyer to look up paths", info.Keyer)
+	}
+	if header.flags&flagEncryptedIndex != 0 {
+		return FileIndex{}, fmt.Errorf("%w: the index is encrypted, open the bundle with NewIxTar WithKey", ErrKeyRequired)
+	}
+
+	reader := csv.NewReader(bufio.NewReader(io.LimitReader(file, header.csvSize)))
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+
+	hash := pathKey(hasher, filePath)
+	// Bundles created on Windows before the separator was recorded are
+	// keyed by backslash paths, which only the stored path can confirm
+	legacyHash := hash
+	if header.flags&flagBackslashKeys == 0 {
+		legacyHash = pathKey(backslashHasher{hasher}, filePath)
+	}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return FileIndex{}, fmt.Errorf("%w: %s", ErrFileNotFound, filePath)
+		}
+		if err != nil {
+			return FileIndex{}, fmt.Errorf("failed to parse CSV: %w", err)
+		}
+		if len(record) == 0 || (record[0] != hash && record[0] != legacyHash) {
+			continue
+		}
+		_, fileIndex, err := parseCSVRecord(record)
+		if err == nil && record[0] != hash && fileIndex.Path != normalizePath(filePath) {
+			continue
+		}
+		return fileIndex, err
+	}
+}
+
+// FileMeta returns a copy of the metadata attached to a file, or nil when
+// the file is missing or has none.
+func (ix *IxTar) FileMeta(filePath string) map[string]string {
+	fileIndex, err := ix.lookup(filePath)
+	if err != nil || fileIndex.Meta == nil {
+		return nil
+	}
+	meta := make(map[string]string, len(fileIndex.Meta))
+	for k, v := range fileIndex.Meta {
+		meta[k] = v
+	}
+	return meta
+}
+
+// FileStat describes a single file stored in the bundle.
+type FileStat struct {
+	Path   string `json:"path,omitempty"` // Stored path, empty for bundles that don't store paths
+	Hash   string `json:"hash"`           // Index key derived from the path
+	Start  int64  `json:"start"`          // Start of the file data relative to the data region
+	Offset int64  `json:"offset"`         // Start of the file data relative to the bundle start
+	Size   int64  `json:"size"`           // Size of the file in bytes
+
+	Sparse      []SparseSegment `json:"sparse,omitempty"`      // Data segments of a sparse file
+	Compression string          `json:"compression,omitempty"` // "deflate" for files stored compressed
+	Encryption  string          `json:"encryption,omitempty"`  // "aes-gcm" for files stored encrypted
+}
+
+// Stat returns the index information of a single file without reading it.
+func (ix *IxTar) Stat(filePath string) (FileStat, error) {
+	fileIndex, err := ix.lookup(filePath)
+	if err != nil {
+		return FileStat{}, err
+	}
+
+	return ix.fileStat(ix.key(filePath), fileIndex), nil
+}
+
+func (ix *IxTar) fileStat(hash string, fileIndex FileIndex) FileStat {
+	return FileStat{
+		Path:   fileIndex.Path,
+		Hash:   hash,
+		Start:  fileIndex.Start,
+		Offset: ix.dataOffset + fileIndex.Start,
+		Size:   fileIndex.Size,
+		Sparse: fileIndex.Sparse,
+
+		Compression: fileIndex.Compression,
+		Encryption:  fileIndex.Encryption,
+	}
+}
+
+// Entries returns index information for every file, ordered by offset.
+// Entries at the same offset, such as empty files, are ordered by hash.
+func (ix *IxTar) Entries() []FileStat {
+	hashes := ix.entriesByOffset()
+	entries := make([]FileStat, 0, len(hashes))
+	for _, hash := range hashes {
+		entries = append(entries, ix.fileStat(hash, ix.files()[hash]))
+	}
+	return entries
+}
+
+// ExtractNth returns the content of the i-th file in the order of Entries,
+// so scanning positions 0 to Len()-1 reads the data region front to back.
+// The order is fixed for a given bundle.
+func (ix *IxTar) ExtractNth(i int) ([]byte, error) {
+	if err := ix.loadFiles(); err != nil {
+		return nil, err
+	}
+	hashes := ix.entriesByOffset()
+	if i < 0 || i >= len(hashes) {
+		return nil, fmt.Errorf("%w: no file at position %d of %d", ErrFileNotFound, i, len(hashes))
+	}
+	return ix.extractEntry(ix.files()[hashes[i]])
+}
+
+// ExtractByOffset returns the content of the file whose data starts at
+// start, relative to the data region like FileStat.Start. This tells apart
+// files whose paths collide. If several entries start there, e.g. empty
+// files, the first in the order of Entries is returned.
+func (ix *IxTar) ExtractByOffset(start int64) ([]byte, error) {
+	if err := ix.loadFiles(); err != nil {
+		return nil, err
+	}
+	hashes := ix.entriesByOffset()
+	i := sort.Search(len(hashes), func(i int) bool { return ix.files()[hashes[i]].Start >= start })
+	if i == len(hashes) || ix.files()[hashes[i]].Start != start {
+		return nil, fmt.Errorf("%w: no file at offset %d", ErrFileNotFound, start)
+	}
+	return ix.extractEntry(ix.files()[hashes[i]])
+}
+
+// ExtractByHash returns the content of the file with the given index key, as
+// returned by ListFiles, without knowing its path. In bundles keyed by a
+// built-in hash the key must be a HashLen character hash.
+func (ix *IxTar) ExtractByHash(hash string) ([]byte, error) {
+	if ix.info.Keyer == "" && len(hash) != HashLen {
+		return nil, fmt.Errorf("invalid hash %q: expected %d characters", hash, HashLen)
+	}
+	fileIndex, exists := ix.files()[hash]
+	if !exists {
+		return nil, fmt.Errorf("%w: no file with hash %s", ErrFileNotFound, hash)
+	}
+	return ix.extractEntry(fileIndex)
+}
+
+// BundleStats summarizes the contents of a bundle.
+type BundleStats struct {
+	FileCount  int   `json:"file_count"`  // Number of indexed files
+	CSVSize    int64 `json:"csv_size"`    // Size of the CSV index in bytes
+	TotalBytes int64 `json:"total_bytes"` // Sum of all file sizes
+
+	LogicalBytes int64 `json:"logical_bytes"` // Sum of all file sizes, same as TotalBytes
+	StoredBytes  int64 `json:"stored_bytes"`  // Bytes the entries occupy, without sparse holes
+	UniqueBytes  int64 `json:"unique_bytes"`  // StoredBytes counting entries sharing data once
+
+	// Entries of the source tree by type, as recorded at creation. Only
+	// regular files are stored; the others are counted so the tree can be
+	// described. They are zero for bundles that don't record them, such as
+	// those from a Builder.
+	RegularFiles int `json:"regular_files"` // Same as FileCount
+	Directories  int `json:"directories"`
+	Symlinks     int `json:"symlinks"`
+	Other        int `json:"other"` // Devices, FIFOs and sockets
+}
+
+// CompressionRatio returns LogicalBytes/StoredBytes, which is above 1.0 when
+// sparse holes (or other encodings) save space, and 1.0 for an empty bundle.
+func (s BundleStats) CompressionRatio() float64 {
+	if s.StoredBytes == 0 {
+		return 1
+	}
+	return float64(s.LogicalBytes) / float64(s.StoredBytes)
+}
+
+// DedupRatio returns StoredBytes/UniqueBytes, which is above 1.0 when
+// entries share data, and 1.0 for an empty bundle.
+func (s BundleStats) DedupRatio() float64 {
+	if s.UniqueBytes == 0 {
+		return 1
+	}
+	return float64(s.StoredBytes) / float64(s.UniqueBytes)
+}
+
+// Stats returns summary information computed from the index.
+func (ix *IxTar) Stats() BundleStats {
+	stats := BundleStats{
+		FileCount:    len(ix.files()),
+		CSVSize:      ix.csvSize,
+		RegularFiles: len(ix.files()),
+	}
+	if entries := ix.info.Entries; entries != nil {
+		stats.Directories, stats.Symlinks, stats.Other = entries.Directories, entries.Symlinks, entries.Other
+	}
+	type region struct{ start, size int64 }
+	seen := make(map[region]bool, len(ix.files()))
+	for _, fileIndex := range ix.files() {
+		stored := fileIndex.storedSize()
+		stats.TotalBytes += fileIndex.Size
+		stats.StoredBytes += stored
+		if r := (region{fileIndex.Start, stored}); !seen[r] {
+			seen[r] = true
+			stats.UniqueBytes += stored
+		}
+	}
+	stats.LogicalBytes = stats.TotalBytes
+	return stats
+}
+
+// ListFiles returns the hashes of all files in the bundle, sorted.
+func (ix *IxTar) ListFiles() []string {
+	files := make([]string, 0, len(ix.files()))
+	for hash := range ix.files() {
+		files = append(files, hash)
+	}
+	sort.Strings(files)
+	return files
+}
+
+// ListPaths returns the stored paths of all files in the bundle, sorted.
+// Entries of bundles that don't store paths are omitted.
+func (ix *IxTar) ListPaths() []string {
+	paths := make([]string, 0, len(ix.files()))
+	for _, fileIndex := range ix.files() {
+		if fileIndex.Path != "" {
+			paths = append(paths, fileIndex.Path)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// ListUnder returns the stored paths at or below prefix, sorted. The prefix
+// is cleaned and matched on directory boundaries, so "assets/js" matches
+// "assets/js/app.js" but not "assets/jsx/app.js". An empty prefix or "."
+// matches every path.
+func (ix *IxTar) ListUnder(prefix string) []string {
+	prefix = path.Clean(filepath.ToSlash(prefix))
+	if prefix == "." {
+		return ix.ListPaths()
+	}
+
+	paths := make([]string, 0)
+	for _, fileIndex := range ix.files() {
+		p := fileIndex.Path
+		if p == prefix || strings.HasPrefix(p, prefix) && p[len(prefix)] == '/' {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// Groups returns the stored paths of all files grouped by their first path
+// component, each group sorted. Files at the root are grouped under "".
+// Entries of bundles that don't store paths are omitted.
+func (ix *IxTar) Groups() map[string][]string {
+	groups := make(map[string][]string)
+	for _, fileIndex := range ix.files() {
+		p := fileIndex.Path
+		if p == "" {
+			continue
+		}
+		top, _, found := strings.Cut(p, "/")
+		if !found {
+			top = ""
+		}
+		groups[top] = append(groups[top], p)
+	}
+	for _, paths := range groups {
+		sort.Strings(paths)
+	}
+	return groups
+}
+
+// BundleLayout describes where the sections of a bundle are located. All
+// offsets are relative to the start of the bundle. TrailerSize is zero for
+// bundles created without a trailer index.
+type BundleLayout struct {
+	HeaderSize    int64 `json:"header_size"`
+	CSVOffset     int64 `json:"csv_offset"`
+	CSVSize       int64 `json:"csv_size"`
+	InfoOffset    int64 `json:"info_offset"`
+	InfoSize      int64 `json:"info_size"`
+	DataOffset    int64 `json:"data_offset"`
+	DataSize      int64 `json:"data_size"`
+	TrailerOffset int64 `json:"trailer_offset"`
+	TrailerSize   int64 `json:"trailer_size"`
+	TotalSize     int64 `json:"total_size"`
+}
+
+// Layout returns the section offsets of the bundle as read from its header.
+func (ix *IxTar) Layout() BundleLayout {
+	return BundleLayout{
+		HeaderSize:    headerSize,
+		CSVOffset:     headerSize,
+		CSVSize:       ix.csvSize,
+		InfoOffset:    headerSize + ix.csvSize,
+		InfoSize:      int64(ix.header.infoSize),
+		DataOffset:    ix.dataOffset,
+		DataSize:      ix.dataSize,
+		TrailerOffset: ix.dataOffset + ix.dataSize,
+		TrailerSize:   ix.bundleSize - ix.dataOffset - ix.dataSize,
+		TotalSize:     ix.bundleSize,
+	}
+}
+
+// RawIndex returns the CSV index exactly as it is stored in the bundle, for
+// processing with tools other than this package, or decrypted if it is
+// encrypted. The index is read again on each call rather than kept in memory
+// after parsing.
+func (ix *IxTar) RawIndex() ([]byte, error) {
+	if err := checkInMemory("CSV index", ix.csvSize); err != nil {
+		return nil, err
+	}
+	data := make([]byte, ix.csvSize)
+	if _, err := ix.reader.ReadAt(data, headerSize); err != nil {
+		return nil, fmt.Errorf("failed to read CSV data: %w", err)
+	}
+	return decryptIndex(ix.header, ix.aead, data)
+}
+
+// DataReader returns a reader over the whole data region of the bundle, for
+// tooling that wants to process the payload sequentially without the index.
+// The data region is the raw file contents back to back, not a tar stream.
+// The reader uses ReadAt and does not disturb other reads from ix.
+func (ix *IxTar) DataReader() *io.SectionReader {
+	return io.NewSectionReader(ix.reader, ix.dataOffset, ix.dataSize)
+}
+
+// CreatedAt returns when the bundle was created, or the zero time for
+// bundles that don't record it.
+func (ix *IxTar) CreatedAt() time.Time {
+	if ix.header.created == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, ix.header.created)
+}
+
+// CreatorVersion returns the ixtar version that created the bundle, or ""
+// for bundles that don't record it.
+func (ix *IxTar) CreatorVersion() string {
+	return ix.info.Creator
+}
+
+// Version returns the format version of the bundle. Bundles without a
+// header have version 0.0. A minor version newer than this package writes
+// means the bundle may carry optional data, such as extra index columns,
+// which is ignored.
+func (ix *IxTar) Version() (major, minor int) {
+	return int(ix.header.version), ix.info.FormatMinor
+}
+
+// SupportsRandomAccess reports whether files are read straight from the
+// bundle source, so any file can be read without reading anything else. It
+// is false for a bundle gzip-compressed as a whole, which NewIxTar had to
+// decompress into a temporary copy before anything could be read; tools
+// that open bundles often should keep them uncompressed or use per-file
+// compression, which keeps random access.
+func (ix *IxTar) SupportsRandomAccess() bool {
+	return ix.tempPath == ""
+}
+
+// HashAlgorithm returns the path hash algorithm of the bundle's index.
+func (ix *IxTar) HashAlgorithm() HashAlgorithm {
+	return ix.header.hashAlg
+}
+
+// KeyerID returns the ID of the custom Keyer the bundle was created with, or
+// the name of its hash algorithm.
+func (ix *IxTar) KeyerID() string {
+	if ix.info.Keyer != "" {
+		return ix.info.Keyer
+	}
+	return ix.header.hashAlg.String()
+}
+
+// Metadata returns a copy of the bundle-wide metadata given at creation.
+func (ix *IxTar) Metadata() map[string]string {
+	metadata := make(map[string]string, len(ix.info.Metadata))
+	for k, v := range ix.info.Metadata {
+		metadata[k] = v
+	}
+	return metadata
+}
+
+func (ix *IxTar) Info() (fileCount int, csvSizeBytes int64) {
+	return ix.fileCount(), ix.csvSize
+}
+
+// Len returns the number of files in the bundle.
+func (ix *IxTar) Len() int {
+	return ix.fileCount()
+}
+
+// ExtractOptions controls ExtractAllWithOptions.
+type ExtractOptions struct {
+	// StripComponents removes this many leading path elements from each
+	// stored path. Files with no elements left are skipped, like tar does.
+	StripComponents int
+	// ContinueOnError collects the errors of files that can't be read or
+	// written in ExtractResult.Errors and goes on with the next file,
+	// instead of stopping at the first one. Files that fail are removed.
+	ContinueOnError bool
+	// Concurrency is the number of files written at once, each goroutine
+	// reading through its own buffer. 0 or 1 writes them one by one in
+	// offset order. With more, ExtractResult.Errors is in no particular
+	// order, and bundles opened with NewIxTarFromStream are refused.
+	Concurrency int
+}
+
+// ExtractResult summarizes an ExtractAllWithOptions run.
+type ExtractResult struct {
+	Files   int     // Number of files written
+	Bytes   int64   // Total size of the written files
+	Skipped int     // Files left out because StripComponents left no path
+	Errors  []error // Files that failed with ContinueOnError, one error each
+}
+
+func (ix *IxTar) ExtractAll(outputDir string) error {
+	_, err := ix.ExtractAllWithOptions(outputDir, ExtractOptions{})
+	return err
+}
+
+// ExtractAllWithOptions writes every file in the bundle below outputDir and
+// reports what was written. Files are written under their stored path, or
+// under their hash for bundles that do not store paths. Paths that would
+// resolve outside outputDir are rejected. The result is returned with
+// errors too, counting the files written before the error.
+func (ix *IxTar) ExtractAllWithOptions(outputDir string, opts ExtractOptions) (*ExtractResult, error) {
+	result := &ExtractResult{}
+	if opts.StripComponents < 0 {
+		return result, fmt.Errorf("invalid strip components: %d", opts.StripComponents)
+	}
+	if opts.Concurrency < 0 {
+		return result, fmt.Errorf("invalid concurrency: %d", opts.Concurrency)
+	}
+	if _, ok := ix.reader.(*streamReaderAt); ok && opts.Concurrency > 1 {
+		return result, fmt.Errorf("concurrent extraction needs a bundle that can be read at any offset")
+	}
+
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return result, fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	var mu sync.Mutex // guards result
+	fail := func(err error) error {
+		if !opts.ContinueOnError {
+			return err
+		}
+		mu.Lock()
+		result.Errors = append(result.Errors, err)
+		mu.Unlock()
+		return nil
+	}
+
+	dirs := &dirCache{made: make(map[string]bool)}
+	extract := func(entry FileStat, r io.Reader, err error) error {
+		if err != nil {
+			return fail(err)
+		}
+
+		name := entry.Path
+		if name == "" {
+			name = entry.Hash
+		} else {
+			parts := strings.Split(entry.Path, "/")
+			if len(parts) <= opts.StripComponents {
+				mu.Lock()
+				result.Skipped++
+				mu.Unlock()
+				return nil
+			}
+			name = strings.Join(parts[opts.StripComponents:], "/")
+		}
+
+		outputPath, err := safeJoin(outputDir, filepath.FromSlash(name))
+		if err != nil {
+			return fail(err)
+		}
+
+		if err := writeLocalFile(dirs, outputPath, r, entry); err != nil {
+			return fail(err)
+		}
+		mu.Lock()
+		result.Files++
+		result.Bytes += entry.Size
+		mu.Unlock()
+		return nil
+	}
+
+	var err error
+	if opts.Concurrency > 1 {
+		err = ix.walkFilesConcurrently(opts.Concurrency, extract)
+	} else {
+		err = ix.walkFiles(extract)
+	}
+	return result, err
+}
+
+// dirCache creates directories for extracted files, each only once even
+// when files are written concurrently.
+type dirCache struct {
+	mu   sync.Mutex
+	made map[string]bool
+}
+
+// mkdirAll is os.MkdirAll, skipping directories already made. A nil cache
+// always calls os.MkdirAll.
+func (c *dirCache) mkdirAll(dir string) error {
+	if c == nil {
+		return os.MkdirAll(dir, 0755)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.made[dir] {
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	c.made[dir] = true
+	return nil
+}
+
+// ExtractAllTo streams every file to write in offset order, for callers
+// that store files somewhere other than the local filesystem. name is the
+// stored path, or the hash for bundles that don't store paths. r is only
+// valid until write returns.
+func (ix *IxTar) ExtractAllTo(write func(name string, r io.Reader, entry FileStat) error) error {
+	return ix.WalkFiles(func(entry FileStat, r io.Reader) error {
+		name := entry.Path
+		if name == "" {
+			name = entry.Hash
+		}
+		return write(name, r, entry)
+	})
+}
+
+// writeLocalFile writes r to outputPath, creating parent directories
+// through dirs, which may be nil. Sparse files get their holes back.
+func writeLocalFile(dirs *dirCache, outputPath string, r io.Reader, entry FileStat) error {
+	if err := dirs.mkdirAll(filepath.Dir(outputPath)); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", outputPath, err)
+	}
+
+	outputFile, err := os.Create(outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to create output file %s: %w", outputPath, err)
+	}
+
+	if entry.Sparse != nil {
+		var data []byte
+		data, err = io.ReadAll(r)
+		if err == nil {
+			err = writeSparseFile(outputFile, data, entry.Sparse, entry.Size)
+		}
+	} else {
+		_, err = io.Copy(outputFile, r)
+	}
+	if err != nil {
+		outputFile.Close()
+		os.Remove(outputPath)
+		return fmt.Errorf("failed to write file %s: %w", outputPath, err)
+	}
+	return outputFile.Close()
+}
+
+// safeJoin joins name onto dir and fails if the result escapes dir.
+func safeJoin(dir, name string) (string, error) {
+	if filepath.IsAbs(name) {
+		return "", fmt.Errorf("refusing to extract absolute path: %s", name)
+	}
+	joined := filepath.Join(dir, name)
+	rel, err := filepath.Rel(dir, joined)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("refusing to extract outside destination: %s", name)
+	}
+	return joined, nil
+}
+
+// entriesByOffset returns the index hashes ordered by their start offset.
+// The order is computed once; callers must not modify the slice. It is
+// empty while loadFiles fails.
+func (ix *IxTar) entriesByOffset() []string {
+	if ix.loadFiles() != nil {
+		return nil
+	}
+	ix.orderOnce.Do(func() {
+		hashes := make([]string, 0, len(ix.files()))
+		for hash := range ix.files() {
+			hashes = append(hashes, hash)
+		}
+		sort.Slice(hashes, func(i, j int) bool {
+			a, b := ix.files()[hashes[i]], ix.files()[hashes[j]]
+			if a.Start != b.Start {
+				return a.Start < b.Start
+			}
+			return hashes[i] < hashes[j]
+		})
+		ix.order = hashes
+	})
+	return ix.order
+}
+
+// Validate checks that every index entry points inside the data region and
+// that no two entries overlap. All problems found are joined into the
+// returned error.
+func (ix *IxTar) Validate() error {
+	if err := ix.loadFiles(); err != nil {
+		return err
+	}
+	dataSize := ix.dataSize
+
+	var errs []error
+	prevEnd := int64(0)
+	prevHash := ""
+	for _, hash := range ix.entriesByOffset() {
+		fileIndex := ix.files()[hash]
+		end := fileIndex.Start + fileIndex.storedSize()
+		switch {
+		case fileIndex.Start < 0 || fileIndex.Size < 0:
+			errs = append(errs, fmt.Errorf("%s: negative start or size", entryName(hash, fileIndex)))
+		case end > dataSize:
+			errs = append(errs, fmt.Errorf("%s: region %d-%d exceeds data size %d", entryName(hash, fileIndex), fileIndex.Start, end, dataSize))
+		case fileIndex.Start < prevEnd:
+			errs = append(errs, fmt.Errorf("%s: overlaps %s", entryName(hash, fileIndex), prevHash))
+		}
+		if end > prevEnd {
+			prevEnd = end
+			prevHash = hash
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// VerifyOptions controls VerifyAllWithOptions.
+type VerifyOptions struct {
+	// Workers is the number of goroutines computing checksums while the
+	// files are read sequentially. 0 means runtime.GOMAXPROCS(0).
+	Workers int
+	// Logger receives every problem found at Warn and a summary at Info.
+	// Nil logs nothing.
+	Logger *slog.Logger
+}
+
+// maxParallelVerifySize is the largest file VerifyAllWithOptions buffers for
+// a worker; bigger files are streamed and hashed by the reading goroutine.
+const maxParallelVerifySize = 8 << 20
+
+// VerifyAll runs Validate and then reads every file in offset order to make
+// sure its data is actually present and matches its stored CRC32, if any.
+func (ix *IxTar) VerifyAll() error {
+	return ix.VerifyAllWithOptions(VerifyOptions{})
+}
+
+// VerifyAllWithOptions is VerifyAll with a configurable number of checksum
+// workers. Files are read in offset order by a single goroutine and hashed in
+// parallel. Every problem found is collected; the returned error joins them
+// in offset order.
+func (ix *IxTar) VerifyAllWithOptions(opts VerifyOptions) error {
+	workers := opts.Workers
+	if workers < 0 {
+		return fmt.Errorf("invalid worker count: %d", workers)
+	}
+	if workers == 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	logger := orDiscard(opts.Logger)
+
+	if err := ix.Validate(); err != nil {
+		logger.Warn("invalid index", "error", err)
+		return err
+	}
+
+	hashes := ix.entriesByOffset()
+	errs := make([]error, len(hashes))
+
+	type verifyJob struct {
+		i    int
+		data []byte
+	}
+	jobs := make(chan verifyJob)
+	free := make(chan []byte, 2*workers)
+	for i := 0; i < cap(free); i++ {
+		free <- nil
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				fileIndex := ix.files()[hashes[job.i]]
+				errs[job.i] = checkCRC32(fileIndex, job.data)
+				free <- job.data
+			}
+		}()
+	}
+
+	for i, hash := range hashes {
+		fileIndex := ix.files()[hash]
+		size := fileIndex.storedSize()
+		off := ix.dataOffset + fileIndex.Start
+
+		if size > maxParallelVerifySize {
+			sum := crc32.NewIEEE()
+			if _, err := io.Copy(sum, io.NewSectionReader(ix.reader, off, size)); err != nil {
+				errs[i] = fmt.Errorf("%s: %w", entryName(hash, fileIndex), err)
+			} else if fileIndex.CRC32 != "" {
+				errs[i] = compareCRC32(fileIndex, sum.Sum32())
+			}
+			continue
+		}
+
+		buf := <-free
+		if int64(cap(buf)) < size {
+			buf = make([]byte, size)
+		}
+		buf = buf[:size]
+		if n, err := ix.reader.ReadAt(buf, off); n < len(buf) {
+			errs[i] = fmt.Errorf("%s: %w", entryName(hash, fileIndex), err)
+			free <- buf
+			continue
+		}
+		jobs <- verifyJob{i: i, data: buf}
+	}
+	close(jobs)
+	wg.Wait()
+
+	failed := 0
+	for _, err := range errs {
+		if err != nil {
+			logger.Warn("verify mismatch", "error", err)
+			failed++
+		}
+	}
+	logger.Info("verified files", "files", len(hashes), "failed", failed)
+	return errors.Join(errs...)
+}
+
+// entryName returns the stored path of an entry, or its hash when the
+// bundle does not store paths.
+func entryName(hash string, fileIndex FileIndex) string {
+	if fileIndex.Path != "" {
+		return fileIndex.Path
+	}
+	return hash
+}
+
+type ProgressCallback func(current, total int, filename string)
+
+// AbortableProgressCallback is a ProgressCallback that can stop creation:
+// returning an error aborts it with that error, cleaning up like any other
+// failure.
+type AbortableProgressCallback func(current, total int, filename string) error
+
+// abortable adapts a ProgressCallback, which never aborts.
+func (p ProgressCallback) abortable() AbortableProgressCallback {
+	if p == nil {
+		return nil
+	}
+	return func(current, total int, filename string) error {
+		p(current, total, filename)
+		return nil
+	}
+}
+
+// progressInterval is how often create reports progress between the
+// calls every 1000 files.
+const progressInterval = 100 * time.Millisecond
+
+func CreateBundle(sourceDir, bundlePath string) error {
+	return CreateBundleWithProgress(sourceDir, bundlePath, nil)
+}
+
+func CreateBundleWithProgress(sourceDir, bundlePath string, progress ProgressCallback) error {
+	_, err := CreateBundleWithOptions(sourceDir, bundlePath, CreateOptions{Progress: progress})
+	return err
+}
+
+// maxMetadataSize bounds the encoded size of CreateOptions.Metadata.
+const maxMetadataSize = 64 * 1024
+
+// defaultCopyBufferSize is the default of CreateOptions.CopyBufferSize.
+const defaultCopyBufferSize = 32 * 1024
+
+// dataBufferSize is the size of the write buffer in front of the temporary
+// data file during creation.
+const dataBufferSize = 1 << 20
+
+// createTemp creates the staging files of CreateBundleWithOptions. Tests
+// replace it to inject write errors.
+var createTemp = os.CreateTemp
+
+// stagingWriter remembers the first error writing the staged data, so it
+// isn't mistaken for an error reading a source file.
+type stagingWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (s *stagingWriter) Write(p []byte) (int, error) {
+	n, err := s.w.Write(p)
+	if err != nil && s.err == nil {
+		s.err = err
+	}
+	return n, err
+}
+
+// CreateOptions configures CreateBundleWithOptions.
+type CreateOptions struct {
+	// Progress is called periodically while files are added, at least
+	// every 1000 files, and once more after the last file.
+	Progress ProgressCallback
+	// AbortableProgress replaces Progress with a callback whose errors
+	// abort creation, e.g. when the user presses Ctrl-C. Like any failure,
+	// this leaves an existing bundle at the output path as it was.
+	AbortableProgress AbortableProgressCallback
+	// Metadata is stored with the bundle and returned by IxTar.Metadata.
+	// Its JSON encoding must not exceed 64KB.
+	Metadata map[string]string
+	// ContentTypes maps file extensions such as ".wasm" to the content type
+	// IxTar.ContentType reports for them, ahead of the system MIME table.
+	// It shares the 64KB limit with Metadata.
+	ContentTypes map[string]string
+	// CopyBufferSize is the buffer used to copy file data. Zero means the
+	// 32KB default; larger buffers help bundles of large files.
+	CopyBufferSize int
+	// SpecialFiles decides what happens to devices, FIFOs and sockets,
+	// which can't be bundled.
+	SpecialFiles SpecialFilePolicy
+	// FollowSymlinks stores the target of a symlink under the link's name
+	// instead of leaving the link out: the content of a file, or the tree
+	// of a directory. A dangling link, or a link back to a directory it is
+	// in, which would loop forever, is an unreadable entry that fails
+	// creation or is skipped with ContinueOnError.
+	FollowSymlinks bool
+	// BaseDir is the directory stored paths are relative to. It must
+	// contain sourceDir; empty means sourceDir itself.
+	BaseDir string
+	// DetectCaseCollisions fails creation when two paths differ only in
+	// case, since extracting them on a case-insensitive filesystem would
+	// overwrite one with the other.
+	DetectCaseCollisions bool
+	// SanitizeNames replaces NUL and other control characters in stored
+	// paths with underscores. Without it such a path fails creation. A
+	// replaced path that equals another stored path fails creation too.
+	SanitizeNames bool
+	// ContinueOnError skips files and directories that can't be read, e.g.
+	// because of permissions, instead of failing creation. They are counted
+	// in CreateResult.SkippedErrors.
+	ContinueOnError bool
+	// OnError is called for every entry skipped by ContinueOnError.
+	OnError func(path string, err error)
+	// Logger receives what creation does: skipped entries with the reason
+	// at Debug (hidden, ignored, filtered), Info (symlinks, special files)
+	// or Warn (read errors, shrunk files), and the files indexed at Info.
+	// Nil logs nothing.
+	Logger *slog.Logger
+	// IgnoreFile is a file of .gitignore-style patterns excluding paths
+	// relative to sourceDir. Empty means sourceDir/.ixtarignore if present.
+	IgnoreFile string
+	// DryRun walks sourceDir applying all of the above and fills the
+	// result, including Paths, without reading file data or writing the
+	// bundle. Files that can't be opened are still detected.
+	DryRun bool
+	// Trailer appends a copy of the CSV index after the data, followed by a
+	// footer with its own magic, so the index can also be found by reading
+	// backwards from the end of the bundle.
+	Trailer bool
+	// SkipHidden leaves out files and directories whose name starts with a
+	// dot, such as .git and .DS_Store, along with everything below hidden
+	// directories. The source directory itself is always walked.
+	SkipHidden bool
+	// Filter is called for every file and directory below the source
+	// directory that isn't hidden or ignored, with its path as passed to
+	// filepath.Walk. Returning filepath.SkipDir leaves out a directory with
+	// everything below it, or a single file; filepath.SkipAll stops adding
+	// files; any other error aborts creation. Filter is also called while
+	// files are counted, for Progress and for bundles written in place, so
+	// it should have no side effects.
+	Filter func(path string, info os.FileInfo) error
+	// ModifiedAfter, if not zero, leaves out files whose modification time
+	// isn't after it, for incremental bundles of what changed since an
+	// earlier one. Directories are still walked. The files left out are
+	// counted in CreateResult.SkippedOlder.
+	ModifiedAfter time.Time
+	// HashAlgorithm selects the path hash of the index. The zero value is
+	// HashMD5; HashXXH64 is faster for bundles with very many paths.
+	HashAlgorithm HashAlgorithm
+	// Compress reports whether the file at a stored path is stored DEFLATE
+	// compressed. Reads decompress such files transparently. Nil stores all
+	// files as they are; empty and sparse files are never compressed.
+	Compress func(path string) bool
+	// Transform replaces the content of the regular file at a stored path
+	// with what the returned reader yields, e.g. to minify or strip
+	// metadata. The reader is read to EOF and the index records its
+	// length, since the index is written after the data; nothing is
+	// buffered and the file isn't read twice. Transformed files are
+	// stored densely and compressed if Compress says so and the source
+	// file isn't empty. An error skips the file with ContinueOnError and
+	// fails creation otherwise. DryRun doesn't call it.
+	Transform func(path string, r io.Reader) (io.Reader, error)
+	// IndexCallback is called with the stored path, the index key and the
+	// index record of every file as it is added to the index, e.g. to
+	// build a secondary index or a manifest without reading the bundle
+	// back. Files are reported in the order their data is stored, Start
+	// being relative to the data region. Files added before the checkpoint
+	// a create resumes from aren't reported again, and DryRun doesn't call
+	// it.
+	IndexCallback func(path, hash string, fi FileIndex)
+	// Encryption encrypts the content of every file with AES-GCM under a
+	// fresh random nonce, after compression. Each file is sealed on its
+	// own, so files are still read individually, but a file is held in
+	// memory while it is added and whenever it is read, and is stored
+	// densely. Paths and sizes in the index stay readable. Reading the
+	// files needs NewIxTar WithKey.
+	Encryption *Encryption
+	// TempDir is where the index is staged before the bundle is assembled.
+	// CreateBundleToWriter, custom keyers and bundle paths that aren't
+	// regular files stage the data there too, which needs about as much
+	// space as the bundle. Empty means the directory of the bundle, or the
+	// system temp directory for CreateBundleToWriter.
+	TempDir string
+	// Checkpoint makes the create resumable. Every 1000 files, and when
+	// creation fails, the partial bundle file and the index staged at
+	// Checkpoint plus ".csv" are synced and the amount of each that is
+	// complete is saved to the file at Checkpoint. If that file exists when
+	// creation starts, the partial file is kept instead of recreated, cut
+	// back to the checkpoint, and the files it already holds are skipped,
+	// so the create continues where it stopped; the source directory and
+	// the options must be the same. The files are removed once the bundle
+	// is complete. It needs a bundle written in place with a built-in hash,
+	// not DryRun. The result of a resumed create counts the files added
+	// before it was interrupted, but not what was skipped then.
+	Checkpoint string
+	// Keyer replaces the path hash with custom keys. Its ID is stored in
+	// the bundle, which then needs WithKeyer for lookups by path. It can't
+	// be combined with HashAlgorithm.
+	Keyer Keyer
+	// PathSeparator is the separator of the paths the index keys are
+	// hashed from: '/', the default when zero, or '\\', which is how
+	// bundles created on Windows were keyed before the separator was
+	// fixed. Stored paths and lookups use forward slashes either way and
+	// the choice is recorded in the header, so lookups agree on every OS.
+	// It can't be combined with a custom Keyer.
+	PathSeparator rune
+}
+
+// SpecialFilePolicy decides how creation treats special files.
+type SpecialFilePolicy int
+
+const (
+	// SkipSpecial leaves special files out and counts them in
+	// CreateResult.SkippedSpecial.
+	SkipSpecial SpecialFilePolicy = iota
+	// ErrorOnSpecial fails creation on the first special file.
+	ErrorOnSpecial
+)
+
+// CreateResult summarizes a created bundle.
+type CreateResult struct {
+	Files           int   // Number of files added to the bundle
+	Bytes           int64 // Total size of the added files
+	SkippedSpecial  int   // Devices, FIFOs and sockets left out
+	SkippedSymlinks int   // Symbolic links left out
+	SkippedErrors   int   // Unreadable entries left out with ContinueOnError
+	SkippedIgnored  int   // Files and directories excluded by the ignore file
+	SkippedHidden   int   // Hidden files and directories left out with SkipHidden
+	SkippedFiltered int   // Files and directories left out by Filter
+	SkippedOlder    int   // Files not modified after ModifiedAfter
+	Directories     int   // Directories below sourceDir that were walked
+
+	// Paths lists the stored paths of the files that would be added, in
+	// walk order. Only filled with DryRun.
+	Paths []string
+	// sources are the source files of Paths, for UpdateBundle.
+	sources []string
+
+	// EstimatedSize is an upper bound of the size of the bundle that would
+	// be written. Only filled with DryRun.
+	EstimatedSize int64
+
+	// Shrunk lists files that got shorter between being listed and being
+	// read, e.g. because another process truncated them. They are stored
+	// with the bytes that could still be read.
+	Shrunk []string
+}
+
+func CreateBundleWithOptions(sourceDir, bundlePath string, opts CreateOptions) (*CreateResult, error) {
+	inPlacePath := ""
+	if canWriteInPlace(bundlePath) {
+		inPlacePath = bundlePath
+	}
+	return createBundle(sourceDir, filepath.Dir(bundlePath), inPlacePath, opts, func(header bundleHeader, csvData io.ReadSeeker, infoData []byte, data io.Reader) error {
+		return writeBundleFile(bundlePath, header, csvData, infoData, data)
+	})
+}
+
+// CreateBundleToWriter writes a bundle of sourceDir to w, which doesn't need
+// to be seekable, e.g. a pipe or a network connection. The header and index
+// come before the data, so the data and index are staged in temporary files
+// first, in CreateOptions.TempDir or else the system temp directory; nothing
+// is written to w until the source directory has been read. Write errors of
+// w are returned. w is not closed.
+func CreateBundleToWriter(sourceDir string, w io.Writer, opts CreateOptions) (*CreateResult, error) {
+	return createBundle(sourceDir, os.TempDir(), "", opts, func(header bundleHeader, csvData io.ReadSeeker, infoData []byte, data io.Reader) error {
+		return writeBundle(w, header, csvData, infoData, data)
+	})
+}
+
+// EstimateBundleSize returns how many bytes the bundle of sourceDir created
+// with opts would take, without reading file data or writing anything. It
+// walks sourceDir like a dry run, so it is as expensive as listing the
+// files. The result is an upper bound: files that Compress selects are
+// counted at their size plus the worst-case DEFLATE overhead, sparse files
+// at their full size, and the index with every start as long as the
+// largest one. Transform isn't called, so transformed files are counted at
+// their source size.
+func EstimateBundleSize(sourceDir string, opts CreateOptions) (int64, error) {
+	opts.DryRun = true
+	opts.Progress, opts.AbortableProgress = nil, nil
+	result, err := CreateBundleToWriter(sourceDir, io.Discard, opts)
+	if err != nil {
+		return 0, err
+	}
+	return result.EstimatedSize, nil
+}
+
+// createBundle stages the data and index of sourceDir in defaultTempDir,
+// unless opts.TempDir is set, and passes them to assemble. If inPlacePath is
+// set and the bundle uses a built-in hash, the data is written straight into
+// a partial bundle file next to inPlacePath instead, which is renamed over
+// it when done, and only the index is staged.
+func createBundle(sourceDir, defaultTempDir, inPlacePath string, opts CreateOptions, assemble func(header bundleHeader, csvData io.ReadSeeker, infoData []byte, data io.Reader) error) (*CreateResult, error) {
+	progress := opts.AbortableProgress
+	if progress == nil {
+		progress = opts.Progress.abortable()
+	} else if opts.Progress != nil {
+		return nil, fmt.Errorf("Progress and AbortableProgress are mutually exclusive")
+	}
+
+	// Walking a file would visit only the root, which is never added, and
+	// give an empty bundle
+	if stat, err := os.Stat(sourceDir); err != nil {
+		return nil, fmt.Errorf("failed to stat source directory: %w", err)
+	} else if !stat.IsDir() {
+		return nil, fmt.Errorf("source %s is not a directory, add single files with a Builder", sourceDir)
+	}
+
+	copyBufferSize := opts.CopyBufferSize
+	if copyBufferSize < 0 {
+		return nil, fmt.Errorf("invalid copy buffer size: %d", copyBufferSize)
+	}
+	if copyBufferSize == 0 {
+		copyBufferSize = defaultCopyBufferSize
+	}
+	buf := make([]byte, copyBufferSize)
+
+	hashAlgorithm, keyer, err := createKeyer(opts)
+	if err != nil {
+		return nil, err
+	}
+	hasher, err := hashAlgorithm.hasher()
+	if err != nil {
+		return nil, err
+	}
+	var keyFlags uint16
+	switch opts.PathSeparator {
+	case 0, '/':
+	case '\\':
+		if keyer != nil {
+			return nil, fmt.Errorf("Keyer and PathSeparator are mutually exclusive")
+		}
+		hasher = backslashHasher{hasher}
+		keyFlags = flagBackslashKeys
+	default:
+		return nil, fmt.Errorf("invalid path separator %q", opts.PathSeparator)
+	}
+	var ckpt *checkpoint
+	if opts.Checkpoint != "" {
+		if inPlacePath == "" || keyer != nil || opts.DryRun {
+			return nil, fmt.Errorf("Checkpoint needs a bundle file written in place with a built-in hash")
+		}
+		if ckpt, err = openCheckpoint(opts.Checkpoint, inPlacePath, sourceDir); err != nil {
+			return nil, err
+		}
+	}
+
+	info := bundleInfo{Creator: "ixtar " + Version, Metadata: opts.Metadata, ContentTypes: opts.ContentTypes}
+	var seal *sealer
+	if opts.Encryption != nil {
+		// A resumed create encrypts with the key, and the salt, it started
+		// with
+		var prev *encryptionInfo
+		if ckpt != nil {
+			prev = ckpt.Encryption
+		}
+		key, encInfo, err := encryptionKey(opts.Encryption, prev)
+		if err != nil {
+			return nil, err
+		}
+		if seal, err = newSealer(key); err != nil {
+			return nil, err
+		}
+		info.Encryption = encInfo
+		keyFlags |= flagEncrypted
+		if ckpt != nil {
+			ckpt.Encryption = encInfo
+		}
+	}
+	// Custom keys -> stored path, to catch keys that aren't unique
+	var customKeys map[string]string
+	if keyer != nil {
+		info.Keyer = keyer.ID()
+		customKeys = make(map[string]string)
+	}
+
+	// The entry counts are only known after the walk, so the info block is
+	// sized and validated with the largest ones
+	info.Entries = &entryCounts{Directories: math.MaxInt, Symlinks: math.MaxInt, Other: math.MaxInt}
+	infoData, err := encodeBundleInfo(info)
+	if err != nil {
+		return nil, err
+	}
+
+	// Stored paths are relative to BaseDir, which prefixes the paths
+	// relative to sourceDir with the location of sourceDir below it
+	basePrefix := ""
+	if opts.BaseDir != "" {
+		basePrefix, err = baseDirPrefix(opts.BaseDir, sourceDir)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var ignore *ignoreMatcher
+	if opts.IgnoreFile != "" {
+		if ignore, err = loadIgnoreFile(opts.IgnoreFile); err != nil {
+			return nil, err
+		}
+	} else if ignore, err = loadIgnoreFile(filepath.Join(sourceDir, IgnoreFileName)); err != nil {
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+		ignore = nil
+	}
+
+	// Lower-cased stored path -> stored path, for DetectCaseCollisions
+	var foldedPaths map[string]string
+	if opts.DetectCaseCollisions {
+		foldedPaths = make(map[string]string)
+	}
+
+	// Stored path -> source path, for SanitizeNames
+	var sanitizedPaths map[string]string
+	if opts.SanitizeNames {
+		sanitizedPaths = make(map[string]string)
+	}
+
+	result := &CreateResult{}
+	logger := orDiscard(opts.Logger)
+
+	tempDir := opts.TempDir
+	if tempDir == "" {
+		tempDir = defaultTempDir
+	}
+	if info, err := os.Stat(tempDir); err != nil {
+		return nil, fmt.Errorf("invalid temp directory: %w", err)
+	} else if !info.IsDir() {
+		return nil, fmt.Errorf("invalid temp directory: %s is not a directory", tempDir)
+	}
+
+	// Files written by this create are left out of the walks, for when the
+	// bundle or the staging directory is inside sourceDir. So is the bundle
+	// being replaced.
+	var written []os.FileInfo
+	addWritten := func(f *os.File) {
+		if info, err := f.Stat(); err == nil {
+			written = append(written, info)
+		}
+	}
+	if inPlacePath != "" {
+		if info, err := os.Stat(inPlacePath); err == nil {
+			written = append(written, info)
+		}
+	}
+	isWritten := func(path string, info os.FileInfo) bool {
+		if ckpt != nil && ckpt.owns(path, info) {
+			return true
+		}
+		for _, w := range written {
+			if os.SameFile(info, w) {
+				return true
+			}
+		}
+		return false
+	}
+
+	// A dry run bounds the size of the bundle it would write
+	estimate := newSizeEstimate()
+
+	// The data goes into the bundle file or a temporary file, created up
+	// front to check that it can be written before any work is done
+	var inPlace *inPlaceOutput
+	var dataFile *os.File
+	if inPlacePath != "" && keyer == nil && !opts.DryRun {
+		if ckpt != nil && ckpt.resume {
+			inPlace, err = ckpt.openBundle()
+		} else {
+			inPlace, err = createInPlace(inPlacePath)
+		}
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			if inPlace.file == nil {
+				return
+			}
+			inPlace.file.Close()
+			// A checkpoint resumes from the partial file
+			if ckpt == nil {
+				os.Remove(inPlace.file.Name())
+			}
+		}()
+		if ckpt != nil {
+			ckpt.Partial = inPlace.file.Name()
+		}
+		dataFile = inPlace.file
+	} else {
+		tmpDataFile, err := createTemp(tempDir, "ixtar-data-*.tmp")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create temp data file: %w", err)
+		}
+		defer os.Remove(tmpDataFile.Name())
+		defer tmpDataFile.Close()
+		dataFile = tmpDataFile
+	}
+	addWritten(dataFile)
+
+	// Create temporary CSV file, or the one of the checkpoint, which must
+	// outlive a failed create
+	var tmpCsvFile *os.File
+	var resumed map[string]bool
+	if ckpt != nil {
+		var done DataIndex
+		if tmpCsvFile, done, err = ckpt.openIndex(); err != nil {
+			return nil, err
+		}
+		resumed = make(map[string]bool, len(done.Files))
+		for _, fileIndex := range done.Files {
+			resumed[fileIndex.Path] = true
+			result.Files++
+			result.Bytes += fileIndex.Size
+		}
+	} else {
+		if tmpCsvFile, err = createTemp(tempDir, "ixtar-csv-*.tmp"); err != nil {
+			return nil, fmt.Errorf("failed to create temp csv file: %w", err)
+		}
+		defer os.Remove(tmpCsvFile.Name())
+	}
+	defer tmpCsvFile.Close()
+	addWritten(tmpCsvFile)
+
+	csvWriter := csv.NewWriter(tmpCsvFile)
+
+	if opts.Encryption != nil && opts.Encryption.Index {
+		estimate.sealSize = gcmNonceSize + gcmTagSize
+		if inPlace != nil {
+			inPlace.sealSize = estimate.sealSize
+		}
+	}
+
+	// Count files first if progress callback is provided, and size the
+	// index of a bundle written in place
+	walk := filepath.Walk
+	if opts.FollowSymlinks {
+		walk = walkFollowing
+	}
+	totalFiles := 0
+	if progress != nil || inPlace != nil {
+		walk(sourceDir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return nil
+			}
+			relPath, err := filepath.Rel(sourceDir, path)
+			if err != nil || relPath == "." {
+				return nil
+			}
+			if isWritten(path, info) {
+				return nil
+			}
+			// Leave out what the walk below skips, so the count is reached
+			if opts.SkipHidden && strings.HasPrefix(info.Name(), ".") ||
+				ignore != nil && ignore.match(filepath.ToSlash(relPath), info.IsDir()) {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if opts.Filter != nil {
+				if err := opts.Filter(path, info); err == filepath.SkipDir && !info.IsDir() {
+					return nil
+				} else if err == filepath.SkipDir || err == filepath.SkipAll {
+					return err
+				}
+			}
+			if !info.IsDir() && unmodified(info, opts.ModifiedAfter) {
+				return nil
+			}
+			if !info.IsDir() {
+				totalFiles++
+			}
+			if inPlace != nil && info.Mode().IsRegular() {
+				storedPath := filepath.ToSlash(normalizePath(filepath.Join(basePrefix, relPath)))
+				compress := info.Size() > 0 && opts.Compress != nil && opts.Compress(storedPath)
+				inPlace.add(placeholderKey, storedPath, info.Size(), compress, seal != nil)
+			}
+			return nil
+		})
+	}
+	lastProgress, reported := time.Now(), 0
+
+	var dataOffset int64
+	currentPos := int64(0) // Track position in raw data file
+	if inPlace != nil {
+		dataOffset = inPlace.dataOffset(len(infoData))
+		if ckpt != nil && ckpt.resume {
+			dataOffset, currentPos = ckpt.DataOffset, ckpt.DataSize
+		}
+		if _, err := dataFile.Seek(dataOffset+currentPos, io.SeekStart); err != nil {
+			return nil, fmt.Errorf("failed to seek bundle file: %w", err)
+		}
+	}
+	// Batch the many small writes of small files into fewer syscalls
+	dataWriter := bufio.NewWriterSize(dataFile, dataBufferSize)
+	staging := &stagingWriter{w: dataWriter}
+
+	// Phase 1: Create raw data file and build index simultaneously
+	var comp compressor
+	currentFile := 0
+	csvFileCount := len(resumed)
+
+	var saveCheckpoint func() error
+	if ckpt != nil {
+		saveCheckpoint = func() error {
+			csvWriter.Flush()
+			if err := csvWriter.Error(); err != nil {
+				return err
+			}
+			if err := dataWriter.Flush(); err != nil {
+				return err
+			}
+			indexSize, err := tmpCsvFile.Seek(0, io.SeekCurrent)
+			if err != nil {
+				return err
+			}
+			if err := tmpCsvFile.Sync(); err != nil {
+				return err
+			}
+			if err := dataFile.Sync(); err != nil {
+				return err
+			}
+			ckpt.DataOffset, ckpt.DataSize, ckpt.IndexSize = dataOffset, currentPos, indexSize
+			return ckpt.save()
+		}
+		// Save where a failed create got to, before the files are closed.
+		// If that fails, the previous checkpoint still matches the files.
+		defer func() {
+			if ckpt != nil && inPlace.file != nil {
+				if err := saveCheckpoint(); err != nil {
+					logger.Warn("failed to save checkpoint", "error", err)
+				}
+			}
+		}()
+	}
+
+	// skip reports an unreadable entry and leaves it out if the options
+	// allow it, otherwise it fails creation with err
+	skip := func(path string, err error) error {
+		if !opts.ContinueOnError {
+			return err
+		}
+		logger.Warn("skipped unreadable entry", "path", path, "error", err)
+		if opts.OnError != nil {
+			opts.OnError(path, err)
+		}
+		result.SkippedErrors++
+		return nil
+	}
+
+	err = walk(sourceDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			// The root must be readable even with ContinueOnError
+			if path == sourceDir {
+				return err
+			}
+			return skip(path, err)
+		}
+
+		relPath, err := filepath.Rel(sourceDir, path)
+		if err != nil {
+			return err
+		}
+
+		if isWritten(path, info) {
+			return nil
+		}
+
+		if relPath != "." && opts.SkipHidden && strings.HasPrefix(info.Name(), ".") {
+			result.SkippedHidden++
+			logger.Debug("skipped", "path", path, "reason", "hidden")
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if relPath != "." && ignore != nil && ignore.match(filepath.ToSlash(relPath), info.IsDir()) {
+			result.SkippedIgnored++
+			logger.Debug("skipped", "path", path, "reason", "ignored")
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if relPath != "." && opts.Filter != nil {
+			if err := opts.Filter(path, info); err == filepath.SkipDir {
+				result.SkippedFiltered++
+				logger.Debug("skipped", "path", path, "reason", "filtered")
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			} else if err != nil {
+				return err
+			}
+		}
+
+		if relPath == "." {
+			return nil
+		}
+		if info.IsDir() {
+			result.Directories++
+			return nil
+		}
+
+		if unmodified(info, opts.ModifiedAfter) {
+			result.SkippedOlder++
+			logger.Debug("skipped", "path", path, "reason", "not modified")
+			return nil
+		}
+
+		currentFile++
+		if progress != nil && (currentFile%1000 == 0 || time.Since(lastProgress) >= progressInterval) {
+			if err := progress(currentFile, totalFiles, ""); err != nil {
+				return err
+			}
+			lastProgress, reported = time.Now(), currentFile
+		}
+
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			result.SkippedSymlinks++
+			logger.Info("skipped", "path", path, "reason", "symlink")
+			return nil
+		case !info.Mode().IsRegular():
+			if opts.SpecialFiles == ErrorOnSpecial {
+				return fmt.Errorf("unsupported special file %s (%s)", path, info.Mode().Type())
+			}
+			result.SkippedSpecial++
+			logger.Info("skipped", "path", path, "reason", "special file", "type", info.Mode().Type().String())
+			return nil
+		}
+
+		cleanPath := normalizePath(filepath.Join(basePrefix, relPath))
+		if sanitizedPaths != nil {
+			cleanPath = sanitizeName(cleanPath)
+			if other, ok := sanitizedPaths[cleanPath]; ok {
+				return fmt.Errorf("paths %q and %q are both stored as %q", other, path, cleanPath)
+			}
+			sanitizedPaths[cleanPath] = path
+		} else if err := checkStoredName(cleanPath); err != nil {
+			return err
+		}
+		hash := hashFilePath(hasher, cleanPath)
+		if keyer != nil {
+			storedPath := filepath.ToSlash(cleanPath)
+			hash = keyer.Key(storedPath)
+			if hash == "" {
+				return fmt.Errorf("keyer %q returned an empty key for %s", keyer.ID(), storedPath)
+			}
+			if other, ok := customKeys[hash]; ok {
+				return fmt.Errorf("keyer %q returned the same key for %s and %s", keyer.ID(), other, storedPath)
+			}
+			customKeys[hash] = storedPath
+		}
+
+		if foldedPaths != nil {
+			storedPath := filepath.ToSlash(cleanPath)
+			folded := strings.ToLower(storedPath)
+			if other, ok := foldedPaths[folded]; ok {
+				return fmt.Errorf("paths %s and %s differ only in case", other, storedPath)
+			}
+			foldedPaths[folded] = storedPath
+		}
+
+		// Added before the checkpoint this create resumes from
+		if resumed[filepath.ToSlash(cleanPath)] {
+			return nil
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return skip(path, err)
+		}
+
+		if opts.DryRun {
+			file.Close()
+			storedPath := filepath.ToSlash(cleanPath)
+			compress := info.Size() > 0 && opts.Compress != nil && opts.Compress(storedPath)
+			estimate.add(hash, storedPath, info.Size(), compress, seal != nil)
+			result.Paths = append(result.Paths, storedPath)
+			result.sources = append(result.sources, path)
+			result.Files++
+			result.Bytes += info.Size()
+			return nil
+		}
+
+		size := info.Size()
+		var src io.Reader = file
+		var segs []SparseSegment
+		if opts.Transform != nil {
+			if src, err = opts.Transform(filepath.ToSlash(cleanPath), file); err != nil {
+				file.Close()
+				return skip(path, fmt.Errorf("failed to transform %s: %w", path, err))
+			}
+		} else if seal == nil {
+			if segs, err = dataSegments(file, size); err != nil {
+				file.Close()
+				return skip(path, fmt.Errorf("failed to detect sparse regions of %s: %w", path, err))
+			}
+		} else if err := checkInMemory(path, size); err != nil {
+			file.Close()
+			return err
+		}
+
+		// Write file data directly to raw data file, skipping holes,
+		// and checksum the bytes written on the way, so each file is
+		// read only once. Encrypted data is collected and sealed first.
+		checksum := crc32.NewIEEE()
+		out := io.MultiWriter(staging, checksum)
+		dst := out
+		if seal != nil {
+			seal.buf.Reset()
+			dst = &seal.buf
+		}
+		var written, stored int64
+		compress := segs == nil && size > 0 && opts.Compress != nil && opts.Compress(filepath.ToSlash(cleanPath))
+		// Transformed content is as long as the reader makes it
+		limit := size
+		if opts.Transform != nil {
+			limit = math.MaxInt64
+		}
+		switch {
+		case segs != nil:
+			written, err = copySparseData(dst, file, segs, buf)
+			stored = written
+		case compress:
+			written, stored, err = comp.copyCompressed(dst, src, limit, buf)
+		default:
+			written, err = copyFileData(dst, src, limit, buf)
+			stored = written
+		}
+		file.Close()
+		csize := stored
+		if seal != nil {
+			if err == nil {
+				stored, err = seal.writeTo(out, additionalData(hash, filepath.ToSlash(cleanPath)))
+			} else {
+				stored = 0
+			}
+		}
+		if staging.err != nil {
+			return fmt.Errorf("failed to write data of %s: %w", path, staging.err)
+		}
+		if err != nil {
+			// Bytes already copied stay in the data region unreferenced
+			currentPos += stored
+			return skip(path, fmt.Errorf("failed to read %s: %w", path, err))
+		}
+		if opts.Transform != nil {
+			size = written
+		} else if segs == nil && written < size {
+			size = written
+			result.Shrunk = append(result.Shrunk, relPath)
+			logger.Warn("file shrank while being read", "path", path, "size", size)
+		}
+
+		// Record position in CSV - this is where file data starts
+		fileIndex := FileIndex{
+			Start:  currentPos,
+			Size:   size,
+			Path:   filepath.ToSlash(cleanPath),
+			Sparse: segs,
+			CRC32:  formatCRC32(checksum.Sum32()),
+		}
+		if compress {
+			fileIndex.Compression = compressionDeflate
+			fileIndex.CompressedSize = csize
+		}
+		if seal != nil {
+			fileIndex.Encryption, fileIndex.NonceSize = encryptionAESGCM, gcmNonceSize
+			fileIndex.key = hash
+		}
+		if err := writeCSVRecord(csvWriter, hash, fileIndex); err != nil {
+			return err
+		}
+		if opts.IndexCallback != nil {
+			opts.IndexCallback(fileIndex.Path, hash, fileIndex)
+		}
+
+		csvFileCount++
+		if csvFileCount%1000 == 0 {
+			csvWriter.Flush()
+			if err := csvWriter.Error(); err != nil {
+				return fmt.Errorf("CSV flush error: %w", err)
+			}
+		}
+
+		// Update position
+		currentPos += stored
+		result.Files++
+		result.Bytes += size
+
+		if ckpt != nil && csvFileCount%checkpointEvery == 0 {
+			if err := saveCheckpoint(); err != nil {
+				return fmt.Errorf("failed to save checkpoint: %w", err)
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk directory: %w", err)
+	}
+	if progress != nil && reported != currentFile {
+		// Report the last file, which the periodic calls above may miss
+		if err := progress(currentFile, totalFiles, ""); err != nil {
+			return nil, err
+		}
+	}
+	logger.Info("indexed files", "files", result.Files, "bytes", result.Bytes)
+
+	if opts.DryRun {
+		result.EstimatedSize = estimate.bundleSize(len(infoData), opts.Trailer)
+		return result, nil
+	}
+
+	info.Entries = &entryCounts{Directories: result.Directories, Symlinks: result.SkippedSymlinks, Other: result.SkippedSpecial}
+	if infoData, err = encodeBundleInfo(info); err != nil {
+		return nil, err
+	}
+
+	csvWriter.Flush()
+	if err := csvWriter.Error(); err != nil {
+		return nil, fmt.Errorf("failed to flush CSV writer: %w", err)
+	}
+
+	if err := dataWriter.Flush(); err != nil {
+		return nil, fmt.Errorf("failed to flush data writer: %w", err)
+	}
+
+	// Get CSV size
+	csvSize, err := tmpCsvFile.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get CSV size: %w", err)
+	}
+
+	// Phase 2: Assemble final bundle
+	if _, err := tmpCsvFile.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to seek CSV temp file: %w", err)
+	}
+
+	header := bundleHeader{hashAlg: hashAlgorithm, flags: keyFlags, csvSize: csvSize}
+	if opts.Trailer {
+		header.flags |= flagTrailer
+	}
+	var csvData io.ReadSeeker = tmpCsvFile
+	if opts.Encryption != nil && opts.Encryption.Index {
+		sealed, err := seal.sealIndex(tmpCsvFile)
+		if err != nil {
+			return nil, err
+		}
+		csvData = bytes.NewReader(sealed)
+		header.csvSize = int64(len(sealed))
+		header.flags |= flagEncryptedIndex
+	}
+
+	if inPlace != nil {
+		err := inPlace.finish(header, csvData, infoData, dataOffset, currentPos)
+		if ckpt != nil {
+			// Nothing is left to resume: the bundle is complete, or finish
+			// failed after it may have moved the data, and the bundle file
+			// is removed like without a checkpoint
+			ckpt.remove()
+			ckpt = nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		inPlace.file = nil
+		return result, nil
+	}
+
+	if _, err := dataFile.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to seek data temp file: %w", err)
+	}
+	if err := assemble(header, csvData, infoData, dataFile); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// baseDirPrefix returns the location of sourceDir relative to baseDir, or an
+// error if sourceDir isn't inside baseDir.
+func baseDirPrefix(baseDir, sourceDir string) (string, error) {
+	absBase, err := filepath.Abs(baseDir)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve base directory: %w", err)
+	}
+	absSource, err := filepath.Abs(sourceDir)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve source directory: %w", err)
+	}
+	prefix, err := filepath.Rel(absBase, absSource)
+	if err != nil || prefix == ".." || strings.HasPrefix(prefix, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("source directory %s is not under base directory %s", sourceDir, baseDir)
+	}
+	return prefix, nil
+}
+
+// copyFileData copies the content of a file that was size bytes long when it
+// was listed. Bytes beyond size, appended while the bundle is created, are
+// left out so the entry matches the listing; if the file got shorter the
+// returned count is less than size.
+func copyFileData(w io.Writer, r io.Reader, size int64, buf []byte) (int64, error) {
+	return io.CopyBuffer(w, io.LimitReader(r, size), buf)
+}
+
+// writeBundleFile writes a bundle to bundlePath with writeBundle. A regular
+// file is written as a partial file next to it and renamed over it, so a
+// failure leaves an existing bundle as it was; other outputs, such as
+// devices, are written directly.
+func writeBundleFile(bundlePath string, header bundleHeader, csvData io.ReadSeeker, infoData []byte, data io.Reader) error {
+	if !canWriteInPlace(bundlePath) {
+		bundleFile, err := os.Create(bundlePath)
+		if err != nil {
+			return fmt.Errorf("failed to create bundle file: %w", err)
+		}
+		err = writeBundle(bundleFile, header, csvData, infoData, data)
+		if closeErr := bundleFile.Close(); err == nil && closeErr != nil {
+			err = fmt.Errorf("failed to close bundle file: %w", closeErr)
+		}
+		return err
+	}
+
+	bundleFile, err := createPartial(bundlePath)
+	if err != nil {
+		return fmt.Errorf("failed to create bundle file: %w", err)
+	}
+	err = writeBundle(bundleFile, header, csvData, infoData, data)
+	if closeErr := bundleFile.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("failed to close bundle file: %w", closeErr)
+	}
+	if err == nil {
+		if err = os.Rename(bundleFile.Name(), bundlePath); err != nil {
+			err = fmt.Errorf("failed to replace bundle: %w", err)
+		}
+	}
+	if err != nil {
+		os.Remove(bundleFile.Name())
+		return err
+	}
+	return nil
+}
+
+// writeBundle writes the header followed by the CSV index, the info block
+// and the raw file data. The caller sets the CSV size, flags and hash
+// algorithm of header, and may set the creation time; the rest is filled in,
+// including the checksum of flagIndexCRC, for which the CSV index is read
+// twice. With flagTrailer, a copy of the CSV index and a trailer footer are
+// appended after the data.
+func writeBundle(w io.Writer, header bundleHeader, csvData io.ReadSeeker, infoData []byte, data io.Reader) error {
+	header, err := writeBundlePrefix(w, header, csvData, infoData)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(w, data); err != nil {
+		return fmt.Errorf("failed to copy raw data: %w", err)
+	}
+
+	return writeTrailer(w, header, csvData)
+}
+
+// writeBundlePrefix writes the header, CSV index and info block of
+// writeBundle and returns the completed header.
+func writeBundlePrefix(w io.Writer, header bundleHeader, csvData io.ReadSeeker, infoData []byte) (bundleHeader, error) {
+	header.version = formatVersion
+	if header.created == 0 {
+		header.created = time.Now().UnixNano()
+	}
+	header.infoSize = uint32(len(infoData))
+	header.flags |= flagIndexCRC
+
+	sum := header.indexSum()
+	if _, err := io.Copy(sum, csvData); err != nil {
+		return header, fmt.Errorf("failed to checksum CSV data: %w", err)
+	}
+	if _, err := csvData.Seek(0, io.SeekStart); err != nil {
+		return header, fmt.Errorf("failed to seek CSV data: %w", err)
+	}
+	sum.Write(infoData)
+	header.indexCRC = sum.Sum32()
+	headerBytes := header.marshal()
+
+	if _, err := w.Write(headerBytes[:]); err != nil {
+		return header, fmt.Errorf("failed to write bundle header: %w", err)
+	}
+
+	if _, err := io.Copy(w, csvData); err != nil {
+		return header, fmt.Errorf("failed to copy CSV data: %w", err)
+	}
+
+	if _, err := w.Write(infoData); err != nil {
+		return header, fmt.Errorf("failed to write bundle info: %w", err)
+	}
+	return header, nil
+}
+
+// writeTrailer writes the trailer of a bundle with flagTrailer: a copy of
+// the CSV index and the trailer footer.
+func writeTrailer(w io.Writer, header bundleHeader, csvData io.ReadSeeker) error {
+	if header.flags&flagTrailer == 0 {
+		return nil
+	}
+	if _, err := csvData.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to seek CSV data: %w", err)
+	}
+	if _, err := io.Copy(w, csvData); err != nil {
+		return fmt.Errorf("failed to copy trailer CSV data: %w", err)
+	}
+	footer := marshalTrailerFooter(header.csvSize)
+	if _, err := w.Write(footer[:]); err != nil {
+		return fmt.Errorf("failed to write trailer footer: %w", err)
+	}
+	return nil
+}
@@ -1,9 +1,19 @@
 package ixtar
 
 import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
 	"os"
 	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestCreateAndReadBundle(t *testing.T) {
@@ -72,6 +82,24 @@ func TestCreateAndReadBundle(t *testing.T) {
 	}
 }
 
+func TestCreateFromFile(t *testing.T) {
+	srcFile := filepath.Join(t.TempDir(), "single.txt")
+	if err := os.WriteFile(srcFile, []byte("alpha"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	bundlePath := filepath.Join(t.TempDir(), "test.ixtar")
+	_, err := CreateBundleWithOptions(srcFile, bundlePath, CreateOptions{})
+	if err == nil || !strings.Contains(err.Error(), "not a directory") {
+		t.Errorf("Expected a file source to be refused, got %v", err)
+	}
+	if _, err := os.Stat(bundlePath); !os.IsNotExist(err) {
+		t.Errorf("Expected no bundle to be written, got %v", err)
+	}
+	if _, err := CreateBundleWithOptions(filepath.Join(t.TempDir(), "missing"), bundlePath, CreateOptions{}); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected a missing source to fail with ErrNotExist, got %v", err)
+	}
+}
+
 func TestHashFilePath(t *testing.T) {
 	tests := []struct {
 		path     string
@@ -83,7 +111,7 @@ func TestHashFilePath(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		result := hashFilePath(filepath.Clean(test.path))
+		result := hashFilePath(md5Hasher{}, filepath.Clean(test.path))
 		if result != test.expected {
 			t.Errorf("Hash for %s: expected %s, got %s", test.path, test.expected, result)
 		}
@@ -118,4 +146,1805 @@ func TestEmptyDirectory(t *testing.T) {
 	if len(files) != 0 {
 		t.Errorf("Expected 0 files in empty bundle, got %d", len(files))
 	}
-}
\ No newline at end of file
+	if files == nil || ix.ListPaths() == nil {
+		t.Error("Expected empty, non-nil lists")
+	}
+	if ix.Len() != 0 {
+		t.Errorf("Expected Len 0, got %d", ix.Len())
+	}
+	if count, csvSize := ix.Info(); count != 0 || csvSize != 0 {
+		t.Errorf("Expected Info (0, 0), got (%d, %d)", count, csvSize)
+	}
+	if err := ix.Validate(); err != nil {
+		t.Errorf("Validate failed: %v", err)
+	}
+	if err := ix.VerifyAll(); err != nil {
+		t.Errorf("VerifyAll failed: %v", err)
+	}
+
+	if _, err := ix.ExtractBytesOfFile("missing.txt"); !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("Expected ErrFileNotFound, got %v", err)
+	}
+	if _, err := ix.ExtractToWriter("missing.txt", io.Discard); !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("Expected ErrFileNotFound from ExtractToWriter, got %v", err)
+	}
+	if _, err := ix.ExtractRange("missing.txt", 0, 1); !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("Expected ErrFileNotFound from ExtractRange, got %v", err)
+	}
+	if _, err := LookupStreaming(bundlePath, "missing.txt"); !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("Expected ErrFileNotFound from LookupStreaming, got %v", err)
+	}
+	if err := ix.ExtractAll(filepath.Join(tempDir, "all")); err != nil {
+		t.Errorf("ExtractAll failed: %v", err)
+	}
+}
+
+func TestParseEmptyCSVIndex(t *testing.T) {
+	index, err := parseCSVIndex(make([]byte, 0))
+	if err != nil {
+		t.Fatalf("parseCSVIndex failed: %v", err)
+	}
+	if index.Files == nil || len(index.Files) != 0 {
+		t.Errorf("Expected empty non-nil index, got %v", index.Files)
+	}
+}
+
+func TestParseCSVIndexRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		csv  string
+	}{
+		{"empty hash", ",0,5,a.txt\n"},
+		{"negative start", "0123456789abcdef,-1,5,a.txt\n"},
+		{"negative size", "0123456789abcdef,0,-5,a.txt\n"},
+		{"overflowing region", "0123456789abcdef,9223372036854775807,1,a.txt\n"},
+		{"overflowing sparse segment", "0123456789abcdef,0,10,a.txt,sparse=5%3A9223372036854775807\n"},
+		{"unknown compression", "0123456789abcdef,0,10,a.txt,compression=zstd&csize=4\n"},
+		{"negative compressed size", "0123456789abcdef,0,10,a.txt,compression=deflate&csize=-4\n"},
+		{"overflowing compressed region", "0123456789abcdef,10,10,a.txt,compression=deflate&csize=9223372036854775807\n"},
+	}
+	for _, test := range tests {
+		if _, err := parseCSVIndex([]byte(test.csv)); err == nil {
+			t.Errorf("%s: expected an error", test.name)
+		}
+	}
+}
+
+func FuzzParseCSVIndex(f *testing.F) {
+	f.Add([]byte("0123456789abcdef,0,5,a.txt,crc32=01020304\n"))
+	f.Add([]byte("0123456789abcdef,5,10,b.bin,sparse=0%3A2%3B8%3A2\n"))
+	f.Add([]byte("0123456789abcdef,0,5\n"))
+	f.Add([]byte("0123456789abcdef,0,500,a.txt,compression=deflate&csize=20\n"))
+	f.Add([]byte("\"unterminated,0,5\n"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		index, err := parseCSVIndex(data)
+		if err != nil {
+			return
+		}
+		for hash, fileIndex := range index.Files {
+			if hash == "" || fileIndex.Start < 0 || fileIndex.Size < 0 || fileIndex.storedSize() < 0 ||
+				fileIndex.Sparse != nil && fileIndex.storedSize() > fileIndex.Size {
+				t.Errorf("Accepted invalid entry %q: %+v", hash, fileIndex)
+			}
+		}
+	})
+}
+
+func FuzzNewIxTar(f *testing.F) {
+	_, bundle, err := CreateBundleInMemory([]FileEntry{
+		{Path: "a.txt", Data: []byte("alpha")},
+		{Path: "dir/b.txt", Data: []byte("beta"), Meta: map[string]string{"k": "v"}},
+	})
+	if err != nil {
+		f.Fatalf("Failed to create bundle: %v", err)
+	}
+	f.Add(bundle)
+	f.Add(bundle[:len(bundle)-3])
+	f.Add(bundle[:headerSize])
+	f.Add([]byte{})
+	// A compressed entry whose size is far beyond its stored bytes
+	var stored bytes.Buffer
+	var c compressor
+	if _, _, err := c.copyCompressed(&stored, strings.NewReader("alpha"), 5, make([]byte, 4)); err != nil {
+		f.Fatal(err)
+	}
+	f.Add(rawBundle(fmt.Sprintf("%s,0,%d,a.txt,compression=deflate&csize=%d\n", pathKey(md5Hasher{}, "a.txt"), int64(1)<<44, stored.Len()), stored.String()))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		ix, err := NewIxTarAt(bytes.NewReader(data), 0, int64(len(data)))
+		if err != nil {
+			return
+		}
+		defer ix.Close()
+
+		ix.Validate()
+		for i, hash := range ix.entriesByOffset() {
+			// The logical size of a sparse entry isn't bounded by the bundle
+			if fileIndex := ix.index.Files[hash]; fileIndex.Sparse != nil && fileIndex.Size > 1<<20 {
+				continue
+			}
+			ix.ExtractNth(i)
+		}
+	})
+}
+func createTestBundle(t testing.TB, testFiles map[string]string) string {
+	t.Helper()
+
+	tempDir, err := os.MkdirTemp("", "ixtar_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(tempDir) })
+
+	testDir := filepath.Join(tempDir, "testdata")
+	for path, content := range testFiles {
+		fullPath := filepath.Join(testDir, path)
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+			t.Fatalf("Failed to create directory for %s: %v", path, err)
+		}
+		if err := os.WriteFile(fullPath, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write test file %s: %v", fullPath, err)
+		}
+	}
+	if err := os.MkdirAll(testDir, 0755); err != nil {
+		t.Fatalf("Failed to create test directory: %v", err)
+	}
+
+	bundlePath := filepath.Join(tempDir, "test.ixtar")
+	if err := CreateBundle(testDir, bundlePath); err != nil {
+		t.Fatalf("Failed to create bundle: %v", err)
+	}
+	return bundlePath
+}
+
+// rawBundle returns a bundle of a plain header, csvData and data.
+func rawBundle(csvData, data string) []byte {
+	var header [32]byte
+	binary.BigEndian.PutUint64(header[24:], uint64(len(csvData)))
+	return append(header[:], []byte(csvData+data)...)
+}
+
+func writeRawBundle(t *testing.T, csvData, data string) string {
+	t.Helper()
+
+	bundlePath := filepath.Join(t.TempDir(), "raw.ixtar")
+	if err := os.WriteFile(bundlePath, rawBundle(csvData, data), 0644); err != nil {
+		t.Fatalf("Failed to write raw bundle: %v", err)
+	}
+	return bundlePath
+}
+
+func TestExtractAllWithOptions(t *testing.T) {
+	bundlePath := createTestBundle(t, map[string]string{
+		"top.txt":          "top",
+		"dir/file.txt":     "in dir",
+		"dir/sub/deep.txt": "deep",
+	})
+
+	ix, err := NewIxTar(bundlePath)
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	defer ix.Close()
+
+	outDir := filepath.Join(t.TempDir(), "out")
+	result, err := ix.ExtractAllWithOptions(outDir, ExtractOptions{StripComponents: 1})
+	if err != nil {
+		t.Fatalf("Failed to extract bundle: %v", err)
+	}
+	if result.Files != 2 || result.Bytes != 10 || result.Skipped != 1 {
+		t.Errorf("Expected 2 files of 10 bytes and 1 skipped, got %+v", result)
+	}
+
+	expected := map[string]string{
+		"file.txt":     "in dir",
+		"sub/deep.txt": "deep",
+	}
+	for path, content := range expected {
+		data, err := os.ReadFile(filepath.Join(outDir, path))
+		if err != nil {
+			t.Errorf("Failed to read extracted file %s: %v", path, err)
+			continue
+		}
+		if string(data) != content {
+			t.Errorf("Content mismatch for %s: expected %q, got %q", path, content, string(data))
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(outDir, "top.txt")); !os.IsNotExist(err) {
+		t.Errorf("Expected top.txt to be stripped, got err %v", err)
+	}
+}
+
+func TestExtractAllContinueOnError(t *testing.T) {
+	// bad.txt fails its checksum, evil.txt escapes the destination and
+	// short.txt extends past the end of the data
+	csvData := "0000000000000001,0,4,good.txt,crc32=" + formatCRC32(crc32.ChecksumIEEE([]byte("good"))) + "\n" +
+		"0000000000000002,4,3,bad.txt,crc32=00000000\n" +
+		"0000000000000003,7,4,../evil.txt\n" +
+		"0000000000000004,11,9,short.txt\n"
+	bundlePath := writeRawBundle(t, csvData, "goodbadevilshort")
+
+	ix, err := NewIxTar(bundlePath, WithVerifyOnRead())
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	defer ix.Close()
+
+	outDir := filepath.Join(t.TempDir(), "out")
+	if _, err := ix.ExtractAllWithOptions(outDir, ExtractOptions{}); !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("Expected to stop at the checksum mismatch, got %v", err)
+	}
+
+	result, err := ix.ExtractAllWithOptions(outDir, ExtractOptions{ContinueOnError: true})
+	if err != nil {
+		t.Fatalf("Expected errors to be collected, got %v", err)
+	}
+	if result.Files != 1 || result.Bytes != 4 || len(result.Errors) != 3 {
+		t.Fatalf("Expected 1 file of 4 bytes and 3 errors, got %+v", result)
+	}
+	if !errors.Is(result.Errors[0], ErrChecksumMismatch) {
+		t.Errorf("Expected a checksum mismatch first, got %v", result.Errors[0])
+	}
+	if data, err := os.ReadFile(filepath.Join(outDir, "good.txt")); err != nil || string(data) != "good" {
+		t.Errorf("Expected good.txt to be extracted, got %q (%v)", data, err)
+	}
+	for _, name := range []string{"bad.txt", "short.txt", "../evil.txt"} {
+		if _, err := os.Stat(filepath.Join(outDir, name)); !os.IsNotExist(err) {
+			t.Errorf("Expected no %s, got %v", name, err)
+		}
+	}
+}
+
+func TestExtractAllConcurrency(t *testing.T) {
+	testFiles := make(map[string]string)
+	for i := 0; i < 300; i++ {
+		testFiles[fmt.Sprintf("dir%d/sub%d/file%d.txt", i%7, i%3, i)] = strings.Repeat(fmt.Sprint(i), i)
+	}
+	bundlePath := createTestBundle(t, testFiles)
+
+	// A small read-ahead buffer makes many runs of a few files
+	ix, err := NewIxTar(bundlePath, WithReadAheadSize(512), WithVerifyOnRead())
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	defer ix.Close()
+
+	outDir := filepath.Join(t.TempDir(), "out")
+	result, err := ix.ExtractAllWithOptions(outDir, ExtractOptions{Concurrency: 8})
+	if err != nil {
+		t.Fatalf("Failed to extract bundle: %v", err)
+	}
+	if result.Files != len(testFiles) {
+		t.Errorf("Expected %d files, got %+v", len(testFiles), result)
+	}
+	for name, content := range testFiles {
+		if data, err := os.ReadFile(filepath.Join(outDir, filepath.FromSlash(name))); err != nil || string(data) != content {
+			t.Errorf("%s: got %d bytes (%v)", name, len(data), err)
+		}
+	}
+
+	if _, err := ix.ExtractAllWithOptions(outDir, ExtractOptions{Concurrency: -1}); err == nil {
+		t.Error("Expected an error for negative concurrency")
+	}
+}
+
+func TestExtractAllConcurrencyErrors(t *testing.T) {
+	csvData := "0000000000000001,0,4,good.txt,crc32=" + formatCRC32(crc32.ChecksumIEEE([]byte("good"))) + "\n" +
+		"0000000000000002,4,3,bad.txt,crc32=00000000\n" +
+		"0000000000000003,7,4,../evil.txt\n"
+	bundlePath := writeRawBundle(t, csvData, "goodbadevil")
+
+	ix, err := NewIxTar(bundlePath, WithVerifyOnRead(), WithReadAheadSize(0))
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	defer ix.Close()
+
+	outDir := filepath.Join(t.TempDir(), "out")
+	if _, err := ix.ExtractAllWithOptions(outDir, ExtractOptions{Concurrency: 3}); err == nil {
+		t.Fatal("Expected the first error to stop extraction")
+	}
+	result, err := ix.ExtractAllWithOptions(outDir, ExtractOptions{Concurrency: 3, ContinueOnError: true})
+	if err != nil {
+		t.Fatalf("Expected errors to be collected, got %v", err)
+	}
+	if result.Files != 1 || len(result.Errors) != 2 {
+		t.Errorf("Expected 1 file and 2 errors, got %+v", result)
+	}
+}
+
+func TestExtractAllRefusesEscape(t *testing.T) {
+	bundlePath := writeRawBundle(t, "0123456789abcdef,0,4,../evil.txt\n", "evil")
+
+	ix, err := NewIxTar(bundlePath)
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	defer ix.Close()
+
+	outDir := filepath.Join(t.TempDir(), "out")
+	if _, err := ix.ExtractAllWithOptions(outDir, ExtractOptions{}); err == nil {
+		t.Fatal("Expected error when extracting a path outside the destination")
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(outDir), "evil.txt")); !os.IsNotExist(err) {
+		t.Errorf("File was written outside the destination")
+	}
+}
+
+func TestValidateAndVerifyAll(t *testing.T) {
+	bundlePath := createTestBundle(t, map[string]string{
+		"a.txt": "alpha",
+		"b.txt": "bravo",
+	})
+
+	ix, err := NewIxTar(bundlePath)
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	defer ix.Close()
+
+	if err := ix.Validate(); err != nil {
+		t.Errorf("Expected valid bundle, got %v", err)
+	}
+	if err := ix.VerifyAll(); err != nil {
+		t.Errorf("Expected verified bundle, got %v", err)
+	}
+}
+
+func TestValidateDetectsBadRegions(t *testing.T) {
+	csvData := "0000000000000001,0,4,a.txt\n" +
+		"0000000000000002,2,4,b.txt\n" +
+		"0000000000000003,6,10,c.txt\n"
+	bundlePath := writeRawBundle(t, csvData, "aaaabbbb")
+
+	ix, err := NewIxTar(bundlePath)
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	defer ix.Close()
+
+	err = ix.Validate()
+	if err == nil {
+		t.Fatal("Expected validation error")
+	}
+	problems := err.(interface{ Unwrap() []error }).Unwrap()
+	if len(problems) != 2 {
+		t.Errorf("Expected 2 problems, got %d: %v", len(problems), err)
+	}
+	if ix.VerifyAll() == nil {
+		t.Error("Expected VerifyAll to fail on an invalid bundle")
+	}
+}
+
+func TestOpenWithValidate(t *testing.T) {
+	// The header's CSV size takes in the first file, four empty lines
+	// that parse as nothing, so the data region starts four bytes late
+	csvData := "0000000000000001,0,4,blank.txt\n" +
+		"0000000000000002,4,5,b.txt\n"
+	var header [32]byte
+	binary.BigEndian.PutUint64(header[24:], uint64(len(csvData)+4))
+	bundlePath := filepath.Join(t.TempDir(), "shifted.ixtar")
+	if err := os.WriteFile(bundlePath, append(header[:], csvData+"\n\n\n\nbravo"...), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ix, err := NewIxTar(bundlePath)
+	if err != nil {
+		t.Fatalf("Expected the shifted bundle to open without validation, got %v", err)
+	}
+	ix.Close()
+
+	_, err = NewIxTar(bundlePath, WithValidate())
+	if !errors.Is(err, ErrBadFormat) || !strings.Contains(err.Error(), fmt.Sprintf("at offset %d", 32+len(csvData)+4)) {
+		t.Fatalf("Expected ErrBadFormat with the data offset, got %v", err)
+	}
+
+	// Entries sharing data are fine
+	bundlePath = writeRawBundle(t, "0000000000000001,0,5,a.txt\n0000000000000002,0,5,copy.txt\n", "alpha")
+	ix, err = NewIxTar(bundlePath, WithValidate())
+	if err != nil {
+		t.Fatalf("Expected a bundle with shared data to open, got %v", err)
+	}
+	ix.Close()
+}
+
+func TestStat(t *testing.T) {
+	bundlePath := createTestBundle(t, map[string]string{
+		"a.txt":     "alpha",
+		"dir/b.txt": "bravo!",
+	})
+
+	ix, err := NewIxTar(bundlePath)
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	defer ix.Close()
+
+	stat, err := ix.Stat("./dir/b.txt")
+	if err != nil {
+		t.Fatalf("Failed to stat file: %v", err)
+	}
+	if stat.Path != "dir/b.txt" || stat.Size != 6 || stat.Hash != hashFilePath(md5Hasher{}, "dir/b.txt") {
+		t.Errorf("Unexpected stat: %+v", stat)
+	}
+	if stat.Offset != ix.dataOffset+stat.Start {
+		t.Errorf("Offset %d does not match start %d", stat.Offset, stat.Start)
+	}
+
+	if _, err := ix.Stat("missing.txt"); !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("Expected ErrFileNotFound, got %v", err)
+	}
+}
+
+func TestStatsAndEntries(t *testing.T) {
+	bundlePath := createTestBundle(t, map[string]string{
+		"a.txt":     "alpha",
+		"dir/b.txt": "bravo!",
+	})
+
+	ix, err := NewIxTar(bundlePath)
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	defer ix.Close()
+
+	stats := ix.Stats()
+	if stats.FileCount != 2 || stats.TotalBytes != 11 || stats.CSVSize != ix.csvSize {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+
+	entries := ix.Entries()
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 entries, got %d", len(entries))
+	}
+	if entries[0].Start > entries[1].Start {
+		t.Errorf("Entries not ordered by offset: %+v", entries)
+	}
+}
+
+func TestStatsRatios(t *testing.T) {
+	// Two entries sharing the same data and one sparse entry
+	csvData := hashFilePath(md5Hasher{}, "a.txt") + ",0,4,a.txt\n" +
+		hashFilePath(md5Hasher{}, "copy.txt") + ",0,4,copy.txt\n" +
+		hashFilePath(md5Hasher{}, "sparse.img") + ",4,12,sparse.img,sparse=0:2%3B10:2\n"
+	bundlePath := writeRawBundle(t, csvData, "dataAABB")
+
+	ix, err := NewIxTar(bundlePath)
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	defer ix.Close()
+
+	stats := ix.Stats()
+	if stats.LogicalBytes != 20 || stats.StoredBytes != 12 || stats.UniqueBytes != 8 {
+		t.Errorf("Unexpected byte counts: %+v", stats)
+	}
+	if got := stats.CompressionRatio(); got != 20.0/12.0 {
+		t.Errorf("Expected compression ratio %v, got %v", 20.0/12.0, got)
+	}
+	if got := stats.DedupRatio(); got != 1.5 {
+		t.Errorf("Expected dedup ratio 1.5, got %v", got)
+	}
+
+	plain := createTestBundle(t, map[string]string{"a.txt": "alpha"})
+	ix2, err := NewIxTar(plain)
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	defer ix2.Close()
+	if stats := ix2.Stats(); stats.CompressionRatio() != 1 || stats.DedupRatio() != 1 {
+		t.Errorf("Expected ratios of 1.0 for a plain bundle, got %+v", stats)
+	}
+}
+
+func TestCloseTwice(t *testing.T) {
+	bundlePath := createTestBundle(t, map[string]string{"a.txt": "alpha"})
+
+	for _, opts := range [][]OpenOption{nil, {WithMmap()}, {WithReaderPool(2)}} {
+		ix, err := NewIxTar(bundlePath, opts...)
+		if err != nil {
+			t.Fatalf("Failed to open bundle: %v", err)
+		}
+		if err := ix.Close(); err != nil {
+			t.Errorf("First Close failed: %v", err)
+		}
+		if err := ix.Close(); err != nil {
+			t.Errorf("Second Close failed: %v", err)
+		}
+
+		if _, err := ix.ExtractBytesOfFile("a.txt"); !errors.Is(err, ErrClosed) {
+			t.Errorf("Expected ErrClosed after Close, got %v", err)
+		}
+		if _, err := ix.Bytes("a.txt"); !errors.Is(err, ErrClosed) {
+			t.Errorf("Expected ErrClosed from Bytes after Close, got %v", err)
+		}
+	}
+}
+
+func TestExtractNonRegularFile(t *testing.T) {
+	srcDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(srcDir, "dir", "sub"), 0755); err != nil {
+		t.Fatalf("Failed to create directories: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(srcDir, "dir", "sub", "a.txt"), []byte("alpha"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if err := os.Symlink("dir/sub/a.txt", filepath.Join(srcDir, "link")); err != nil {
+		t.Skipf("Symlinks not supported: %v", err)
+	}
+	bundlePath := filepath.Join(t.TempDir(), "types.ixtar")
+	if err := CreateBundle(srcDir, bundlePath); err != nil {
+		t.Fatalf("Failed to create bundle: %v", err)
+	}
+
+	ix, err := NewIxTar(bundlePath)
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	defer ix.Close()
+
+	for _, dir := range []string{"dir", "dir/sub", "./dir/sub/"} {
+		_, err := ix.ExtractBytesOfFile(dir)
+		if !errors.Is(err, ErrNotRegularFile) || errors.Is(err, ErrFileNotFound) {
+			t.Errorf("%s: expected ErrNotRegularFile, got %v", dir, err)
+		}
+	}
+
+	// Symlinks are skipped at creation, so they are simply missing
+	if _, err := ix.ExtractBytesOfFile("link"); !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("Expected ErrFileNotFound for a symlink, got %v", err)
+	}
+	if _, err := ix.ExtractBytesOfFile("di"); !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("Expected ErrFileNotFound for a path prefix, got %v", err)
+	}
+}
+
+func TestSparseFileRoundTrip(t *testing.T) {
+	tempDir := t.TempDir()
+	srcDir := filepath.Join(tempDir, "src")
+	if err := os.Mkdir(srcDir, 0755); err != nil {
+		t.Fatalf("Failed to create source dir: %v", err)
+	}
+
+	const logicalSize = 4 << 20
+	sparsePath := filepath.Join(srcDir, "sparse.img")
+	f, err := os.Create(sparsePath)
+	if err != nil {
+		t.Fatalf("Failed to create sparse file: %v", err)
+	}
+	if err := f.Truncate(logicalSize); err != nil {
+		t.Fatalf("Failed to truncate sparse file: %v", err)
+	}
+	if _, err := f.WriteAt([]byte("middle"), 2<<20); err != nil {
+		t.Fatalf("Failed to write sparse file: %v", err)
+	}
+	f.Close()
+
+	expected, err := os.ReadFile(sparsePath)
+	if err != nil {
+		t.Fatalf("Failed to read sparse file: %v", err)
+	}
+
+	bundlePath := filepath.Join(tempDir, "sparse.ixtar")
+	if err := CreateBundle(srcDir, bundlePath); err != nil {
+		t.Fatalf("Failed to create bundle: %v", err)
+	}
+
+	ix, err := NewIxTar(bundlePath)
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	defer ix.Close()
+
+	data, err := ix.ExtractBytesOfFile("sparse.img")
+	if err != nil {
+		t.Fatalf("Failed to extract sparse file: %v", err)
+	}
+	if !bytes.Equal(data, expected) {
+		t.Error("Sparse file content mismatch")
+	}
+
+	fileIndex, _ := ix.lookup("sparse.img")
+	if fileIndex.Sparse != nil {
+		if fileIndex.storedSize() >= logicalSize {
+			t.Errorf("Expected sparse file to be stored compactly, stored %d bytes", fileIndex.storedSize())
+		}
+	} else {
+		t.Log("Filesystem does not report holes, file stored densely")
+	}
+
+	outDir := filepath.Join(tempDir, "out")
+	if err := ix.ExtractAll(outDir); err != nil {
+		t.Fatalf("Failed to extract bundle: %v", err)
+	}
+	extracted, err := os.ReadFile(filepath.Join(outDir, "sparse.img"))
+	if err != nil {
+		t.Fatalf("Failed to read extracted file: %v", err)
+	}
+	if !bytes.Equal(extracted, expected) {
+		t.Error("Extracted sparse file content mismatch")
+	}
+
+	if err := ix.VerifyAll(); err != nil {
+		t.Errorf("Expected sparse bundle to verify, got %v", err)
+	}
+}
+
+func TestListFilesSorted(t *testing.T) {
+	testFiles := map[string]string{}
+	for i := 0; i < 20; i++ {
+		testFiles[fmt.Sprintf("dir%d/file%d.txt", i%3, i)] = "x"
+	}
+	bundlePath := createTestBundle(t, testFiles)
+
+	ix, err := NewIxTar(bundlePath)
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	defer ix.Close()
+
+	files := ix.ListFiles()
+	if !sort.StringsAreSorted(files) {
+		t.Errorf("ListFiles is not sorted: %v", files)
+	}
+	for i := 0; i < 5; i++ {
+		if again := ix.ListFiles(); !reflect.DeepEqual(files, again) {
+			t.Fatalf("ListFiles is not stable: %v vs %v", files, again)
+		}
+	}
+
+	paths := ix.ListPaths()
+	if len(paths) != len(testFiles) || !sort.StringsAreSorted(paths) {
+		t.Errorf("ListPaths is not sorted or incomplete: %v", paths)
+	}
+}
+
+func benchmarkExtractAll(b *testing.B, concurrency int) {
+	srcDir := b.TempDir()
+	content := bytes.Repeat([]byte{'x'}, 512)
+	for i := 0; i < 10000; i++ {
+		path := filepath.Join(srcDir, fmt.Sprintf("dir%d", i%100), fmt.Sprintf("file%d.txt", i))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			b.Fatal(err)
+		}
+		if err := os.WriteFile(path, content, 0644); err != nil {
+			b.Fatal(err)
+		}
+	}
+	bundlePath := filepath.Join(b.TempDir(), "bench.ixtar")
+	if err := CreateBundle(srcDir, bundlePath); err != nil {
+		b.Fatal(err)
+	}
+	ix, err := NewIxTar(bundlePath)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer ix.Close()
+
+	outDir := b.TempDir()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := ix.ExtractAllWithOptions(filepath.Join(outDir, fmt.Sprint(i)), ExtractOptions{Concurrency: concurrency}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkExtractAllSerial(b *testing.B) { benchmarkExtractAll(b, 1) }
+
+func BenchmarkExtractAllConcurrent(b *testing.B) { benchmarkExtractAll(b, 8) }
+
+func BenchmarkCreateBundleSmallFiles(b *testing.B) {
+	srcDir := b.TempDir()
+	content := bytes.Repeat([]byte{'x'}, 512)
+	for i := 0; i < 2000; i++ {
+		path := filepath.Join(srcDir, fmt.Sprintf("dir%d", i%20), fmt.Sprintf("file%d.txt", i))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			b.Fatal(err)
+		}
+		if err := os.WriteFile(path, content, 0644); err != nil {
+			b.Fatal(err)
+		}
+	}
+	bundlePath := filepath.Join(b.TempDir(), "bench.ixtar")
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := CreateBundle(srcDir, bundlePath); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestCopyBufferSizeOption(t *testing.T) {
+	srcDir := t.TempDir()
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+	if err := os.WriteFile(filepath.Join(srcDir, "data.bin"), content, 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	bundlePath := filepath.Join(t.TempDir(), "buf.ixtar")
+
+	if _, err := CreateBundleWithOptions(srcDir, bundlePath, CreateOptions{CopyBufferSize: -1}); err == nil {
+		t.Error("Expected error for negative copy buffer size")
+	}
+
+	if _, err := CreateBundleWithOptions(srcDir, bundlePath, CreateOptions{CopyBufferSize: 7}); err != nil {
+		t.Fatalf("Failed to create bundle: %v", err)
+	}
+
+	ix, err := NewIxTar(bundlePath)
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	defer ix.Close()
+
+	data, err := ix.ExtractBytesOfFile("data.bin")
+	if err != nil || !bytes.Equal(data, content) {
+		t.Errorf("Content mismatch with small copy buffer: %v", err)
+	}
+}
+
+func TestCreateWithBaseDir(t *testing.T) {
+	root := t.TempDir()
+	srcDir := filepath.Join(root, "web", "static")
+	if err := os.MkdirAll(filepath.Join(srcDir, "css"), 0755); err != nil {
+		t.Fatalf("Failed to create source dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(srcDir, "css", "site.css"), []byte("body{}"), 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	bundlePath := filepath.Join(t.TempDir(), "base.ixtar")
+
+	if _, err := CreateBundleWithOptions(srcDir, bundlePath, CreateOptions{BaseDir: root}); err != nil {
+		t.Fatalf("Failed to create bundle: %v", err)
+	}
+
+	ix, err := NewIxTar(bundlePath)
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	defer ix.Close()
+
+	if paths := ix.ListPaths(); !reflect.DeepEqual(paths, []string{"web/static/css/site.css"}) {
+		t.Errorf("Expected paths relative to base dir, got %v", paths)
+	}
+	data, err := ix.ExtractBytesOfFile("web/static/css/site.css")
+	if err != nil || string(data) != "body{}" {
+		t.Errorf("Unexpected content: %q, %v", data, err)
+	}
+
+	if _, err := CreateBundleWithOptions(srcDir, bundlePath, CreateOptions{BaseDir: t.TempDir()}); err == nil {
+		t.Error("Expected error when source dir is outside base dir")
+	}
+}
+
+func TestDetectCaseCollisions(t *testing.T) {
+	srcDir := t.TempDir()
+	for _, name := range []string{"Foo.txt", "foo.txt"} {
+		if err := os.WriteFile(filepath.Join(srcDir, name), []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	if entries, _ := os.ReadDir(srcDir); len(entries) != 2 {
+		t.Skip("filesystem is case-insensitive")
+	}
+	bundlePath := filepath.Join(t.TempDir(), "case.ixtar")
+
+	_, err := CreateBundleWithOptions(srcDir, bundlePath, CreateOptions{DetectCaseCollisions: true})
+	if err == nil {
+		t.Fatal("Expected error for paths differing only in case")
+	}
+	if !strings.Contains(err.Error(), "Foo.txt") || !strings.Contains(err.Error(), "foo.txt") {
+		t.Errorf("Expected both paths in error, got %v", err)
+	}
+
+	if _, err := CreateBundleWithOptions(srcDir, bundlePath, CreateOptions{}); err != nil {
+		t.Errorf("Expected creation without detection to succeed, got %v", err)
+	}
+}
+
+func TestControlCharacterNames(t *testing.T) {
+	srcDir := t.TempDir()
+	for _, name := range []string{"ok.txt", "bad\x01name.txt", "line\nbreak.txt"} {
+		if err := os.WriteFile(filepath.Join(srcDir, name), []byte(name), 0644); err != nil {
+			t.Skipf("filesystem rejects %q: %v", name, err)
+		}
+	}
+	bundlePath := filepath.Join(t.TempDir(), "names.ixtar")
+
+	_, err := CreateBundleWithOptions(srcDir, bundlePath, CreateOptions{})
+	if err == nil || !strings.Contains(err.Error(), `"bad\x01name.txt"`) {
+		t.Fatalf("Expected an error naming the path, got %v", err)
+	}
+
+	if _, err := CreateBundleWithOptions(srcDir, bundlePath, CreateOptions{SanitizeNames: true}); err != nil {
+		t.Fatalf("Failed to create bundle: %v", err)
+	}
+	ix, err := NewIxTar(bundlePath)
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	defer ix.Close()
+	if got, want := ix.ListPaths(), []string{"bad_name.txt", "line_break.txt", "ok.txt"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ListPaths() = %q, want %q", got, want)
+	}
+
+	// A replaced path must not overwrite an existing one
+	if err := os.WriteFile(filepath.Join(srcDir, "bad_name.txt"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CreateBundleWithOptions(srcDir, bundlePath, CreateOptions{SanitizeNames: true}); err == nil {
+		t.Error("Expected an error for a sanitized path equal to another path")
+	}
+
+	b, err := NewBuilder()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	if err := b.AddBytes("nul\x00name", []byte("x")); err == nil {
+		t.Error("Expected the builder to reject a NUL in a path")
+	}
+}
+
+func TestLookupStreaming(t *testing.T) {
+	testFiles := map[string]string{
+		"a.txt":     "alpha",
+		"dir/b.txt": "bravo",
+		"dir/c.txt": "charlie",
+	}
+	bundlePath := createTestBundle(t, testFiles)
+
+	ix, err := NewIxTar(bundlePath)
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	defer ix.Close()
+
+	for path := range testFiles {
+		fileIndex, err := LookupStreaming(bundlePath, "./"+path)
+		if err != nil {
+			t.Fatalf("Failed to look up %s: %v", path, err)
+		}
+		if want := ix.index.Files[hashFilePath(md5Hasher{}, path)]; !reflect.DeepEqual(fileIndex, want) {
+			t.Errorf("%s: expected %+v, got %+v", path, want, fileIndex)
+		}
+	}
+
+	if _, err := LookupStreaming(bundlePath, "missing.txt"); !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("Expected ErrFileNotFound, got %v", err)
+	}
+}
+
+func TestExtractAllocations(t *testing.T) {
+	bundlePath := createTestBundle(t, map[string]string{"dir/a.txt": "alpha"})
+
+	ix, err := NewIxTar(bundlePath)
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	defer ix.Close()
+
+	if allocs := testing.AllocsPerRun(100, func() { ix.lookup("dir/a.txt") }); allocs != 0 {
+		t.Errorf("Expected lookup not to allocate, got %v allocs", allocs)
+	}
+	// Only the returned buffer
+	if allocs := testing.AllocsPerRun(100, func() { ix.ExtractBytesOfFile("dir/a.txt") }); allocs != 1 {
+		t.Errorf("Expected 1 alloc per extraction, got %v", allocs)
+	}
+}
+
+func TestCreateDryRun(t *testing.T) {
+	srcDir := t.TempDir()
+	files := map[string]string{
+		".ixtarignore": "*.log\n",
+		"a.txt":        "alpha",
+		"dir/b.txt":    "bravo",
+		"debug.log":    "noise",
+	}
+	for name, content := range files {
+		path := filepath.Join(srcDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	bundlePath := filepath.Join(t.TempDir(), "dry.ixtar")
+
+	plan, err := CreateBundleWithOptions(srcDir, bundlePath, CreateOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("Dry run failed: %v", err)
+	}
+	if _, err := os.Stat(bundlePath); !os.IsNotExist(err) {
+		t.Errorf("Expected no bundle to be written, got %v", err)
+	}
+
+	want := []string{".ixtarignore", "a.txt", "dir/b.txt"}
+	if !reflect.DeepEqual(plan.Paths, want) {
+		t.Errorf("Expected paths %v, got %v", want, plan.Paths)
+	}
+
+	result, err := CreateBundleWithOptions(srcDir, bundlePath, CreateOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create bundle: %v", err)
+	}
+	if plan.Files != result.Files || plan.Bytes != result.Bytes || plan.SkippedIgnored != result.SkippedIgnored {
+		t.Errorf("Dry run %+v doesn't match real run %+v", *plan, *result)
+	}
+	if result.Paths != nil {
+		t.Errorf("Expected Paths only for dry runs, got %v", result.Paths)
+	}
+}
+
+// shortReader serves only part of a file, like a file truncated by another
+// process after it was listed.
+type shortReader struct {
+	r     io.Reader
+	limit int
+}
+
+func (s *shortReader) Read(p []byte) (int, error) {
+	if s.limit <= 0 {
+		return 0, io.EOF
+	}
+	if len(p) > s.limit {
+		p = p[:s.limit]
+	}
+	n, err := s.r.Read(p)
+	s.limit -= n
+	return n, err
+}
+
+func TestCopyFileDataShortRead(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 100)
+	buf := make([]byte, 64)
+
+	var out bytes.Buffer
+	n, err := copyFileData(&out, &shortReader{r: bytes.NewReader(content), limit: 300}, int64(len(content)), buf)
+	if err != nil {
+		t.Fatalf("Unexpected error on short read: %v", err)
+	}
+	if n != 300 || !bytes.Equal(out.Bytes(), content[:300]) {
+		t.Errorf("Expected the 300 readable bytes, got %d", n)
+	}
+
+	out.Reset()
+	n, err = copyFileData(&out, bytes.NewReader(content), 500, buf)
+	if err != nil || n != 500 || out.Len() != 500 {
+		t.Errorf("Expected a grown file to be cut at its listed size, got %d, %v", n, err)
+	}
+}
+
+func benchmarkCreateLargeFiles(b *testing.B, copyBufferSize int) {
+	srcDir := b.TempDir()
+	content := bytes.Repeat([]byte{'x'}, 16<<20)
+	for i := 0; i < 4; i++ {
+		if err := os.WriteFile(filepath.Join(srcDir, fmt.Sprintf("large%d.bin", i)), content, 0644); err != nil {
+			b.Fatal(err)
+		}
+	}
+	bundlePath := filepath.Join(b.TempDir(), "bench.ixtar")
+	opts := CreateOptions{CopyBufferSize: copyBufferSize}
+
+	b.SetBytes(int64(4 * len(content)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := CreateBundleWithOptions(srcDir, bundlePath, opts); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkCreateLargeFiles32KB(b *testing.B) { benchmarkCreateLargeFiles(b, 32<<10) }
+
+func BenchmarkCreateLargeFiles4MB(b *testing.B) { benchmarkCreateLargeFiles(b, 4<<20) }
+
+func TestExtractAllTo(t *testing.T) {
+	testFiles := map[string]string{
+		"a.txt":     "alpha",
+		"dir/b.txt": "bravo",
+	}
+	bundlePath := createTestBundle(t, testFiles)
+
+	ix, err := NewIxTar(bundlePath)
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	defer ix.Close()
+
+	got := make(map[string]string)
+	err = ix.ExtractAllTo(func(name string, r io.Reader, entry FileStat) error {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		if int64(len(data)) != entry.Size {
+			t.Errorf("Size mismatch for %s: %d vs %d", name, len(data), entry.Size)
+		}
+		got[name] = string(data)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ExtractAllTo failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, testFiles) {
+		t.Errorf("Expected %v, got %v", testFiles, got)
+	}
+
+	stop := errors.New("stop")
+	calls := 0
+	err = ix.ExtractAllTo(func(name string, r io.Reader, entry FileStat) error {
+		calls++
+		return stop
+	})
+	if !errors.Is(err, stop) || calls != 1 {
+		t.Errorf("Expected ExtractAllTo to stop at the first error, got %v after %d calls", err, calls)
+	}
+}
+
+func TestNormalizePath(t *testing.T) {
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"file.txt", "file.txt"},
+		{"./file.txt", "file.txt"},
+		{"././file.txt", "file.txt"},
+		{"dir/file.txt", "dir/file.txt"},
+		{"./dir/file.txt", "dir/file.txt"},
+		{"dir//file.txt", "dir/file.txt"},
+		{"dir///sub//file.txt", "dir/sub/file.txt"},
+		{"dir/", "dir"},
+		{"dir/sub//", "dir/sub"},
+		{"dir/./file.txt", "dir/file.txt"},
+		{"dir/sub/../file.txt", "dir/file.txt"},
+		{"/", "/"},
+		{"//", "/"},
+	}
+
+	for _, test := range tests {
+		if result := normalizePath(filepath.FromSlash(test.path)); result != filepath.FromSlash(test.expected) {
+			t.Errorf("normalizePath(%q): expected %q, got %q", test.path, test.expected, result)
+		}
+	}
+}
+
+func TestLookupNormalizedVariants(t *testing.T) {
+	bundlePath := createTestBundle(t, map[string]string{
+		"dir/file.txt": "content",
+	})
+
+	ix, err := NewIxTar(bundlePath)
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	defer ix.Close()
+
+	variants := []string{
+		"dir/file.txt",
+		"./dir/file.txt",
+		"dir//file.txt",
+		".//dir/./file.txt",
+		"dir/sub/../file.txt",
+	}
+	for _, variant := range variants {
+		data, err := ix.ExtractBytesOfFile(variant)
+		if err != nil {
+			t.Errorf("Failed to extract %q: %v", variant, err)
+			continue
+		}
+		if string(data) != "content" {
+			t.Errorf("Content mismatch for %q: %q", variant, data)
+		}
+	}
+}
+
+func TestListUnder(t *testing.T) {
+	bundlePath := createTestBundle(t, map[string]string{
+		"assets/js/app.js":      "app",
+		"assets/js/lib/util.js": "util",
+		"assets/jsx/view.jsx":   "view",
+		"assets/js.map":         "map",
+		"index.html":            "index",
+	})
+
+	ix, err := NewIxTar(bundlePath)
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	defer ix.Close()
+
+	tests := []struct {
+		prefix string
+		want   []string
+	}{
+		{"assets/js", []string{"assets/js/app.js", "assets/js/lib/util.js"}},
+		{"./assets/js/", []string{"assets/js/app.js", "assets/js/lib/util.js"}},
+		{"assets", []string{"assets/js.map", "assets/js/app.js", "assets/js/lib/util.js", "assets/jsx/view.jsx"}},
+		{"index.html", []string{"index.html"}},
+		{"", ix.ListPaths()},
+		{"missing", []string{}},
+	}
+	for _, test := range tests {
+		if got := ix.ListUnder(test.prefix); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ListUnder(%q) = %v, want %v", test.prefix, got, test.want)
+		}
+	}
+}
+
+func TestGroups(t *testing.T) {
+	bundlePath := createTestBundle(t, map[string]string{
+		"assets/js/app.js": "app",
+		"assets/style.css": "style",
+		"docs/readme.md":   "readme",
+		"index.html":       "index",
+		"robots.txt":       "robots",
+	})
+
+	ix, err := NewIxTar(bundlePath)
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	defer ix.Close()
+
+	want := map[string][]string{
+		"":       {"index.html", "robots.txt"},
+		"assets": {"assets/js/app.js", "assets/style.css"},
+		"docs":   {"docs/readme.md"},
+	}
+	if got := ix.Groups(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Groups() = %v, want %v", got, want)
+	}
+}
+
+func TestCreateSkipHidden(t *testing.T) {
+	srcDir := filepath.Join(t.TempDir(), ".src")
+	files := map[string]string{
+		"a.txt":           "alpha",
+		".DS_Store":       "finder",
+		".git/HEAD":       "ref: refs/heads/main",
+		".git/refs/x":     "deep",
+		"dir/b.txt":       "bravo",
+		"dir/.hidden.txt": "secret",
+		"dir.d/c.txt":     "charlie",
+	}
+	for name, content := range files {
+		path := filepath.Join(srcDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	// The hidden source directory itself is walked
+	result, err := CreateBundleWithOptions(srcDir, filepath.Join(t.TempDir(), "b.ixtar"), CreateOptions{SkipHidden: true, DryRun: true})
+	if err != nil {
+		t.Fatalf("Failed to create bundle: %v", err)
+	}
+	if want := []string{"a.txt", "dir/b.txt", "dir.d/c.txt"}; !reflect.DeepEqual(result.Paths, want) {
+		t.Errorf("Expected paths %v, got %v", want, result.Paths)
+	}
+	// .DS_Store, .git (pruned as a whole) and dir/.hidden.txt
+	if result.SkippedHidden != 3 {
+		t.Errorf("Expected 3 hidden entries skipped, got %d", result.SkippedHidden)
+	}
+
+	result, err = CreateBundleWithOptions(srcDir, filepath.Join(t.TempDir(), "all.ixtar"), CreateOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create bundle: %v", err)
+	}
+	if result.Files != len(files) || result.SkippedHidden != 0 {
+		t.Errorf("Expected hidden files to be included by default, got %+v", *result)
+	}
+}
+
+func TestCreateFilter(t *testing.T) {
+	srcDir := t.TempDir()
+	files := map[string]string{
+		"a.txt":            "alpha",
+		"b.tmp":            "scratch",
+		"vendor/x.txt":     "vendored",
+		"vendor/sub/y.txt": "deep",
+		"dir/c.txt":        "charlie",
+		"dir/d.tmp":        "scratch",
+	}
+	for name, content := range files {
+		path := filepath.Join(srcDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	var visited []string
+	bundlePath := filepath.Join(t.TempDir(), "filtered.ixtar")
+	result, err := CreateBundleWithOptions(srcDir, bundlePath, CreateOptions{
+		Filter: func(path string, info os.FileInfo) error {
+			rel, _ := filepath.Rel(srcDir, path)
+			visited = append(visited, filepath.ToSlash(rel))
+			if info.IsDir() && info.Name() == "vendor" || strings.HasSuffix(path, ".tmp") {
+				return filepath.SkipDir
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create bundle: %v", err)
+	}
+	// vendor is pruned as a whole and only the .tmp files next to others
+	// are skipped
+	if result.SkippedFiltered != 3 || result.Files != 2 {
+		t.Errorf("Expected 2 files and 3 filtered entries, got %+v", *result)
+	}
+	for _, path := range visited {
+		if strings.HasPrefix(path, "vendor/") {
+			t.Errorf("Expected vendor not to be descended into, visited %s", path)
+		}
+	}
+
+	ix, err := NewIxTar(bundlePath)
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	defer ix.Close()
+	if got, want := ix.ListPaths(), []string{"a.txt", "dir/c.txt"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected paths %v, got %v", want, got)
+	}
+
+	// Other errors abort
+	filterErr := errors.New("stop here")
+	_, err = CreateBundleWithOptions(srcDir, filepath.Join(t.TempDir(), "aborted.ixtar"), CreateOptions{
+		Filter: func(path string, info os.FileInfo) error { return filterErr },
+	})
+	if !errors.Is(err, filterErr) {
+		t.Errorf("Expected the filter error, got %v", err)
+	}
+}
+
+func TestCreateModifiedAfter(t *testing.T) {
+	srcDir := t.TempDir()
+	snapshot := time.Now().Add(-time.Hour)
+	mtimes := map[string]time.Time{
+		"old.txt":     snapshot.Add(-24 * time.Hour),
+		"same.txt":    snapshot,
+		"new.txt":     snapshot.Add(time.Minute),
+		"dir/old.txt": snapshot.Add(-time.Minute),
+		"dir/new.txt": snapshot.Add(30 * time.Minute),
+	}
+	for name, mtime := range mtimes {
+		path := filepath.Join(srcDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatalf("Failed to set mtime of %s: %v", name, err)
+		}
+	}
+	// An old directory is still walked for new files
+	if err := os.Chtimes(filepath.Join(srcDir, "dir"), snapshot.Add(-48*time.Hour), snapshot.Add(-48*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	var total int
+	bundlePath := filepath.Join(t.TempDir(), "incremental.ixtar")
+	result, err := CreateBundleWithOptions(srcDir, bundlePath, CreateOptions{
+		ModifiedAfter: snapshot,
+		Progress:      func(current, n int, _ string) { total = n },
+	})
+	if err != nil {
+		t.Fatalf("Failed to create bundle: %v", err)
+	}
+	if result.Files != 2 || result.SkippedOlder != 3 {
+		t.Errorf("Expected 2 files and 3 older ones, got %+v", *result)
+	}
+	if total != 2 {
+		t.Errorf("Expected progress to count 2 files, got %d", total)
+	}
+
+	ix, err := NewIxTar(bundlePath)
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	defer ix.Close()
+	if got, want := ix.ListPaths(), []string{"dir/new.txt", "new.txt"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected paths %v, got %v", want, got)
+	}
+}
+
+func TestCreateIndexCallback(t *testing.T) {
+	srcDir := t.TempDir()
+	for name, content := range map[string]string{"a.txt": "alpha", "b/c.txt": "charlie", "d.txt": ""} {
+		path := filepath.Join(srcDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	type entry struct {
+		path, hash string
+		fi         FileIndex
+	}
+	var seen []entry
+	bundlePath := filepath.Join(t.TempDir(), "test.ixtar")
+	_, err := CreateBundleWithOptions(srcDir, bundlePath, CreateOptions{
+		IndexCallback: func(path, hash string, fi FileIndex) {
+			seen = append(seen, entry{path, hash, fi})
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create bundle: %v", err)
+	}
+
+	ix, err := NewIxTar(bundlePath)
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	defer ix.Close()
+	if len(seen) != ix.Len() {
+		t.Fatalf("Expected %d callbacks, got %d", ix.Len(), len(seen))
+	}
+	var end int64
+	for _, e := range seen {
+		if got := ix.files()[e.hash]; !reflect.DeepEqual(got, e.fi) || e.path != e.fi.Path {
+			t.Errorf("%s: reported %+v, index has %+v", e.path, e.fi, got)
+		}
+		// In storage order
+		if e.fi.Start != end {
+			t.Errorf("%s: expected to start at %d, got %d", e.path, end, e.fi.Start)
+		}
+		end = e.fi.Start + e.fi.storedSize()
+	}
+}
+
+// upperReader upper-cases ASCII letters as they are read.
+type upperReader struct{ r io.Reader }
+
+func (u upperReader) Read(p []byte) (int, error) {
+	n, err := u.r.Read(p)
+	copy(p, bytes.ToUpper(p[:n]))
+	return n, err
+}
+
+func TestCreateTransform(t *testing.T) {
+	srcDir := t.TempDir()
+	files := map[string]string{
+		"a.txt":     "alpha",
+		"dir/b.txt": strings.Repeat("bravo ", 1000),
+		"c.bin":     "keep me",
+		"bad.txt":   "fails",
+		"empty.txt": "",
+	}
+	for name, content := range files {
+		path := filepath.Join(srcDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	// .txt files are upper-cased and dir/b.txt also grows tenfold, past
+	// its size in the source tree
+	bundlePath := filepath.Join(t.TempDir(), "transformed.ixtar")
+	var skipped []string
+	result, err := CreateBundleWithOptions(srcDir, bundlePath, CreateOptions{
+		ContinueOnError: true,
+		OnError:         func(path string, err error) { skipped = append(skipped, filepath.Base(path)) },
+		Compress:        func(path string) bool { return strings.HasPrefix(path, "dir/") },
+		Transform: func(path string, r io.Reader) (io.Reader, error) {
+			switch {
+			case path == "bad.txt":
+				return nil, errors.New("can't transform")
+			case path == "dir/b.txt":
+				data, err := io.ReadAll(r)
+				return upperReader{bytes.NewReader(bytes.Repeat(data, 10))}, err
+			case strings.HasSuffix(path, ".txt"):
+				return upperReader{r}, nil
+			}
+			return r, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create bundle: %v", err)
+	}
+	if !reflect.DeepEqual(skipped, []string{"bad.txt"}) || result.Files != 4 {
+		t.Errorf("Expected only bad.txt to be skipped, got %v and %+v", skipped, result)
+	}
+
+	ix, err := NewIxTar(bundlePath, WithVerifyOnRead())
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	defer ix.Close()
+	want := map[string]string{
+		"a.txt":     "ALPHA",
+		"dir/b.txt": strings.Repeat("BRAVO ", 10000),
+		"c.bin":     "keep me",
+		"empty.txt": "",
+	}
+	for name, content := range want {
+		stat, err := ix.Stat(name)
+		if err != nil || stat.Size != int64(len(content)) {
+			t.Errorf("%s: expected size %d, got %+v (%v)", name, len(content), stat, err)
+		}
+		if got, err := ix.ExtractBytesOfFile(name); err != nil || string(got) != content {
+			t.Errorf("%s: got %d bytes (%v)", name, len(got), err)
+		}
+	}
+	if err := ix.VerifyAll(); err != nil {
+		t.Errorf("VerifyAll failed: %v", err)
+	}
+
+	_, err = CreateBundleWithOptions(srcDir, bundlePath, CreateOptions{
+		Transform: func(path string, r io.Reader) (io.Reader, error) {
+			return nil, errors.New("can't transform")
+		},
+	})
+	if err == nil || !strings.Contains(err.Error(), "can't transform") {
+		t.Errorf("Expected the transform error, got %v", err)
+	}
+}
+
+func TestExtractTooLarge(t *testing.T) {
+	bundlePath := createTestBundle(t, map[string]string{"big.bin": "0123456789"})
+	ix, err := NewIxTar(bundlePath)
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	defer ix.Close()
+
+	// Pretend to be a platform where 10 bytes don't fit in an int
+	defer func(old int64) { maxInMemorySize = old }(maxInMemorySize)
+	maxInMemorySize = 8
+
+	if _, err := ix.ExtractBytesOfFile("big.bin"); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Expected ErrTooLarge, got %v", err)
+	}
+	if _, err := ix.ExtractRange("big.bin", 0, 10); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Expected ErrTooLarge from ExtractRange, got %v", err)
+	}
+	if got, err := ix.ExtractRange("big.bin", 2, 4); err != nil || string(got) != "2345" {
+		t.Errorf("Expected a small range to work, got %q (%v)", got, err)
+	}
+
+	var buf bytes.Buffer
+	if _, err := ix.ExtractToWriter("big.bin", &buf); err != nil || buf.String() != "0123456789" {
+		t.Errorf("Expected ExtractToWriter to stream the file, got %q (%v)", buf.String(), err)
+	}
+}
+
+func TestExtractNthAndByOffset(t *testing.T) {
+	testFiles := map[string]string{
+		"a.txt":     "alpha",
+		"b.txt":     "bravo",
+		"dir/c.txt": "charlie",
+		"empty.txt": "",
+	}
+	ix, err := NewIxTar(createTestBundle(t, testFiles))
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	defer ix.Close()
+
+	entries := ix.Entries()
+	for i, entry := range entries {
+		got, err := ix.ExtractNth(i)
+		if err != nil || string(got) != testFiles[entry.Path] {
+			t.Errorf("ExtractNth(%d): expected %q, got %q (%v)", i, testFiles[entry.Path], got, err)
+		}
+		if i > 0 && entry.Start < entries[i-1].Start {
+			t.Errorf("Entries not ordered by offset at %d", i)
+		}
+	}
+	for _, i := range []int{-1, len(entries)} {
+		if _, err := ix.ExtractNth(i); !errors.Is(err, ErrFileNotFound) {
+			t.Errorf("ExtractNth(%d): expected ErrFileNotFound, got %v", i, err)
+		}
+	}
+
+	stat, err := ix.Stat("dir/c.txt")
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if got, err := ix.ExtractByOffset(stat.Start); err != nil || string(got) != "charlie" {
+		t.Errorf("ExtractByOffset(%d): expected %q, got %q (%v)", stat.Start, "charlie", got, err)
+	}
+	if _, err := ix.ExtractByOffset(stat.Start + 1); !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("Expected ErrFileNotFound inside a file, got %v", err)
+	}
+}
+
+func TestExtractByHash(t *testing.T) {
+	testFiles := map[string]string{"a.txt": "alpha", "dir/b.txt": "bravo"}
+	ix, err := NewIxTar(createTestBundle(t, testFiles))
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	defer ix.Close()
+
+	for _, entry := range ix.Entries() {
+		got, err := ix.ExtractByHash(entry.Hash)
+		if err != nil {
+			t.Fatalf("ExtractByHash(%s) failed: %v", entry.Hash, err)
+		}
+		if string(got) != testFiles[entry.Path] {
+			t.Errorf("ExtractByHash(%s): expected %q, got %q", entry.Hash, testFiles[entry.Path], got)
+		}
+	}
+
+	if _, err := ix.ExtractByHash("0000000000000000"); !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("Expected ErrFileNotFound for an unknown hash, got %v", err)
+	}
+	if _, err := ix.ExtractByHash("abc"); err == nil || errors.Is(err, ErrFileNotFound) {
+		t.Errorf("Expected an invalid hash error, got %v", err)
+	}
+}
+
+// failingTemp returns a createTemp replacement whose files matching pattern
+// are opened with only the given access, so writes or reads fail.
+func failingTemp(t *testing.T, pattern string, flag int) func(dir, p string) (*os.File, error) {
+	return func(dir, p string) (*os.File, error) {
+		f, err := os.CreateTemp(dir, p)
+		if err != nil || p != pattern {
+			return f, err
+		}
+		name := f.Name()
+		f.Close()
+		return os.OpenFile(name, flag, 0)
+	}
+}
+
+func TestCreateStagingErrors(t *testing.T) {
+	srcDir := t.TempDir()
+	big := bytes.Repeat([]byte("x"), 2*dataBufferSize)
+	for _, name := range []string{"a.bin", "b.bin"} {
+		if err := os.WriteFile(filepath.Join(srcDir, name), big, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer func(old func(string, string) (*os.File, error)) { createTemp = old }(createTemp)
+
+	tests := []struct {
+		name    string
+		pattern string
+		flag    int
+		wantErr string
+		// Only bundles written to an io.Writer stage their data
+		toWriter bool
+	}{
+		// Writing the staged data fails while files are copied
+		{"data write", "ixtar-data-*.tmp", os.O_RDONLY, "failed to write data of", true},
+		// Writing the index works, reading it back for the bundle fails
+		{"csv read", "ixtar-csv-*.tmp", os.O_WRONLY, "failed to checksum CSV data", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			createTemp = failingTemp(t, test.pattern, test.flag)
+			bundlePath := filepath.Join(t.TempDir(), "out.ixtar")
+
+			// A staging error is not a source file error to skip
+			opts := CreateOptions{ContinueOnError: true}
+			var out bytes.Buffer
+			var err error
+			if test.toWriter {
+				_, err = CreateBundleToWriter(srcDir, &out, opts)
+			} else {
+				_, err = CreateBundleWithOptions(srcDir, bundlePath, opts)
+			}
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Fatalf("Expected error containing %q, got %v", test.wantErr, err)
+			}
+			if _, statErr := os.Stat(bundlePath); !os.IsNotExist(statErr) {
+				t.Errorf("Expected no partial bundle after %v, got %v", err, statErr)
+			}
+			if out.Len() != 0 {
+				t.Errorf("Expected nothing written after %v, got %d bytes", err, out.Len())
+			}
+		})
+	}
+}
+
+func TestCreateTempDir(t *testing.T) {
+	srcDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("alpha"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var dirs []string
+	defer func(old func(string, string) (*os.File, error)) { createTemp = old }(createTemp)
+	createTemp = func(dir, pattern string) (*os.File, error) {
+		dirs = append(dirs, dir)
+		return os.CreateTemp(dir, pattern)
+	}
+
+	outDir := t.TempDir()
+	if _, err := CreateBundleWithOptions(srcDir, filepath.Join(outDir, "default.ixtar"), CreateOptions{}); err != nil {
+		t.Fatalf("Failed to create bundle: %v", err)
+	}
+	stagingDir := t.TempDir()
+	if _, err := CreateBundleWithOptions(srcDir, filepath.Join(outDir, "staged.ixtar"), CreateOptions{TempDir: stagingDir}); err != nil {
+		t.Fatalf("Failed to create bundle: %v", err)
+	}
+	// Bundles are written in place, so only the index is staged
+	if want := []string{outDir, stagingDir}; !reflect.DeepEqual(dirs, want) {
+		t.Errorf("Expected staging in %v, got %v", want, dirs)
+	}
+	if entries, _ := os.ReadDir(stagingDir); len(entries) != 0 {
+		t.Errorf("Expected staging files to be removed, found %d", len(entries))
+	}
+
+	_, err := CreateBundleWithOptions(srcDir, filepath.Join(outDir, "bad.ixtar"), CreateOptions{TempDir: filepath.Join(outDir, "missing")})
+	if err == nil || !strings.Contains(err.Error(), "temp directory") {
+		t.Errorf("Expected temp directory error, got %v", err)
+	}
+}
+
+func TestCreateBundleToWriter(t *testing.T) {
+	srcDir := t.TempDir()
+	testFiles := map[string]string{"a.txt": "alpha", "sub/b.txt": "beta"}
+	for name, content := range testFiles {
+		path := filepath.Join(srcDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stagingDir := t.TempDir()
+
+	pr, pw := io.Pipe()
+	go func() {
+		_, err := CreateBundleToWriter(srcDir, pw, CreateOptions{TempDir: stagingDir, Trailer: true})
+		pw.CloseWithError(err)
+	}()
+	data, err := io.ReadAll(pr)
+	if err != nil {
+		t.Fatalf("Failed to create bundle: %v", err)
+	}
+
+	ix, err := NewIxTarAt(bytes.NewReader(data), 0, int64(len(data)))
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	defer ix.Close()
+	for name, content := range testFiles {
+		got, err := ix.ExtractBytesOfFile(name)
+		if err != nil {
+			t.Fatalf("Failed to extract %s: %v", name, err)
+		}
+		if string(got) != content {
+			t.Errorf("Expected %q for %s, got %q", content, name, got)
+		}
+	}
+
+	// Write errors of the destination are returned
+	pr, pw = io.Pipe()
+	writeErr := errors.New("connection reset")
+	pr.CloseWithError(writeErr)
+	if _, err := CreateBundleToWriter(srcDir, pw, CreateOptions{TempDir: stagingDir}); !errors.Is(err, writeErr) {
+		t.Errorf("Expected %v, got %v", writeErr, err)
+	}
+	if entries, _ := os.ReadDir(stagingDir); len(entries) != 0 {
+		t.Errorf("Expected staging files to be removed, found %d", len(entries))
+	}
+}
+
+func TestRawIndex(t *testing.T) {
+	bundlePath := createTestBundle(t, map[string]string{"a.txt": "alpha", "dir/b.txt": "beta"})
+
+	ix, err := NewIxTar(bundlePath)
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	defer ix.Close()
+
+	raw, err := ix.RawIndex()
+	if err != nil {
+		t.Fatalf("RawIndex failed: %v", err)
+	}
+	bundle, err := os.ReadFile(bundlePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	layout := ix.Layout()
+	if want := bundle[layout.CSVOffset : layout.CSVOffset+layout.CSVSize]; !bytes.Equal(raw, want) {
+		t.Errorf("Expected the stored index %q, got %q", want, raw)
+	}
+
+	index, err := parseCSVIndex(raw)
+	if err != nil {
+		t.Fatalf("Failed to parse raw index: %v", err)
+	}
+	if len(index.Files) != 2 {
+		t.Errorf("Expected 2 entries, got %d", len(index.Files))
+	}
+}
+
+func TestCreateProgressReachesTotal(t *testing.T) {
+	srcDir := t.TempDir()
+	for _, name := range []string{"a.txt", "b.txt", "sub/c.txt", "skip.log", ".hidden/d.txt"} {
+		path := filepath.Join(srcDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(srcDir, IgnoreFileName), []byte("*.log\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var calls [][2]int
+	_, err := CreateBundleWithOptions(srcDir, filepath.Join(t.TempDir(), "out.ixtar"), CreateOptions{
+		SkipHidden: true,
+		Progress: func(current, total int, filename string) {
+			calls = append(calls, [2]int{current, total})
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create bundle: %v", err)
+	}
+	// The ignore file itself is hidden. More calls are made on slow machines
+	if len(calls) == 0 || calls[len(calls)-1] != [2]int{3, 3} {
+		t.Fatalf("Expected the last progress call to be 3 of 3, got %v", calls)
+	}
+	for i, call := range calls {
+		if call[1] != 3 || i > 0 && call[0] <= calls[i-1][0] {
+			t.Errorf("Unexpected progress calls %v", calls)
+			break
+		}
+	}
+}
+
+func TestCreateAbortableProgress(t *testing.T) {
+	srcDir := t.TempDir()
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		if err := os.WriteFile(filepath.Join(srcDir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Abort on the call after the second file, or on the final call
+	interrupted := errors.New("interrupted")
+	bundlePath := filepath.Join(t.TempDir(), "aborted.ixtar")
+	_, err := CreateBundleWithOptions(srcDir, bundlePath, CreateOptions{
+		AbortableProgress: func(current, total int, filename string) error {
+			if current >= 2 {
+				return interrupted
+			}
+			return nil
+		},
+	})
+	if !errors.Is(err, interrupted) {
+		t.Fatalf("Expected the create to be aborted, got %v", err)
+	}
+	if _, err := os.Stat(bundlePath); !os.IsNotExist(err) {
+		t.Errorf("Expected the aborted bundle to be removed, got %v", err)
+	}
+	if entries, err := os.ReadDir(filepath.Dir(bundlePath)); err != nil || len(entries) != 0 {
+		t.Errorf("Expected no files left behind, got %v (%v)", entries, err)
+	}
+
+	_, err = CreateBundleWithOptions(srcDir, bundlePath, CreateOptions{
+		Progress:          func(current, total int, filename string) {},
+		AbortableProgress: func(current, total int, filename string) error { return nil },
+	})
+	if err == nil {
+		t.Error("Expected Progress and AbortableProgress together to be refused")
+	}
+}
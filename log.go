@@ -0,0 +1,25 @@
+package ixtar
+
+import (
+	"context"
+	"log/slog"
+)
+
+// orDiscard returns l, or a logger that drops every record if l is nil, so
+// the Logger options of the library default to silence.
+func orDiscard(l *slog.Logger) *slog.Logger {
+	if l == nil {
+		return discardLogger
+	}
+	return l
+}
+
+var discardLogger = slog.New(discardHandler{})
+
+// discardHandler is an slog.Handler that is never enabled.
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
@@ -0,0 +1,87 @@
+package ixtar
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testLogger(buf *bytes.Buffer) *slog.Logger {
+	return slog.New(slog.NewTextHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+}
+
+func TestLogger(t *testing.T) {
+	srcDir := t.TempDir()
+	for name, content := range map[string]string{"a.txt": "hello", ".hidden": "secret"} {
+		if err := os.WriteFile(filepath.Join(srcDir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("a.txt", filepath.Join(srcDir, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	var logs bytes.Buffer
+	bundlePath := filepath.Join(t.TempDir(), "logged.ixtar")
+	_, err := CreateBundleWithOptions(srcDir, bundlePath, CreateOptions{SkipHidden: true, Logger: testLogger(&logs)})
+	if err != nil {
+		t.Fatalf("Failed to create bundle: %v", err)
+	}
+	for _, want := range []string{
+		"level=DEBUG msg=skipped path=" + filepath.Join(srcDir, ".hidden") + " reason=hidden",
+		"level=INFO msg=skipped path=" + filepath.Join(srcDir, "link") + " reason=symlink",
+		`level=INFO msg="indexed files" files=1 bytes=5`,
+	} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("Expected log line with %q, got:\n%s", want, logs.String())
+		}
+	}
+
+	// Corrupt a.txt for verify, then cut it off for repair
+	ix, err := NewIxTar(bundlePath)
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	dataOffset := ix.Layout().DataOffset
+	ix.Close()
+	f, err := os.OpenFile(bundlePath, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt([]byte("J"), dataOffset); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	logs.Reset()
+	ix, err = NewIxTar(bundlePath)
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	err = ix.VerifyAllWithOptions(VerifyOptions{Logger: testLogger(&logs)})
+	ix.Close()
+	if err == nil {
+		t.Fatal("Expected a checksum mismatch")
+	}
+	for _, want := range []string{`level=WARN msg="verify mismatch"`, `msg="verified files" files=1 failed=1`} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("Expected log line with %q, got:\n%s", want, logs.String())
+		}
+	}
+
+	logs.Reset()
+	if err := os.Truncate(bundlePath, dataOffset+2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := RepairWithOptions(bundlePath, RepairOptions{Logger: testLogger(&logs)}); err != nil {
+		t.Fatalf("Repair failed: %v", err)
+	}
+	for _, want := range []string{`level=WARN msg="dropped entry past the end of the data" path=a.txt`, `msg="repaired bundle" kept=0 dropped=1`} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("Expected log line with %q, got:\n%s", want, logs.String())
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package ixtar
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// WithLowMemoryIndex keeps the index on disk instead of parsing it into a
+// map. Opening reads it once, record by record, and keeps only the keys with
+// the offsets of their records, sorted, which takes 16 bytes per file; a
+// lookup by path binary-searches them and reads the one record it needs. A
+// lookup of a missing path reads the whole index again to tell a directory
+// from a missing file. Methods that go through every file, such as
+// WalkFiles, ListPaths or Stats, parse the whole index on first use and keep
+// it, which gives up the savings. Bundles created with a custom Keyer or an
+// encrypted index, and NewIxTarFromStream, are not supported.
+func WithLowMemoryIndex() OpenOption {
+	return func(c *openConfig) {
+		c.lowMemory = true
+	}
+}
+
+// lowMemIndex locates the records of the CSV index of csvSize bytes that
+// follows the header of a bundle opened WithLowMemoryIndex.
+type lowMemIndex struct {
+	slots   []indexSlot // sorted by key
+	csvSize int64
+}
+
+// indexSlot is the key of an index record, decoded from hex, and the offset
+// of the record in the CSV index.
+type indexSlot struct {
+	key uint64
+	off int64
+}
+
+// slotKey decodes an index key of a built-in hash.
+func slotKey(hash string) (uint64, bool) {
+	var b [HashLen / 2]byte
+	if len(hash) != HashLen {
+		return 0, false
+	}
+	if _, err := hex.Decode(b[:], []byte(hash)); err != nil {
+		return 0, false
+	}
+	return binary.BigEndian.Uint64(b[:]), true
+}
+
+// scanLowMemIndex reads the CSV index of csvSize bytes in r record by record
+// and returns where each record is, checking the records like openReaderAt
+// checks a parsed index; check is called for every entry. The returned
+// index holds the first entry with a directory in its path, which is all
+// legacyBackslashKeys looks at.
+func scanLowMemIndex(r io.ReaderAt, csvSize int64, check func(hash string, fileIndex FileIndex) error) (*lowMemIndex, DataIndex, error) {
+	l := &lowMemIndex{csvSize: csvSize}
+	sample := DataIndex{Files: make(map[string]FileIndex)}
+
+	reader := csv.NewReader(bufio.NewReader(io.NewSectionReader(r, headerSize, csvSize)))
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+	for {
+		off := reader.InputOffset()
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, DataIndex{}, fmt.Errorf("failed to parse CSV index: failed to parse CSV: %w", err)
+		}
+		hash, fileIndex, err := parseCSVRecord(record)
+		if err != nil {
+			return nil, DataIndex{}, fmt.Errorf("failed to parse CSV index: %w", err)
+		}
+		key, ok := slotKey(hash)
+		if !ok {
+			return nil, DataIndex{}, fmt.Errorf("%w: index key %q is not a %d character hash", ErrBadFormat, hash, HashLen)
+		}
+		if err := check(hash, fileIndex); err != nil {
+			return nil, DataIndex{}, err
+		}
+		if len(sample.Files) == 0 && strings.Contains(fileIndex.Path, "/") {
+			sample.Files[hash] = fileIndex
+		}
+		l.slots = append(l.slots, indexSlot{key, off})
+	}
+
+	// Like the map of a parsed index, the last record of a key wins
+	sort.SliceStable(l.slots, func(i, j int) bool { return l.slots[i].key < l.slots[j].key })
+	slots := l.slots[:0]
+	for i, slot := range l.slots {
+		if i+1 < len(l.slots) && l.slots[i+1].key == slot.key {
+			continue
+		}
+		slots = append(slots, slot)
+	}
+	l.slots = slots[:len(slots):len(slots)]
+	return l, sample, nil
+}
+
+// find returns the entry of the index key hash, reading its record from r,
+// the bundle.
+func (l *lowMemIndex) find(r io.ReaderAt, hash string) (FileIndex, bool, error) {
+	key, ok := slotKey(hash)
+	if !ok {
+		return FileIndex{}, false, nil
+	}
+	i := sort.Search(len(l.slots), func(i int) bool { return l.slots[i].key >= key })
+	if i == len(l.slots) || l.slots[i].key != key {
+		return FileIndex{}, false, nil
+	}
+
+	off := l.slots[i].off
+	reader := csv.NewReader(bufio.NewReaderSize(io.NewSectionReader(r, headerSize+off, l.csvSize-off), 512))
+	reader.FieldsPerRecord = -1
+	record, err := reader.Read()
+	if err != nil {
+		return FileIndex{}, false, fmt.Errorf("failed to read index record: %w", err)
+	}
+	_, fileIndex, err := parseCSVRecord(record)
+	if err != nil {
+		return FileIndex{}, false, err
+	}
+	return fileIndex, true, nil
+}
+
+// hasDir reports whether dir is a directory implied by a stored path, reading
+// the index from r, the bundle.
+func (l *lowMemIndex) hasDir(r io.ReaderAt, dir string) (bool, error) {
+	if dir == "." || dir == "/" {
+		return false, nil
+	}
+	reader := csv.NewReader(bufio.NewReader(io.NewSectionReader(r, headerSize, l.csvSize)))
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return false, nil
+		}
+		if err != nil {
+			return false, fmt.Errorf("failed to parse CSV: %w", err)
+		}
+		if len(record) > 3 && strings.HasPrefix(record[3], dir) && len(record[3]) > len(dir) && record[3][len(dir)] == '/' {
+			return true, nil
+		}
+	}
+}
+
+// load parses the whole index from r, the bundle.
+func (l *lowMemIndex) load(r io.ReaderAt) (DataIndex, error) {
+	csvData := make([]byte, l.csvSize)
+	if _, err := r.ReadAt(csvData, headerSize); err != nil {
+		return DataIndex{}, fmt.Errorf("failed to read CSV data: %w", err)
+	}
+	return parseCSVIndex(csvData)
+}
+
+// openLowMemory is openReaderAt for WithLowMemoryIndex.
+func openLowMemory(r io.ReaderAt, size int64, header bundleHeader, cfg openConfig) (*IxTar, error) {
+	infoData := make([]byte, header.infoSize)
+	if _, err := r.ReadAt(infoData, headerSize+header.csvSize); err != nil {
+		return nil, fmt.Errorf("failed to read bundle info: %w", err)
+	}
+	// Checked first, so corruption isn't reported as a parse error
+	if err := header.checkIndexCRCFrom(io.NewSectionReader(r, headerSize, header.csvSize), infoData); err != nil {
+		return nil, err
+	}
+	info, err := parseBundleInfo(infoData)
+	if err != nil {
+		return nil, err
+	}
+	if info.Keyer != "" {
+		return nil, fmt.Errorf("bundle is keyed by %q, which WithLowMemoryIndex doesn't support", info.Keyer)
+	}
+	if header.flags&flagEncryptedIndex != 0 {
+		return nil, fmt.Errorf("bundle has an encrypted index, which WithLowMemoryIndex doesn't support")
+	}
+	info.warnNewerMinor(orDiscard(cfg.logger), header)
+	aead, err := info.openCipher(header, cfg)
+	if err != nil {
+		return nil, err
+	}
+	dataOffset, dataSize, err := dataRegion(r, size, header)
+	if err != nil {
+		return nil, err
+	}
+
+	low, sample, err := scanLowMemIndex(r, header.csvSize, func(hash string, fileIndex FileIndex) error {
+		if cfg.validate {
+			return checkDataRegion(hash, fileIndex, dataOffset, dataSize)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	hasher, _, err := resolveKeyer(header, info, sample, cfg.keyer)
+	if err != nil {
+		return nil, err
+	}
+
+	return &IxTar{
+		low:        low,
+		csvSize:    header.csvSize,
+		bundleSize: size,
+		dataOffset: dataOffset,
+		dataSize:   dataSize,
+		reader:     r,
+		header:     header,
+		hasher:     hasher,
+		info:       info,
+		readAhead:  cfg.readAheadSize,
+		verify:     cfg.verifyOnRead,
+		aead:       aead,
+	}, nil
+}
+
+// loadFiles parses the whole index of a bundle opened WithLowMemoryIndex on
+// first use. A failed load, which takes an I/O error since the index was
+// parsed when the bundle was opened, is returned and tried again next time.
+func (ix *IxTar) loadFiles() error {
+	if ix.low == nil {
+		return nil
+	}
+	ix.loadMu.Lock()
+	defer ix.loadMu.Unlock()
+	if ix.index.Files != nil {
+		return nil
+	}
+	index, err := ix.low.load(ix.reader)
+	if err != nil {
+		return err
+	}
+	ix.index = index
+	return nil
+}
+
+// files returns the entries of the bundle by index key. A bundle opened
+// WithLowMemoryIndex appears empty while loadFiles fails, so methods that
+// can return an error call loadFiles first.
+func (ix *IxTar) files() map[string]FileIndex {
+	if ix.loadFiles() != nil {
+		return nil
+	}
+	return ix.index.Files
+}
+
+// fileCount returns the number of entries without parsing the index.
+func (ix *IxTar) fileCount() int {
+	if ix.low != nil {
+		return len(ix.low.slots)
+	}
+	return len(ix.index.Files)
+}
@@ -0,0 +1,108 @@
+package ixtar
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestLowMemoryIndex(t *testing.T) {
+	testFiles := map[string]string{
+		"a.txt":         "alpha",
+		"dir/b.txt":     "bravo",
+		"dir/sub/c.txt": "charlie",
+		"empty.txt":     "",
+	}
+	for i := 0; i < 100; i++ {
+		testFiles[fmt.Sprintf("many/file%03d.txt", i)] = fmt.Sprintf("content %d", i)
+	}
+	bundlePath := createTestBundle(t, testFiles)
+
+	ix, err := NewIxTar(bundlePath, WithLowMemoryIndex(), WithValidate())
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	defer ix.Close()
+
+	if ix.Len() != len(testFiles) {
+		t.Errorf("Expected %d files, got %d", len(testFiles), ix.Len())
+	}
+	for name, content := range testFiles {
+		if got, err := ix.ExtractBytesOfFile(name); err != nil || string(got) != content {
+			t.Errorf("%s: got %q (%v)", name, got, err)
+		}
+	}
+	if got, err := ix.ExtractBytesOfFile("./dir//b.txt"); err != nil || string(got) != "bravo" {
+		t.Errorf("unclean path: got %q (%v)", got, err)
+	}
+	if _, err := ix.Stat("dir/sub"); !errors.Is(err, ErrNotRegularFile) {
+		t.Errorf("Expected ErrNotRegularFile for a directory, got %v", err)
+	}
+	if _, err := ix.Stat("missing.txt"); !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("Expected ErrFileNotFound, got %v", err)
+	}
+	if ix.index.Files != nil {
+		t.Error("Expected lookups to leave the index on disk")
+	}
+
+	// Going through every file parses the index
+	full, err := NewIxTar(bundlePath)
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	defer full.Close()
+	if got, want := ix.ListPaths(), full.ListPaths(); !reflect.DeepEqual(got, want) {
+		t.Errorf("ListPaths() = %v, want %v", got, want)
+	}
+}
+
+// flakyReaderAt fails reads while fail is set.
+type flakyReaderAt struct {
+	r    io.ReaderAt
+	fail bool
+}
+
+func (f *flakyReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if f.fail {
+		return 0, errors.New("flaky read")
+	}
+	return f.r.ReadAt(p, off)
+}
+
+func TestLowMemoryIndexLoadError(t *testing.T) {
+	bundlePath := createTestBundle(t, map[string]string{"a.txt": "alpha", "dir/b.txt": "bravo"})
+	f, err := os.Open(bundlePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &flakyReaderAt{r: f}
+	ix, err := NewIxTarAt(r, 0, info.Size(), WithLowMemoryIndex())
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+
+	// A failed load is reported, not taken for an empty bundle
+	r.fail = true
+	if err := ix.WalkFiles(func(FileStat, io.Reader) error { return nil }); err == nil {
+		t.Error("Expected WalkFiles to fail")
+	}
+	if err := ix.Validate(); err == nil {
+		t.Error("Expected Validate to fail")
+	}
+	if _, err := ix.ExtractNth(0); err == nil {
+		t.Error("Expected ExtractNth to fail")
+	}
+
+	r.fail = false
+	if got := ix.ListPaths(); !reflect.DeepEqual(got, []string{"a.txt", "dir/b.txt"}) {
+		t.Errorf("Expected the index to load once reads work again, got %v", got)
+	}
+}
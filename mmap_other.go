@@ -0,0 +1,16 @@
+//go:build !unix
+
+package ixtar
+
+import (
+	"errors"
+	"os"
+)
+
+func mmapFile(f *os.File) ([]byte, error) {
+	return nil, errors.New("mmap is not supported on this platform")
+}
+
+func munmapFile(mapping []byte) error {
+	return nil
+}
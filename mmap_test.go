@@ -0,0 +1,123 @@
+package ixtar
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestMmapExtract(t *testing.T) {
+	bundlePath := createTestBundle(t, map[string]string{
+		"a.txt":     "alpha",
+		"dir/b.txt": "bravo",
+	})
+
+	ix, err := NewIxTar(bundlePath, WithMmap())
+	if err != nil {
+		t.Fatalf("Failed to open bundle with mmap: %v", err)
+	}
+
+	data, err := ix.ExtractBytesOfFile("dir/b.txt")
+	if err != nil {
+		t.Fatalf("Failed to extract file: %v", err)
+	}
+	if string(data) != "bravo" {
+		t.Errorf("Expected %q, got %q", "bravo", string(data))
+	}
+
+	part, err := ix.ExtractRange("a.txt", 1, 3)
+	if err != nil {
+		t.Fatalf("Failed to extract range: %v", err)
+	}
+	if string(part) != "lph" {
+		t.Errorf("Expected %q, got %q", "lph", string(part))
+	}
+
+	if err := ix.Close(); err != nil {
+		t.Errorf("Failed to close bundle: %v", err)
+	}
+}
+
+func TestExtractRangeHugeLength(t *testing.T) {
+	bundlePath := createTestBundle(t, map[string]string{"a.txt": "alpha"})
+	for _, opts := range [][]OpenOption{nil, {WithMmap()}} {
+		ix, err := NewIxTar(bundlePath, opts...)
+		if err != nil {
+			t.Fatalf("Failed to open bundle: %v", err)
+		}
+		// offset+length would overflow, the range is still clipped
+		if got, err := ix.ExtractRange("a.txt", 1, math.MaxInt64); err != nil || string(got) != "lpha" {
+			t.Errorf("Expected %q, got %q (%v)", "lpha", got, err)
+		}
+		ix.Close()
+	}
+}
+
+func benchmarkExtract(b *testing.B, opts ...OpenOption) {
+	files := make(map[string]string)
+	for i := 0; i < 100; i++ {
+		files[fmt.Sprintf("file%d.txt", i)] = string(bytes.Repeat([]byte{'x'}, 4096))
+	}
+	bundlePath := createTestBundle(b, files)
+
+	ix, err := NewIxTar(bundlePath, opts...)
+	if err != nil {
+		b.Fatalf("Failed to open bundle: %v", err)
+	}
+	defer ix.Close()
+
+	names := make([]string, 100)
+	for i := range names {
+		names[i] = fmt.Sprintf("file%d.txt", i)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := ix.ExtractBytesOfFile(names[i%100]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkExtractReadAt(b *testing.B) { benchmarkExtract(b) }
+
+func BenchmarkExtractMmap(b *testing.B) { benchmarkExtract(b, WithMmap()) }
+
+func TestBytesAliasesMapping(t *testing.T) {
+	bundlePath := createTestBundle(t, map[string]string{"a.txt": "alpha"})
+
+	ix, err := NewIxTar(bundlePath, WithMmap())
+	if err != nil {
+		t.Fatalf("Failed to open bundle with mmap: %v", err)
+	}
+	defer ix.Close()
+
+	data, err := ix.Bytes("a.txt")
+	if err != nil {
+		t.Fatalf("Failed to get bytes: %v", err)
+	}
+	if string(data) != "alpha" {
+		t.Errorf("Expected %q, got %q", "alpha", string(data))
+	}
+
+	offset := ix.dataOffset + ix.index.Files[hashFilePath(md5Hasher{}, "a.txt")].Start
+	if &data[0] != &ix.mapping[offset] {
+		t.Error("Expected Bytes to alias the mapping")
+	}
+	if cap(data) != len(data) {
+		t.Error("Expected Bytes to return a capped slice")
+	}
+
+	plain, err := NewIxTar(bundlePath)
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	defer plain.Close()
+
+	data, err = plain.Bytes("a.txt")
+	if err != nil || string(data) != "alpha" {
+		t.Errorf("Unexpected bytes without mmap: %q, %v", data, err)
+	}
+}
@@ -0,0 +1,20 @@
+//go:build unix
+
+package ixtar
+
+import (
+	"os"
+	"syscall"
+)
+
+func mmapFile(f *os.File) ([]byte, error) {
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return syscall.Mmap(int(f.Fd()), 0, int(stat.Size()), syscall.PROT_READ, syscall.MAP_SHARED)
+}
+
+func munmapFile(mapping []byte) error {
+	return syscall.Munmap(mapping)
+}
@@ -0,0 +1,149 @@
+package ixtar
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrFileExists is returned when adding a path that is already in the bundle.
+var ErrFileExists = errors.New("file already exists")
+
+// AppendFile adds the regular file at sourcePath to a bundle under name and
+// returns the number of files in the bundle afterwards. The new file is
+// stored as is, with a checksum, after the data of the existing files, which
+// is copied unchanged; the bundle is rewritten next to itself and renamed
+// over the old one, so bundles opened before keep reading the old version.
+// It fails with ErrFileExists if name is already in the bundle. Bundles
+// with a custom Keyer, encrypted bundles and gzip-compressed bundles can't
+// be appended to; those with an encrypted index fail with ErrKeyRequired.
+func AppendFile(bundlePath, sourcePath, name string) (int, error) {
+	stat, err := os.Stat(bundlePath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to stat bundle file: %w", err)
+	}
+	ix, err := openForRewrite(bundlePath, "AppendFile")
+	if err != nil {
+		return 0, err
+	}
+	defer ix.Close()
+	if ix.tempPath != "" {
+		return 0, fmt.Errorf("can't append to a gzip-compressed bundle, decompress it first")
+	}
+	if ix.info.Keyer != "" {
+		return 0, fmt.Errorf("can't append to a bundle keyed by %q", ix.info.Keyer)
+	}
+	if ix.header.flags&flagEncrypted != 0 {
+		return 0, fmt.Errorf("can't append to an encrypted bundle")
+	}
+
+	storedPath := normalizePath(name)
+	if storedPath == "." || storedPath == ".." || strings.HasPrefix(storedPath, "../") || strings.HasPrefix(storedPath, "/") {
+		return 0, fmt.Errorf("invalid path in bundle: %s", name)
+	}
+	if err := checkStoredName(storedPath); err != nil {
+		return 0, err
+	}
+	hash := ix.key(storedPath)
+	if _, exists := ix.files()[hash]; exists {
+		return 0, fmt.Errorf("%w: %s", ErrFileExists, storedPath)
+	}
+	if ix.isDir(storedPath) {
+		return 0, fmt.Errorf("%w: %s is a directory of the bundle", ErrFileExists, storedPath)
+	}
+
+	source, err := os.Open(sourcePath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open %s: %w", sourcePath, err)
+	}
+	defer source.Close()
+	sourceInfo, err := source.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("failed to stat %s: %w", sourcePath, err)
+	}
+	if !sourceInfo.Mode().IsRegular() {
+		return 0, fmt.Errorf("%w: %s", ErrNotRegularFile, sourcePath)
+	}
+
+	// The index comes before the data, so the file is staged to learn its
+	// size and checksum, which also keeps a changing file consistent
+	staged, err := createTemp(filepath.Dir(bundlePath), "ixtar-data-*.tmp")
+	if err != nil {
+		return 0, fmt.Errorf("failed to create temp data file: %w", err)
+	}
+	defer os.Remove(staged.Name())
+	defer staged.Close()
+	checksum := crc32.NewIEEE()
+	size, err := io.CopyBuffer(io.MultiWriter(staged, checksum), source, make([]byte, defaultCopyBufferSize))
+	if err != nil {
+		return 0, fmt.Errorf("failed to read %s: %w", sourcePath, err)
+	}
+	if _, err := staged.Seek(0, io.SeekStart); err != nil {
+		return 0, fmt.Errorf("failed to seek data temp file: %w", err)
+	}
+
+	hashes := append(append([]string(nil), ix.entriesByOffset()...), hash)
+	files := make(map[string]FileIndex, len(hashes))
+	for h, fileIndex := range ix.files() {
+		files[h] = fileIndex
+	}
+	files[hash] = FileIndex{
+		Start: ix.dataSize,
+		Size:  size,
+		Path:  storedPath,
+		CRC32: formatCRC32(checksum.Sum32()),
+	}
+	data := io.MultiReader(io.NewSectionReader(ix.reader, ix.dataOffset, ix.dataSize), staged)
+	if err := ix.rewrite(bundlePath, stat.Mode().Perm(), hashes, files, data); err != nil {
+		return 0, err
+	}
+	return len(hashes), nil
+}
+
+// RemoveFile removes a file from a bundle and returns the number of files
+// left. Its data is dropped unless other files share it, and the remaining
+// data is packed like Compact does. Removing the last file leaves a valid
+// empty bundle. The bundle is replaced like with AppendFile. It fails with
+// ErrFileNotFound if filePath isn't in the bundle; bundles with a custom
+// Keyer and gzip-compressed bundles are not supported, and those with an
+// encrypted index fail with ErrKeyRequired.
+func RemoveFile(bundlePath, filePath string) (int, error) {
+	stat, err := os.Stat(bundlePath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to stat bundle file: %w", err)
+	}
+	ix, err := openForRewrite(bundlePath, "RemoveFile")
+	if err != nil {
+		return 0, err
+	}
+	defer ix.Close()
+	if ix.tempPath != "" {
+		return 0, fmt.Errorf("can't remove from a gzip-compressed bundle, decompress it first")
+	}
+	if ix.info.Keyer != "" {
+		return 0, fmt.Errorf("can't remove from a bundle keyed by %q", ix.info.Keyer)
+	}
+	if _, err := ix.lookup(filePath); err != nil {
+		return 0, err
+	}
+	removed := ix.key(filePath)
+
+	var hashes []string
+	for _, hash := range ix.entriesByOffset() {
+		if hash != removed {
+			hashes = append(hashes, hash)
+		}
+	}
+	files, data, _, err := ix.pack(hashes)
+	if err != nil {
+		return 0, err
+	}
+	if err := ix.rewrite(bundlePath, stat.Mode().Perm(), hashes, files, data); err != nil {
+		return 0, err
+	}
+	return len(hashes), nil
+}
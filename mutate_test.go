@@ -0,0 +1,117 @@
+package ixtar
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAppendFile(t *testing.T) {
+	srcDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("alpha"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(srcDir, "dir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(srcDir, "dir", "b.txt"), []byte("bravo"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	bundlePath := filepath.Join(t.TempDir(), "bundle.ixtar")
+	if _, err := CreateBundleWithOptions(srcDir, bundlePath, CreateOptions{Trailer: true}); err != nil {
+		t.Fatalf("Failed to create bundle: %v", err)
+	}
+	newFile := filepath.Join(t.TempDir(), "new.txt")
+	if err := os.WriteFile(newFile, []byte("charlie"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	count, err := AppendFile(bundlePath, newFile, "./docs//c.txt")
+	if err != nil {
+		t.Fatalf("AppendFile failed: %v", err)
+	}
+	if count != 3 {
+		t.Errorf("Expected 3 files, got %d", count)
+	}
+
+	ix, err := NewIxTar(bundlePath, WithVerifyOnRead())
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	defer ix.Close()
+	for name, content := range map[string]string{"a.txt": "alpha", "dir/b.txt": "bravo", "docs/c.txt": "charlie"} {
+		if got, err := ix.ExtractBytesOfFile(name); err != nil || string(got) != content {
+			t.Errorf("%s: got %q (%v)", name, got, err)
+		}
+	}
+	if err := ix.Validate(); err != nil {
+		t.Errorf("Validate failed: %v", err)
+	}
+	if layout := ix.Layout(); layout.TrailerSize == 0 {
+		t.Error("Expected the trailer to be kept")
+	}
+
+	for _, name := range []string{"a.txt", "docs/c.txt", "dir"} {
+		if _, err := AppendFile(bundlePath, newFile, name); !errors.Is(err, ErrFileExists) {
+			t.Errorf("%s: expected ErrFileExists, got %v", name, err)
+		}
+	}
+	for _, name := range []string{"", "../escape.txt", "/abs.txt"} {
+		if _, err := AppendFile(bundlePath, newFile, name); err == nil {
+			t.Errorf("%q: expected an invalid path error", name)
+		}
+	}
+	if _, err := AppendFile(bundlePath, srcDir, "srcdir"); !errors.Is(err, ErrNotRegularFile) {
+		t.Errorf("Expected ErrNotRegularFile for a directory, got %v", err)
+	}
+}
+
+func TestRemoveFile(t *testing.T) {
+	bundlePath := writeRawBundle(t, indexCSV(t, map[string]FileIndex{
+		"a.txt":    {Start: 0, Size: 5},
+		"copy.txt": {Start: 0, Size: 5},
+		"b.txt":    {Start: 5, Size: 5},
+	}), "alphabravo")
+
+	count, err := RemoveFile(bundlePath, "a.txt")
+	if err != nil {
+		t.Fatalf("RemoveFile failed: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("Expected 2 files left, got %d", count)
+	}
+	if _, err := RemoveFile(bundlePath, "a.txt"); !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("Expected ErrFileNotFound, got %v", err)
+	}
+
+	// copy.txt still holds the shared data, b.txt is packed after it
+	if _, err := RemoveFile(bundlePath, "copy.txt"); err != nil {
+		t.Fatalf("RemoveFile failed: %v", err)
+	}
+	ix, err := NewIxTar(bundlePath)
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	if got, err := ix.ExtractBytesOfFile("b.txt"); err != nil || string(got) != "bravo" {
+		t.Errorf("b.txt: got %q (%v)", got, err)
+	}
+	if size := ix.Layout().DataSize; size != 5 {
+		t.Errorf("Expected 5 bytes of data left, got %d", size)
+	}
+	ix.Close()
+
+	// The last file leaves an empty bundle that still opens
+	count, err = RemoveFile(bundlePath, "b.txt")
+	if err != nil || count != 0 {
+		t.Fatalf("RemoveFile of the last file: %d (%v)", count, err)
+	}
+	ix, err = NewIxTar(bundlePath)
+	if err != nil {
+		t.Fatalf("Failed to open empty bundle: %v", err)
+	}
+	defer ix.Close()
+	if ix.Len() != 0 {
+		t.Errorf("Expected an empty bundle, got %d files", ix.Len())
+	}
+}
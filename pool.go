@@ -0,0 +1,82 @@
+package ixtar
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// readerPool hands out independent file handles so concurrent extractions
+// never share read state. At most cap(slots) handles are in use at once.
+type readerPool struct {
+	path  string
+	slots chan struct{}
+	idle  chan *os.File
+
+	mu     sync.Mutex
+	all    []*os.File
+	closed bool
+}
+
+func newReaderPool(path string, size int) *readerPool {
+	return &readerPool{
+		path:  path,
+		slots: make(chan struct{}, size),
+		idle:  make(chan *os.File, size),
+	}
+}
+
+// get returns an idle handle or opens a new one, blocking while all handles
+// are in use.
+func (p *readerPool) get() (*os.File, error) {
+	p.slots <- struct{}{}
+
+	select {
+	case f := <-p.idle:
+		return f, nil
+	default:
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		<-p.slots
+		return nil, errors.New("bundle is closed")
+	}
+	f, err := os.Open(p.path)
+	if err != nil {
+		<-p.slots
+		return nil, fmt.Errorf("failed to open pooled reader: %w", err)
+	}
+	p.all = append(p.all, f)
+	return f, nil
+}
+
+func (p *readerPool) put(f *os.File) {
+	p.idle <- f
+	<-p.slots
+}
+
+func (p *readerPool) readAt(b []byte, off int64) (int, error) {
+	f, err := p.get()
+	if err != nil {
+		return 0, err
+	}
+	defer p.put(f)
+	return f.ReadAt(b, off)
+}
+
+// close closes every handle the pool ever opened.
+func (p *readerPool) close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+
+	var errs []error
+	for _, f := range p.all {
+		errs = append(errs, f.Close())
+	}
+	p.all = nil
+	return errors.Join(errs...)
+}
@@ -0,0 +1,57 @@
+package ixtar
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestReaderPoolConcurrentExtract(t *testing.T) {
+	testFiles := make(map[string]string)
+	for i := 0; i < 50; i++ {
+		testFiles[fmt.Sprintf("file%d.txt", i)] = fmt.Sprintf("content of file %d", i)
+	}
+	bundlePath := createTestBundle(t, testFiles)
+
+	ix, err := NewIxTar(bundlePath, WithReaderPool(3))
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, len(testFiles))
+	for path, expected := range testFiles {
+		wg.Add(1)
+		go func(path, expected string) {
+			defer wg.Done()
+			data, err := ix.ExtractBytesOfFile(path)
+			if err != nil {
+				errs <- err
+				return
+			}
+			if string(data) != expected {
+				errs <- fmt.Errorf("content mismatch for %s: %q", path, data)
+			}
+		}(path, expected)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	if opened := len(ix.pool.all); opened > 3 {
+		t.Errorf("Expected at most 3 pooled handles, got %d", opened)
+	}
+
+	if err := ix.Close(); err != nil {
+		t.Errorf("Failed to close bundle: %v", err)
+	}
+}
+
+func TestReaderPoolInvalidSize(t *testing.T) {
+	bundlePath := createTestBundle(t, map[string]string{"a.txt": "a"})
+	if _, err := NewIxTar(bundlePath, WithReaderPool(-1)); err == nil {
+		t.Error("Expected error for negative pool size")
+	}
+}
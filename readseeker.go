@@ -0,0 +1,50 @@
+package ixtar
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// seekReaderAt implements io.ReaderAt on top of an io.ReadSeeker. The seek
+// position is shared, so reads are serialized.
+type seekReaderAt struct {
+	mu sync.Mutex
+	rs io.ReadSeeker
+}
+
+func (s *seekReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.rs.Seek(off, io.SeekStart); err != nil {
+		return 0, err
+	}
+	n, err := io.ReadFull(s.rs, p)
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// NewIxTarFromReadSeeker opens a bundle from a source that can seek but not
+// read at an offset, such as some decompressors. Every read seeks the shared
+// position, so concurrent reads are serialized and slower than with NewIxTar.
+// WithMmap and WithReaderPool are not supported. Close does not close rs.
+func NewIxTarFromReadSeeker(rs io.ReadSeeker, opts ...OpenOption) (*IxTar, error) {
+	cfg, err := newOpenConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.mmap || cfg.poolSize > 0 {
+		return nil, fmt.Errorf("mmap and reader pool need a bundle file")
+	}
+
+	size, err := rs.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to determine bundle size: %w", err)
+	}
+
+	return openReaderAt(&seekReaderAt{rs: rs}, size, cfg)
+}
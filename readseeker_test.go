@@ -0,0 +1,56 @@
+package ixtar
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"testing"
+)
+
+// seekOnly hides ReadAt so only Read and Seek are available.
+type seekOnly struct {
+	rs io.ReadSeeker
+}
+
+func (s seekOnly) Read(p []byte) (int, error)                { return s.rs.Read(p) }
+func (s seekOnly) Seek(off int64, whence int) (int64, error) { return s.rs.Seek(off, whence) }
+
+func TestNewIxTarFromReadSeeker(t *testing.T) {
+	testFiles := make(map[string]string)
+	for i := 0; i < 20; i++ {
+		testFiles[fmt.Sprintf("file%d.txt", i)] = fmt.Sprintf("content of file %d", i)
+	}
+	data, err := os.ReadFile(createTestBundle(t, testFiles))
+	if err != nil {
+		t.Fatalf("Failed to read bundle: %v", err)
+	}
+
+	ix, err := NewIxTarFromReadSeeker(seekOnly{bytes.NewReader(data)}, WithVerifyOnRead())
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	defer ix.Close()
+
+	var wg sync.WaitGroup
+	for path, content := range testFiles {
+		wg.Add(1)
+		go func(path, content string) {
+			defer wg.Done()
+			got, err := ix.ExtractBytesOfFile(path)
+			if err != nil || string(got) != content {
+				t.Errorf("%s: expected %q, got %q (%v)", path, content, got, err)
+			}
+		}(path, content)
+	}
+	wg.Wait()
+
+	if err := ix.VerifyAll(); err != nil {
+		t.Errorf("VerifyAll failed: %v", err)
+	}
+
+	if _, err := NewIxTarFromReadSeeker(seekOnly{bytes.NewReader(data)}, WithMmap()); err == nil {
+		t.Error("Expected error for WithMmap")
+	}
+}
@@ -0,0 +1,161 @@
+package ixtar
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// CompressionMode selects how Recompress stores file data.
+type CompressionMode int
+
+const (
+	// CompressionNone stores every file as is.
+	CompressionNone CompressionMode = iota
+	// CompressionDeflate stores files DEFLATE compressed, like a
+	// CreateOptions.Compress that returns true for every file. Empty and
+	// sparse files are stored as is.
+	CompressionDeflate
+)
+
+// RecompressResult reports what Recompress changed.
+type RecompressResult struct {
+	Files       int   // Number of files whose stored bytes were re-encoded
+	OldDataSize int64 // Size of the data region of the source bundle
+	NewDataSize int64 // Size of the data region of the new bundle
+}
+
+// Recompress writes the bundle at src to dst with every file stored as mode
+// says, without going back to the source tree. Paths, keys, metadata and the
+// bundle flags are kept; checksums are computed for the new stored bytes
+// after the old ones are checked. Files sharing data keep sharing it and
+// unreferenced data is dropped. dst may be src, which is then replaced. A
+// gzip-compressed source gives an uncompressed bundle. Encrypted files are
+// copied as they are, but bundles with an encrypted index are refused with
+// ErrKeyRequired.
+func Recompress(src, dst string, mode CompressionMode) (*RecompressResult, error) {
+	if mode != CompressionNone && mode != CompressionDeflate {
+		return nil, fmt.Errorf("invalid compression mode: %d", mode)
+	}
+	stat, err := os.Stat(src)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat bundle file: %w", err)
+	}
+	ix, err := openForRewrite(src, "Recompress")
+	if err != nil {
+		return nil, err
+	}
+	defer ix.Close()
+
+	dataFile, err := createTemp(filepath.Dir(dst), "ixtar-data-*.tmp")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp data file: %w", err)
+	}
+	defer os.Remove(dataFile.Name())
+	defer dataFile.Close()
+	staging := bufio.NewWriterSize(dataFile, dataBufferSize)
+
+	// Entries sharing a region of the old data share its new encoding
+	type region struct{ start, size int64 }
+	moved := make(map[region]FileIndex)
+
+	result := &RecompressResult{OldDataSize: ix.dataSize}
+	var comp compressor
+	buf := make([]byte, defaultCopyBufferSize)
+	hashes := ix.entriesByOffset()
+	files := make(map[string]FileIndex, len(hashes))
+	for _, hash := range hashes {
+		fileIndex := ix.files()[hash]
+		old := region{fileIndex.Start, fileIndex.storedSize()}
+		if done, ok := moved[old]; ok {
+			fileIndex.Start, fileIndex.CRC32 = done.Start, done.CRC32
+			fileIndex.Compression, fileIndex.CompressedSize = done.Compression, done.CompressedSize
+			files[hash] = fileIndex
+			continue
+		}
+		if old.start+old.size > ix.dataSize {
+			return nil, fmt.Errorf("%s: data extends past the end of the bundle, repair it first", entryName(hash, fileIndex))
+		}
+
+		// Encrypted files are compressed before they are encrypted, so
+		// they are kept as they are
+		decompress := fileIndex.compressed() && !fileIndex.encrypted() && mode == CompressionNone
+		compress := !fileIndex.compressed() && !fileIndex.encrypted() && mode == CompressionDeflate && fileIndex.Sparse == nil && fileIndex.Size > 0
+
+		// The old stored bytes are checksummed on the way through
+		oldSum, newSum := crc32.NewIEEE(), crc32.NewIEEE()
+		stored := io.TeeReader(io.NewSectionReader(ix.reader, ix.dataOffset+old.start, old.size), oldSum)
+		w := io.MultiWriter(staging, newSum)
+		var n int64
+		switch {
+		case decompress:
+			n, err = io.CopyBuffer(w, inflate(stored, fileIndex), buf)
+			if err == nil {
+				// The inflater may stop short of the end of the region
+				_, err = io.Copy(io.Discard, stored)
+			}
+		case compress:
+			_, n, err = comp.copyCompressed(w, stored, fileIndex.Size, buf)
+		default:
+			n, err = io.CopyBuffer(w, stored, buf)
+		}
+		if err == nil && fileIndex.CRC32 != "" {
+			err = compareCRC32(fileIndex, oldSum.Sum32())
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to recompress %s: %w", entryName(hash, fileIndex), err)
+		}
+
+		fileIndex.Start = result.NewDataSize
+		fileIndex.CRC32 = formatCRC32(newSum.Sum32())
+		switch {
+		case decompress:
+			fileIndex.Compression, fileIndex.CompressedSize = "", 0
+			result.Files++
+		case compress:
+			fileIndex.Compression, fileIndex.CompressedSize = compressionDeflate, n
+			result.Files++
+		}
+		result.NewDataSize += n
+		moved[old] = fileIndex
+		files[hash] = fileIndex
+	}
+	if err := staging.Flush(); err != nil {
+		return nil, fmt.Errorf("failed to write data: %w", err)
+	}
+
+	var newCSV bytes.Buffer
+	csvWriter := csv.NewWriter(&newCSV)
+	for _, hash := range hashes {
+		if err := writeCSVRecord(csvWriter, hash, files[hash]); err != nil {
+			return nil, err
+		}
+	}
+	csvWriter.Flush()
+	if err := csvWriter.Error(); err != nil {
+		return nil, fmt.Errorf("failed to flush CSV writer: %w", err)
+	}
+
+	infoData := make([]byte, ix.header.infoSize)
+	if _, err := ix.reader.ReadAt(infoData, headerSize+ix.csvSize); err != nil {
+		return nil, fmt.Errorf("failed to read bundle info: %w", err)
+	}
+
+	if _, err := dataFile.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to seek data temp file: %w", err)
+	}
+	header := ix.header
+	header.csvSize = int64(newCSV.Len())
+	err = replaceBundle(dst, stat.Mode().Perm(), func(w io.Writer) error {
+		return writeBundle(w, header, bytes.NewReader(newCSV.Bytes()), infoData, dataFile)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
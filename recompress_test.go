@@ -0,0 +1,110 @@
+package ixtar
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecompress(t *testing.T) {
+	testFiles := map[string]string{
+		"a.txt":     strings.Repeat("compressible text ", 1000),
+		"b.txt":     "short",
+		"empty.txt": "",
+	}
+	bundlePath := createTestBundle(t, testFiles)
+	dir := t.TempDir()
+
+	check := func(path, wantCompression string) int64 {
+		t.Helper()
+		ix, err := NewIxTar(path, WithVerifyOnRead())
+		if err != nil {
+			t.Fatalf("Failed to open bundle: %v", err)
+		}
+		defer ix.Close()
+		for name, content := range testFiles {
+			if got, err := ix.ExtractBytesOfFile(name); err != nil || string(got) != content {
+				t.Errorf("%s: got %d bytes (%v)", name, len(got), err)
+			}
+			want := wantCompression
+			if content == "" {
+				want = ""
+			}
+			if stat, err := ix.Stat(name); err != nil || stat.Compression != want {
+				t.Errorf("%s: expected compression %q, got %q (%v)", name, want, stat.Compression, err)
+			}
+		}
+		if err := ix.VerifyAll(); err != nil {
+			t.Errorf("VerifyAll failed: %v", err)
+		}
+		return ix.Layout().DataSize
+	}
+	original := check(bundlePath, "")
+
+	compressedPath := filepath.Join(dir, "compressed.ixtar")
+	result, err := Recompress(bundlePath, compressedPath, CompressionDeflate)
+	if err != nil {
+		t.Fatalf("Recompress failed: %v", err)
+	}
+	if result.Files != 2 || result.OldDataSize != original || result.NewDataSize >= original {
+		t.Errorf("Expected 2 files compressed below %d bytes, got %+v", original, result)
+	}
+	if size := check(compressedPath, compressionDeflate); size != result.NewDataSize {
+		t.Errorf("Expected %d bytes of data, got %d", result.NewDataSize, size)
+	}
+
+	// Back to stored as is, in place
+	result, err = Recompress(compressedPath, compressedPath, CompressionNone)
+	if err != nil {
+		t.Fatalf("Recompress failed: %v", err)
+	}
+	if result.Files != 2 || result.NewDataSize != original {
+		t.Errorf("Expected 2 files decompressed to %d bytes, got %+v", original, result)
+	}
+	check(compressedPath, "")
+}
+
+func TestRecompressSharedData(t *testing.T) {
+	data := strings.Repeat("a", 100)
+	bundlePath := writeRawBundle(t, indexCSV(t, map[string]FileIndex{
+		"a.txt":    {Start: 0, Size: 100},
+		"copy.txt": {Start: 0, Size: 100},
+	}), data)
+
+	dst := filepath.Join(t.TempDir(), "shared.ixtar")
+	result, err := Recompress(bundlePath, dst, CompressionDeflate)
+	if err != nil {
+		t.Fatalf("Recompress failed: %v", err)
+	}
+	ix, err := NewIxTar(dst)
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	defer ix.Close()
+	a, _ := ix.Stat("a.txt")
+	b, _ := ix.Stat("copy.txt")
+	if a.Offset != b.Offset || result.Files != 1 {
+		t.Errorf("Expected the copy to keep sharing data, got %+v and %+v (%+v)", a, b, result)
+	}
+	for _, name := range []string{"a.txt", "copy.txt"} {
+		if got, err := ix.ExtractBytesOfFile(name); err != nil || string(got) != data {
+			t.Errorf("%s: got %q (%v)", name, got, err)
+		}
+	}
+}
+
+func TestRecompressChecksumMismatch(t *testing.T) {
+	bundlePath := writeRawBundle(t, indexCSV(t, map[string]FileIndex{
+		"a.txt": {Start: 0, Size: 5, CRC32: "00000000"},
+	}), "hello")
+
+	dst := filepath.Join(t.TempDir(), "bad.ixtar")
+	if _, err := Recompress(bundlePath, dst, CompressionDeflate); !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("Expected a checksum mismatch, got %v", err)
+	}
+	if _, err := os.Stat(dst); !os.IsNotExist(err) {
+		t.Errorf("Expected no bundle to be written, got %v", err)
+	}
+}
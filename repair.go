@@ -0,0 +1,173 @@
+package ixtar
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// RepairReport describes what Repair did to a bundle.
+type RepairReport struct {
+	Kept      int      // Index entries whose data is complete
+	Dropped   []string // Paths (or hashes) of entries past the end of the data, sorted
+	Rewritten bool     // Whether the bundle file was replaced
+}
+
+// RepairOptions controls RepairWithOptions.
+type RepairOptions struct {
+	// Logger receives every dropped entry at Warn and the outcome at Info.
+	// Nil logs nothing.
+	Logger *slog.Logger
+}
+
+// Repair salvages a bundle whose data region was cut short, e.g. by an
+// interrupted download. Index entries whose data extends past the end of the
+// file are dropped and the bundle is rewritten with a consistent header and
+// index covering the remaining files; a trailer index is rebuilt. A bundle
+// whose header, index or info block is incomplete can't be repaired, and
+// gzip-compressed bundles must be decompressed first. The bundle is left
+// untouched when nothing is missing.
+func Repair(bundlePath string) (*RepairReport, error) {
+	return RepairWithOptions(bundlePath, RepairOptions{})
+}
+
+// RepairWithOptions is Repair with options.
+func RepairWithOptions(bundlePath string, opts RepairOptions) (*RepairReport, error) {
+	logger := orDiscard(opts.Logger)
+	file, err := os.Open(bundlePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bundle file: %w", err)
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat bundle file: %w", err)
+	}
+	size := stat.Size()
+
+	header, err := readHeader(file)
+	if err != nil {
+		return nil, err
+	}
+	if err := header.checkSize(size); err != nil {
+		return nil, fmt.Errorf("index is incomplete, can't repair: %w", err)
+	}
+
+	csvData := make([]byte, header.csvSize)
+	if _, err := io.ReadFull(file, csvData); err != nil {
+		return nil, fmt.Errorf("failed to read CSV data: %w", err)
+	}
+	infoData := make([]byte, header.infoSize)
+	if _, err := io.ReadFull(file, infoData); err != nil {
+		return nil, fmt.Errorf("failed to read bundle info: %w", err)
+	}
+	if err := header.checkIndexCRC(csvData, infoData); err != nil {
+		return nil, err
+	}
+	if header.flags&flagEncryptedIndex != 0 {
+		return nil, fmt.Errorf("can't repair a bundle with an encrypted index")
+	}
+	index, err := parseCSVIndex(csvData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CSV index: %w", err)
+	}
+
+	dataOffset := headerSize + header.csvSize + int64(header.infoSize)
+	dataSize := size - dataOffset
+	trailerLost := false
+	if header.flags&flagTrailer != 0 {
+		// A cut-off bundle has lost its trailer along with the end of the data
+		trailerSize, err := readTrailerFooter(file, size, header)
+		if err == nil && trailerSize <= dataSize {
+			dataSize -= trailerSize
+		} else {
+			trailerLost = true
+		}
+	}
+
+	report := &RepairReport{}
+	kept := make([]string, 0, len(index.Files))
+	dataEnd := int64(0)
+	for hash, fileIndex := range index.Files {
+		end := fileIndex.Start + fileIndex.storedSize()
+		if fileIndex.Start < 0 || fileIndex.Size < 0 || end > dataSize {
+			report.Dropped = append(report.Dropped, entryName(hash, fileIndex))
+			continue
+		}
+		kept = append(kept, hash)
+		dataEnd = max(dataEnd, end)
+	}
+	sort.Strings(report.Dropped)
+	report.Kept = len(kept)
+	for _, name := range report.Dropped {
+		logger.Warn("dropped entry past the end of the data", "path", name)
+	}
+	if len(report.Dropped) == 0 && !trailerLost {
+		logger.Info("nothing to repair", "files", report.Kept)
+		return report, nil
+	}
+
+	sort.Slice(kept, func(i, j int) bool {
+		a, b := index.Files[kept[i]], index.Files[kept[j]]
+		if a.Start != b.Start {
+			return a.Start < b.Start
+		}
+		return kept[i] < kept[j]
+	})
+	var newCSV bytes.Buffer
+	csvWriter := csv.NewWriter(&newCSV)
+	for _, hash := range kept {
+		if err := writeCSVRecord(csvWriter, hash, index.Files[hash]); err != nil {
+			return nil, err
+		}
+	}
+	csvWriter.Flush()
+	if err := csvWriter.Error(); err != nil {
+		return nil, fmt.Errorf("failed to flush CSV writer: %w", err)
+	}
+
+	header.csvSize = int64(newCSV.Len())
+	data := io.NewSectionReader(file, dataOffset, dataEnd)
+	err = replaceBundle(bundlePath, stat.Mode().Perm(), func(w io.Writer) error {
+		return writeBundle(w, header, bytes.NewReader(newCSV.Bytes()), infoData, data)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	report.Rewritten = true
+	logger.Info("repaired bundle", "kept", report.Kept, "dropped", len(report.Dropped))
+	return report, nil
+}
+
+// replaceBundle replaces the bundle at bundlePath with what write writes,
+// giving it the permissions perm. The new bundle is written next to the old
+// one and renamed over it, so a failed write leaves the original in place.
+func replaceBundle(bundlePath string, perm os.FileMode, write func(w io.Writer) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(bundlePath), ".ixtar-rewrite-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if err := write(tmp); err != nil {
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		return fmt.Errorf("failed to set bundle permissions: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write bundle: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), bundlePath); err != nil {
+		return fmt.Errorf("failed to replace bundle: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package ixtar
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRepair(t *testing.T) {
+	for _, trailer := range []bool{false, true} {
+		t.Run(fmt.Sprintf("trailer=%v", trailer), func(t *testing.T) {
+			sourceDir := t.TempDir()
+			for _, name := range []string{"a.txt", "b.txt", "c.txt", "d.txt", "e.txt"} {
+				if err := os.WriteFile(filepath.Join(sourceDir, name), []byte(strings.Repeat(name[:1], 100)), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			bundlePath := filepath.Join(t.TempDir(), "cut.ixtar")
+			if _, err := CreateBundleWithOptions(sourceDir, bundlePath, CreateOptions{Trailer: trailer}); err != nil {
+				t.Fatalf("Failed to create bundle: %v", err)
+			}
+
+			ix, err := NewIxTar(bundlePath)
+			if err != nil {
+				t.Fatalf("Failed to open bundle: %v", err)
+			}
+			dataOffset := ix.Layout().DataOffset
+			ix.Close()
+
+			// Cut the data off in the middle of c.txt
+			if err := os.Truncate(bundlePath, dataOffset+250); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := NewIxTar(bundlePath); err == nil && trailer {
+				t.Error("Expected the cut-off trailer bundle to fail to open")
+			}
+
+			report, err := Repair(bundlePath)
+			if err != nil {
+				t.Fatalf("Repair failed: %v", err)
+			}
+			if want := []string{"c.txt", "d.txt", "e.txt"}; !reflect.DeepEqual(report.Dropped, want) || report.Kept != 2 || !report.Rewritten {
+				t.Errorf("Unexpected report: %+v", report)
+			}
+
+			ix, err = NewIxTar(bundlePath)
+			if err != nil {
+				t.Fatalf("Failed to open repaired bundle: %v", err)
+			}
+			defer ix.Close()
+			if got := ix.ListPaths(); !reflect.DeepEqual(got, []string{"a.txt", "b.txt"}) {
+				t.Errorf("Expected a.txt and b.txt, got %v", got)
+			}
+			if err := ix.VerifyAll(); err != nil {
+				t.Errorf("VerifyAll failed: %v", err)
+			}
+			if layout := ix.Layout(); layout.DataSize != 200 || (layout.TrailerSize > 0) != trailer {
+				t.Errorf("Unexpected layout after repair: %+v", layout)
+			}
+
+			report, err = Repair(bundlePath)
+			if err != nil || report.Rewritten || len(report.Dropped) != 0 {
+				t.Errorf("Expected nothing to repair, got %+v (%v)", report, err)
+			}
+		})
+	}
+}
+
+func TestRepairTruncatedIndex(t *testing.T) {
+	bundlePath := createTestBundle(t, map[string]string{"a.txt": "hello"})
+	if err := os.Truncate(bundlePath, headerSize+5); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Repair(bundlePath); err == nil {
+		t.Error("Expected error repairing a bundle with a truncated index")
+	}
+}
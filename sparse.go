@@ -0,0 +1,135 @@
+package ixtar
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// SparseSegment is a region of a sparse file that holds data. Everything
+// outside the segments of a file reads as zeros.
+type SparseSegment struct {
+	Offset int64 `json:"offset"` // Offset within the logical file
+	Length int64 `json:"length"` // Number of data bytes stored
+}
+
+// storedSize returns the number of bytes the entry occupies in the data
+// region. For sparse, compressed and encrypted files this differs from the
+// logical Size.
+func (fi FileIndex) storedSize() int64 {
+	stored := fi.Size
+	if fi.compressed() {
+		stored = fi.CompressedSize
+	} else if fi.Sparse != nil {
+		stored = 0
+		for _, seg := range fi.Sparse {
+			stored += seg.Length
+		}
+	}
+	if fi.encrypted() {
+		stored += int64(fi.NonceSize) + gcmTagSize
+	}
+	return stored
+}
+
+// formatSparse encodes segments as "offset:length" pairs separated by ";".
+func formatSparse(segs []SparseSegment) string {
+	parts := make([]string, len(segs))
+	for i, seg := range segs {
+		parts[i] = strconv.FormatInt(seg.Offset, 10) + ":" + strconv.FormatInt(seg.Length, 10)
+	}
+	return strings.Join(parts, ";")
+}
+
+func parseSparse(value string, size int64) ([]SparseSegment, error) {
+	segs := []SparseSegment{}
+	if value == "" {
+		return segs, nil
+	}
+
+	end := int64(0)
+	for _, part := range strings.Split(value, ";") {
+		offStr, lenStr, ok := strings.Cut(part, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid sparse segment %q", part)
+		}
+		off, err := strconv.ParseInt(offStr, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid sparse offset: %w", err)
+		}
+		length, err := strconv.ParseInt(lenStr, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid sparse length: %w", err)
+		}
+		if off < end || length < 0 || length > size-off {
+			return nil, fmt.Errorf("sparse segment %q out of range", part)
+		}
+		end = off + length
+		segs = append(segs, SparseSegment{Offset: off, Length: length})
+	}
+	return segs, nil
+}
+
+// copySparseData copies only the data segments of f into w.
+func copySparseData(w io.Writer, f *os.File, segs []SparseSegment, buf []byte) (int64, error) {
+	var written int64
+	for _, seg := range segs {
+		n, err := io.CopyBuffer(w, io.NewSectionReader(f, seg.Offset, seg.Length), buf)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		if n != seg.Length {
+			return written, fmt.Errorf("short read in sparse segment at %d", seg.Offset)
+		}
+	}
+	return written, nil
+}
+
+// expandSparse places the stored segment data at their logical offsets in
+// a zero-filled buffer of the file's full size.
+func expandSparse(stored []byte, fileIndex FileIndex) []byte {
+	data := make([]byte, fileIndex.Size)
+	pos := int64(0)
+	for _, seg := range fileIndex.Sparse {
+		copy(data[seg.Offset:seg.Offset+seg.Length], stored[pos:pos+seg.Length])
+		pos += seg.Length
+	}
+	return data
+}
+
+// allZero reports whether the length bytes of r at off are all zeros, such
+// as a hole of a sparse file. A range past the end of r isn't.
+func allZero(r io.ReaderAt, off, length int64, buf []byte) (bool, error) {
+	sr := io.NewSectionReader(r, off, length)
+	var read int64
+	for {
+		n, err := io.ReadFull(sr, buf)
+		read += int64(n)
+		for _, b := range buf[:n] {
+			if b != 0 {
+				return false, nil
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return read == length, nil
+		}
+		if err != nil {
+			return false, err
+		}
+	}
+}
+
+// writeSparseFile writes only the data segments of the logical content to
+// f and truncates it to the logical size so the filesystem can keep the
+// holes.
+func writeSparseFile(f *os.File, data []byte, segs []SparseSegment, size int64) error {
+	for _, seg := range segs {
+		if _, err := f.WriteAt(data[seg.Offset:seg.Offset+seg.Length], seg.Offset); err != nil {
+			return err
+		}
+	}
+	return f.Truncate(size)
+}
@@ -0,0 +1,57 @@
+//go:build linux
+
+package ixtar
+
+import (
+	"errors"
+	"io"
+	"os"
+	"syscall"
+)
+
+const (
+	seekData = 3 // SEEK_DATA
+	seekHole = 4 // SEEK_HOLE
+)
+
+// dataSegments returns the data segments of f using SEEK_DATA/SEEK_HOLE. It
+// returns nil when the file has no holes or the filesystem doesn't report
+// them, in which case the file is stored densely.
+func dataSegments(f *os.File, size int64) ([]SparseSegment, error) {
+	segs := []SparseSegment{}
+	pos := int64(0)
+	for pos < size {
+		data, err := f.Seek(pos, seekData)
+		if errors.Is(err, syscall.ENXIO) {
+			break
+		}
+		if errors.Is(err, syscall.EINVAL) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		hole, err := f.Seek(data, seekHole)
+		if err != nil {
+			return nil, err
+		}
+		if hole > size {
+			hole = size
+		}
+		segs = append(segs, SparseSegment{Offset: data, Length: hole - data})
+		pos = hole
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	var stored int64
+	for _, seg := range segs {
+		stored += seg.Length
+	}
+	if stored == size {
+		return nil, nil
+	}
+	return segs, nil
+}
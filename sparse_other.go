@@ -0,0 +1,10 @@
+//go:build !linux
+
+package ixtar
+
+import "os"
+
+// dataSegments is not supported on this platform; files are stored densely.
+func dataSegments(f *os.File, size int64) ([]SparseSegment, error) {
+	return nil, nil
+}
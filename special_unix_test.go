@@ -0,0 +1,104 @@
+//go:build unix
+
+package ixtar
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestSpecialFilePolicy(t *testing.T) {
+	srcDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(srcDir, "regular.txt"), []byte("data"), 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	if err := syscall.Mkfifo(filepath.Join(srcDir, "pipe"), 0644); err != nil {
+		t.Skipf("FIFOs not supported: %v", err)
+	}
+	if err := os.Symlink("regular.txt", filepath.Join(srcDir, "link")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+	if err := os.Mkdir(filepath.Join(srcDir, "empty"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	bundlePath := filepath.Join(t.TempDir(), "special.ixtar")
+
+	result, err := CreateBundleWithOptions(srcDir, bundlePath, CreateOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create bundle: %v", err)
+	}
+	if result.Files != 1 || result.SkippedSpecial != 1 || result.SkippedSymlinks != 1 || result.Directories != 1 {
+		t.Errorf("Unexpected create result: %+v", result)
+	}
+
+	// The bundle records what it left out
+	ix, err := NewIxTar(bundlePath)
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	stats := ix.Stats()
+	ix.Close()
+	if stats.RegularFiles != 1 || stats.Directories != 1 || stats.Symlinks != 1 || stats.Other != 1 {
+		t.Errorf("Unexpected entry counts: %+v", stats)
+	}
+
+	if _, err := CreateBundleWithOptions(srcDir, bundlePath, CreateOptions{SpecialFiles: ErrorOnSpecial}); err == nil {
+		t.Error("Expected error for FIFO with ErrorOnSpecial")
+	}
+}
+
+func TestContinueOnError(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root can read files regardless of permissions")
+	}
+
+	srcDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(srcDir, "ok.txt"), []byte("readable"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(srcDir, "secret.txt"), []byte("hidden"), 0000); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	lockedDir := filepath.Join(srcDir, "locked")
+	if err := os.Mkdir(lockedDir, 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(lockedDir, "inner.txt"), []byte("inner"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if err := os.Chmod(lockedDir, 0000); err != nil {
+		t.Fatalf("Failed to lock directory: %v", err)
+	}
+	t.Cleanup(func() { os.Chmod(lockedDir, 0755) })
+	bundlePath := filepath.Join(t.TempDir(), "partial.ixtar")
+
+	if _, err := CreateBundleWithOptions(srcDir, bundlePath, CreateOptions{}); err == nil {
+		t.Fatal("Expected strict creation to fail on unreadable entries")
+	}
+
+	var reported []string
+	result, err := CreateBundleWithOptions(srcDir, bundlePath, CreateOptions{
+		ContinueOnError: true,
+		OnError: func(path string, err error) {
+			reported = append(reported, filepath.Base(path))
+		},
+	})
+	if err != nil {
+		t.Fatalf("Expected creation to continue, got %v", err)
+	}
+	if result.Files != 1 || result.SkippedErrors != 2 || len(reported) != 2 {
+		t.Errorf("Expected 1 file and 2 skipped errors, got %+v, reported %v", *result, reported)
+	}
+
+	ix, err := NewIxTar(bundlePath)
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	defer ix.Close()
+	if data, err := ix.ExtractBytesOfFile("ok.txt"); err != nil || string(data) != "readable" {
+		t.Errorf("Unexpected content: %q, %v", data, err)
+	}
+}
@@ -0,0 +1,139 @@
+package ixtar
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// streamReaderAt implements io.ReaderAt on top of a plain io.Reader by
+// discarding bytes up to the requested offset. Reads must not go backwards.
+type streamReaderAt struct {
+	mu  sync.Mutex
+	r   io.Reader
+	pos int64
+}
+
+func (s *streamReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if off < s.pos {
+		return 0, fmt.Errorf("stream bundle: read at offset %d after offset %d was consumed", off, s.pos)
+	}
+	if skip := off - s.pos; skip > 0 {
+		n, err := io.CopyN(io.Discard, s.r, skip)
+		s.pos += n
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := io.ReadFull(s.r, p)
+	s.pos += int64(n)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// NewIxTarFromStream opens a bundle from a reader that can't seek, such as a
+// pipe or an HTTP response body, reading the header and the index from the
+// front. Data can only be read front to back: WalkFiles, ExtractAllTo and
+// VerifyAll work, but reads behind an earlier one, including files that
+// share data with an earlier file, fail. The trailer index, if any, is not
+// needed. Read-ahead is disabled and WithMmap and WithReaderPool are not
+// supported. Close does not close r.
+func NewIxTarFromStream(r io.Reader, opts ...OpenOption) (*IxTar, error) {
+	cfg, err := newOpenConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.mmap || cfg.poolSize > 0 {
+		return nil, fmt.Errorf("mmap and reader pool need a bundle file")
+	}
+	if cfg.lowMemory {
+		return nil, fmt.Errorf("WithLowMemoryIndex needs a bundle that can be read at any offset")
+	}
+
+	header, err := readHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	if header.csvSize < 0 {
+		return nil, fmt.Errorf("%w: negative CSV size %d", ErrBadFormat, header.csvSize)
+	}
+
+	csvData, err := readStreamSection(r, header.csvSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV data: %w", err)
+	}
+	infoData, err := readStreamSection(r, int64(header.infoSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read bundle info: %w", err)
+	}
+	if err := header.checkIndexCRC(csvData, infoData); err != nil {
+		return nil, err
+	}
+
+	info, err := parseBundleInfo(infoData)
+	if err != nil {
+		return nil, err
+	}
+	info.warnNewerMinor(orDiscard(cfg.logger), header)
+	aead, err := info.openCipher(header, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if csvData, err = decryptIndex(header, aead, csvData); err != nil {
+		return nil, err
+	}
+
+	index, err := parseCSVIndex(csvData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CSV index: %w", err)
+	}
+	hasher, keyer, err := resolveKeyer(header, info, index, cfg.keyer)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkIndexKeys(index, info); err != nil {
+		return nil, err
+	}
+
+	// Without the total size the data region ends with the last entry
+	var dataSize int64
+	for _, fileIndex := range index.Files {
+		dataSize = max(dataSize, fileIndex.Start+fileIndex.storedSize())
+	}
+	dataOffset := headerSize + header.csvSize + int64(header.infoSize)
+
+	return &IxTar{
+		index:      index,
+		csvSize:    header.csvSize,
+		bundleSize: dataOffset + dataSize,
+		dataOffset: dataOffset,
+		dataSize:   dataSize,
+		reader:     &streamReaderAt{r: r, pos: dataOffset},
+		header:     header,
+		hasher:     hasher,
+		keyer:      keyer,
+		info:       info,
+		verify:     cfg.verifyOnRead,
+		aead:       aead,
+	}, nil
+}
+
+// readStreamSection reads the next n bytes of r. The stream size is unknown,
+// so the buffer grows as data arrives instead of being allocated up front
+// from a possibly corrupt header.
+func readStreamSection(r io.Reader, n int64) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, n))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) != n {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return data, nil
+}
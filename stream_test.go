@@ -0,0 +1,112 @@
+package ixtar
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// readOnly hides everything but Read, like a pipe.
+type readOnly struct {
+	r io.Reader
+}
+
+func (r readOnly) Read(p []byte) (int, error) { return r.r.Read(p) }
+
+func TestTrailerIndex(t *testing.T) {
+	sourceDir := t.TempDir()
+	testFiles := make(map[string]string)
+	for i := 0; i < 10; i++ {
+		name := fmt.Sprintf("file%d.txt", i)
+		testFiles[name] = fmt.Sprintf("content of file %d", i)
+		if err := os.WriteFile(filepath.Join(sourceDir, name), []byte(testFiles[name]), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	bundlePath := filepath.Join(t.TempDir(), "trailer.ixtar")
+	if _, err := CreateBundleWithOptions(sourceDir, bundlePath, CreateOptions{Trailer: true}); err != nil {
+		t.Fatalf("Failed to create bundle: %v", err)
+	}
+
+	ix, err := NewIxTar(bundlePath)
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	layout := ix.Layout()
+	if layout.TrailerSize != layout.CSVSize+trailerFooterSize || layout.TrailerOffset+layout.TrailerSize != layout.TotalSize {
+		t.Errorf("Unexpected trailer layout: %+v", layout)
+	}
+	if err := ix.Validate(); err != nil {
+		t.Errorf("Validate failed: %v", err)
+	}
+	if got, err := ix.ExtractBytesOfFile("file9.txt"); err != nil || string(got) != testFiles["file9.txt"] {
+		t.Errorf("Expected %q, got %q (%v)", testFiles["file9.txt"], got, err)
+	}
+	ix.Close()
+
+	data, err := os.ReadFile(bundlePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trailer := data[layout.TrailerOffset : layout.TrailerOffset+layout.CSVSize]
+	if !bytes.Equal(trailer, data[layout.CSVOffset:layout.CSVOffset+layout.CSVSize]) {
+		t.Error("Trailer index differs from the front index")
+	}
+
+	data[len(data)-trailerFooterSize] = 'X'
+	if err := os.WriteFile(bundlePath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewIxTar(bundlePath); !errors.Is(err, ErrBadFormat) {
+		t.Errorf("Expected ErrBadFormat for a damaged footer, got %v", err)
+	}
+}
+
+func TestNewIxTarFromStream(t *testing.T) {
+	testFiles := make(map[string]string)
+	for i := 0; i < 20; i++ {
+		testFiles[fmt.Sprintf("file%d.txt", i)] = fmt.Sprintf("content of file %d", i)
+	}
+	data, err := os.ReadFile(createTestBundle(t, testFiles))
+	if err != nil {
+		t.Fatalf("Failed to read bundle: %v", err)
+	}
+
+	ix, err := NewIxTarFromStream(readOnly{bytes.NewReader(data)}, WithVerifyOnRead())
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	defer ix.Close()
+
+	if len(ix.ListFiles()) != len(testFiles) {
+		t.Errorf("Expected %d files, got %d", len(testFiles), len(ix.ListFiles()))
+	}
+
+	got := make(map[string]string)
+	err = ix.ExtractAllTo(func(name string, r io.Reader, entry FileStat) error {
+		content, err := io.ReadAll(r)
+		got[name] = string(content)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("ExtractAllTo failed: %v", err)
+	}
+	for path, content := range testFiles {
+		if got[path] != content {
+			t.Errorf("%s: expected %q, got %q", path, content, got[path])
+		}
+	}
+
+	// The stream has been consumed, so going back fails
+	if _, err := ix.ExtractBytesOfFile("file0.txt"); err == nil {
+		t.Error("Expected error reading behind the stream position")
+	}
+
+	if _, err := NewIxTarFromStream(readOnly{bytes.NewReader(data[:headerSize+10])}); err == nil {
+		t.Error("Expected error for a truncated stream")
+	}
+}
@@ -0,0 +1,161 @@
+package ixtar
+
+import (
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// SyncOptions controls SyncWithOptions.
+type SyncOptions struct {
+	// Prune deletes regular files in the destination that are not in the
+	// bundle. Directories are left in place.
+	Prune bool
+	// Open is passed to NewIxTar, such as WithKey or WithPassword for an
+	// encrypted bundle.
+	Open []OpenOption
+}
+
+// SyncResult counts what SyncWithOptions did to the destination.
+type SyncResult struct {
+	Added     int
+	Updated   int
+	Deleted   int
+	Unchanged int
+}
+
+// Sync makes destDir contain the files of the bundle, writing files that are
+// missing or differ. Files not in the bundle are kept; use SyncWithOptions
+// with Prune to delete them.
+func Sync(bundlePath, destDir string) error {
+	_, err := SyncWithOptions(bundlePath, destDir, SyncOptions{})
+	return err
+}
+
+// SyncWithOptions is Sync with options and a summary of the changes made.
+// A local file counts as unchanged when its size matches, its bytes match
+// the bundle's CRC32 and, for sparse files, its holes are zeros; for bundles
+// without stored checksums the bundle data is hashed for the comparison.
+func SyncWithOptions(bundlePath, destDir string, opts SyncOptions) (*SyncResult, error) {
+	ix, err := NewIxTar(bundlePath, opts.Open...)
+	if err != nil {
+		return nil, err
+	}
+	defer ix.Close()
+
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create destination directory: %w", err)
+	}
+
+	result := &SyncResult{}
+	wanted := make(map[string]bool)
+
+	err = ix.ExtractAllTo(func(name string, r io.Reader, entry FileStat) error {
+		outputPath, err := safeJoin(destDir, filepath.FromSlash(name))
+		if err != nil {
+			return err
+		}
+		wanted[outputPath] = true
+
+		info, err := os.Lstat(outputPath)
+		switch {
+		case os.IsNotExist(err):
+			result.Added++
+		case err != nil:
+			return fmt.Errorf("failed to stat %s: %w", outputPath, err)
+		case info.Mode().IsRegular() && info.Size() == entry.Size:
+			same, err := ix.sameAsLocal(outputPath, ix.files()[entry.Hash])
+			if err != nil {
+				return err
+			}
+			if same {
+				result.Unchanged++
+				return nil
+			}
+			result.Updated++
+		default:
+			result.Updated++
+		}
+
+		return writeLocalFile(nil, outputPath, r, entry)
+	})
+	if err != nil {
+		return result, err
+	}
+
+	if opts.Prune {
+		err = filepath.WalkDir(destDir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() || wanted[path] {
+				return nil
+			}
+			if err := os.Remove(path); err != nil {
+				return fmt.Errorf("failed to remove %s: %w", path, err)
+			}
+			result.Deleted++
+			return nil
+		})
+	}
+
+	return result, err
+}
+
+// sameAsLocal reports whether the file at localPath holds the stored bytes of
+// fileIndex. Only the data segments are compared for sparse files. The
+// checksum of compressed and encrypted files covers the stored bytes, so
+// their content is checksummed instead.
+func (ix *IxTar) sameAsLocal(localPath string, fileIndex FileIndex) (bool, error) {
+	want := fileIndex.CRC32
+	if fileIndex.encrypted() {
+		data, err := ix.extractEntry(fileIndex)
+		if err != nil {
+			return false, err
+		}
+		want = formatCRC32(crc32.ChecksumIEEE(data))
+	} else if want == "" || fileIndex.compressed() {
+		sum := crc32.NewIEEE()
+		var r io.Reader = io.NewSectionReader(ix.reader, ix.dataOffset+fileIndex.Start, fileIndex.storedSize())
+		if fileIndex.compressed() {
+			r = inflate(r, fileIndex)
+		}
+		if _, err := io.Copy(sum, r); err != nil {
+			return false, fmt.Errorf("failed to read %s: %w", entryName("", fileIndex), err)
+		}
+		want = formatCRC32(sum.Sum32())
+	}
+
+	f, err := os.Open(localPath)
+	if err != nil {
+		return false, fmt.Errorf("failed to open %s: %w", localPath, err)
+	}
+	defer f.Close()
+
+	segs := fileIndex.Sparse
+	if segs == nil {
+		segs = []SparseSegment{{Offset: 0, Length: fileIndex.Size}}
+	}
+	// The checksum only covers the data segments, so the holes in between
+	// must be zeros locally as well
+	sum := crc32.NewIEEE()
+	buf := make([]byte, defaultCopyBufferSize)
+	var pos int64
+	for _, seg := range append(segs[:len(segs):len(segs)], SparseSegment{Offset: fileIndex.Size}) {
+		zero, err := allZero(f, pos, seg.Offset-pos, buf)
+		if err != nil {
+			return false, fmt.Errorf("failed to read %s: %w", localPath, err)
+		}
+		if !zero {
+			return false, nil
+		}
+		if _, err := io.CopyBuffer(sum, io.NewSectionReader(f, seg.Offset, seg.Length), buf); err != nil {
+			return false, fmt.Errorf("failed to read %s: %w", localPath, err)
+		}
+		pos = seg.Offset + seg.Length
+	}
+	return formatCRC32(sum.Sum32()) == want, nil
+}
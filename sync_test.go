@@ -0,0 +1,118 @@
+package ixtar
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSync(t *testing.T) {
+	bundlePath := createTestBundle(t, map[string]string{
+		"same.txt":      "unchanged content",
+		"changed.txt":   "new content",
+		"resized.txt":   "longer new content",
+		"dir/added.txt": "added content",
+	})
+
+	destDir := t.TempDir()
+	local := map[string]string{
+		"same.txt":    "unchanged content",
+		"changed.txt": "old content",
+		"resized.txt": "short",
+		"extra.txt":   "not in bundle",
+	}
+	for name, content := range local {
+		if err := os.WriteFile(filepath.Join(destDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	result, err := SyncWithOptions(bundlePath, destDir, SyncOptions{})
+	if err != nil {
+		t.Fatalf("Failed to sync: %v", err)
+	}
+	want := SyncResult{Added: 1, Updated: 2, Unchanged: 1}
+	if *result != want {
+		t.Errorf("Expected %+v, got %+v", want, *result)
+	}
+	if _, err := os.Stat(filepath.Join(destDir, "extra.txt")); err != nil {
+		t.Errorf("Expected extra file to survive without Prune: %v", err)
+	}
+
+	for name, content := range map[string]string{
+		"changed.txt":   "new content",
+		"resized.txt":   "longer new content",
+		"dir/added.txt": "added content",
+	} {
+		data, err := os.ReadFile(filepath.Join(destDir, filepath.FromSlash(name)))
+		if err != nil || string(data) != content {
+			t.Errorf("%s: expected %q, got %q (%v)", name, content, data, err)
+		}
+	}
+
+	result, err = SyncWithOptions(bundlePath, destDir, SyncOptions{Prune: true})
+	if err != nil {
+		t.Fatalf("Failed to sync with prune: %v", err)
+	}
+	want = SyncResult{Deleted: 1, Unchanged: 4}
+	if *result != want {
+		t.Errorf("Expected %+v, got %+v", want, *result)
+	}
+	if _, err := os.Stat(filepath.Join(destDir, "extra.txt")); !os.IsNotExist(err) {
+		t.Errorf("Expected extra file to be pruned, got %v", err)
+	}
+}
+
+func TestSyncWithoutStoredChecksums(t *testing.T) {
+	bundlePath := writeRawBundle(t, hashFilePath(md5Hasher{}, "a.txt")+",0,5,a.txt\n", "hello")
+
+	destDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(destDir, "a.txt"), []byte("jello"), 0644); err != nil {
+		t.Fatalf("Failed to write local file: %v", err)
+	}
+
+	result, err := SyncWithOptions(bundlePath, destDir, SyncOptions{})
+	if err != nil {
+		t.Fatalf("Failed to sync: %v", err)
+	}
+	if result.Updated != 1 {
+		t.Errorf("Expected 1 updated file, got %+v", *result)
+	}
+
+	if err := Sync(bundlePath, destDir); err != nil {
+		t.Fatalf("Failed to sync again: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(destDir, "a.txt"))
+	if err != nil || string(data) != "hello" {
+		t.Errorf("Expected synced content, got %q (%v)", data, err)
+	}
+}
+
+func TestSyncSparseDirtyHole(t *testing.T) {
+	bundlePath := writeRawBundle(t, indexCSV(t, map[string]FileIndex{
+		"sparse.bin": {Start: 0, Size: 10, Sparse: []SparseSegment{{Offset: 0, Length: 2}, {Offset: 8, Length: 2}}},
+	}), "abcd")
+	want := "ab\x00\x00\x00\x00\x00\x00cd"
+
+	destDir := t.TempDir()
+	localPath := filepath.Join(destDir, "sparse.bin")
+	// Non-zero bytes in the hole keep the size and the checksum of the data
+	for _, tc := range []struct {
+		local string
+		want  SyncResult
+	}{
+		{want, SyncResult{Unchanged: 1}},
+		{"abXX\x00\x00\x00\x00cd", SyncResult{Updated: 1}},
+	} {
+		if err := os.WriteFile(localPath, []byte(tc.local), 0644); err != nil {
+			t.Fatal(err)
+		}
+		result, err := SyncWithOptions(bundlePath, destDir, SyncOptions{})
+		if err != nil || *result != tc.want {
+			t.Errorf("Local %q: expected %+v, got %+v (%v)", tc.local, tc.want, result, err)
+		}
+		if data, err := os.ReadFile(localPath); err != nil || string(data) != want {
+			t.Errorf("Local %q: expected %q after sync, got %q (%v)", tc.local, want, data, err)
+		}
+	}
+}
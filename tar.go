@@ -0,0 +1,71 @@
+package ixtar
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+)
+
+// tarMetaPrefix prefixes the PAX records AppendToTar stores file metadata in.
+const tarMetaPrefix = "IXTAR.meta."
+
+// AppendToTar writes every file of the bundle to tw in offset order, as a
+// regular file named by its stored path, e.g. to combine several bundles
+// into one tar. tw is not closed. Bundles don't store tar headers, so each
+// entry gets mode 0644 and the creation time of the bundle; metadata set
+// with Builder.SetMeta is kept in PAX records named "IXTAR.meta.<key>".
+// Compressed and sparse files are written expanded, and with
+// WithVerifyOnRead each file is checked before it is written.
+func (ix *IxTar) AppendToTar(tw *tar.Writer) error {
+	return ix.WalkFiles(func(entry FileStat, r io.Reader) error {
+		name := entryName(entry.Hash, FileIndex{Path: entry.Path})
+		hdr := ix.tarHeader(name, entry.Size, ix.files()[entry.Hash].Meta)
+		if err := tw.WriteHeader(hdr); err != nil {
+			return fmt.Errorf("failed to write tar header of %s: %w", name, err)
+		}
+		if _, err := io.Copy(tw, r); err != nil {
+			return fmt.Errorf("failed to write %s to tar: %w", name, err)
+		}
+		return nil
+	})
+}
+
+// ExtractWithHeader returns the content of the file at filePath with a tar
+// header describing it, as AppendToTar would write it, from a single lookup.
+// Directories and missing files return ErrNotRegularFile and
+// ErrFileNotFound like ExtractBytesOfFile.
+func (ix *IxTar) ExtractWithHeader(filePath string) ([]byte, *tar.Header, error) {
+	fileIndex, err := ix.lookup(filePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	data, err := ix.extractEntry(fileIndex)
+	if err != nil {
+		return nil, nil, err
+	}
+	name := fileIndex.Path
+	if name == "" {
+		name = normalizePath(filePath)
+	}
+	return data, ix.tarHeader(name, fileIndex.Size, fileIndex.Meta), nil
+}
+
+// tarHeader returns the header of a regular file of the bundle. Bundles
+// don't store tar headers, so it gets mode 0644 and the creation time of
+// the bundle, with the metadata in PAX records.
+func (ix *IxTar) tarHeader(name string, size int64, meta map[string]string) *tar.Header {
+	hdr := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     size,
+		Mode:     0644,
+		ModTime:  ix.CreatedAt(),
+	}
+	if len(meta) > 0 {
+		hdr.PAXRecords = make(map[string]string, len(meta))
+		for k, v := range meta {
+			hdr.PAXRecords[tarMetaPrefix+k] = v
+		}
+	}
+	return hdr
+}
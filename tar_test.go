@@ -0,0 +1,127 @@
+package ixtar
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAppendToTar(t *testing.T) {
+	first := createTestBundle(t, map[string]string{
+		"a.txt":     "alpha",
+		"dir/b.txt": "bravo",
+		"empty.txt": "",
+	})
+
+	b, err := NewBuilder()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	if err := b.AddBytes("other/c.txt", []byte(strings.Repeat("charlie ", 100))); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.SetMeta("other/c.txt", "owner", "ops"); err != nil {
+		t.Fatal(err)
+	}
+	second := filepath.Join(t.TempDir(), "second.ixtar")
+	if err := b.WriteFile(second); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, bundlePath := range []string{first, second} {
+		ix, err := NewIxTar(bundlePath, WithVerifyOnRead())
+		if err != nil {
+			t.Fatalf("Failed to open bundle: %v", err)
+		}
+		if err := ix.AppendToTar(tw); err != nil {
+			t.Fatalf("AppendToTar failed: %v", err)
+		}
+		ix.Close()
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"a.txt":       "alpha",
+		"dir/b.txt":   "bravo",
+		"empty.txt":   "",
+		"other/c.txt": strings.Repeat("charlie ", 100),
+	}
+	tr := tar.NewReader(&buf)
+	var names []string
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Failed to read tar: %v", err)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != want[hdr.Name] || hdr.Typeflag != tar.TypeReg {
+			t.Errorf("%s: got %q, type %c", hdr.Name, data, hdr.Typeflag)
+		}
+		if hdr.Name == "other/c.txt" && hdr.PAXRecords["IXTAR.meta.owner"] != "ops" {
+			t.Errorf("Expected metadata in PAX records, got %v", hdr.PAXRecords)
+		}
+		names = append(names, hdr.Name)
+	}
+	if len(names) != len(want) || names[len(names)-1] != "other/c.txt" {
+		t.Errorf("Expected the files of both bundles in order, got %v", names)
+	}
+}
+
+func TestExtractWithHeader(t *testing.T) {
+	b, err := NewBuilder()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	if err := b.AddBytes("dir/a.txt", []byte("alpha")); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.SetMeta("dir/a.txt", "owner", "ops"); err != nil {
+		t.Fatal(err)
+	}
+	bundlePath := filepath.Join(t.TempDir(), "header.ixtar")
+	if err := b.WriteFile(bundlePath); err != nil {
+		t.Fatal(err)
+	}
+	ix, err := NewIxTar(bundlePath)
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	defer ix.Close()
+
+	data, hdr, err := ix.ExtractWithHeader("dir/a.txt")
+	if err != nil {
+		t.Fatalf("ExtractWithHeader failed: %v", err)
+	}
+	if string(data) != "alpha" {
+		t.Errorf("Expected alpha, got %q", data)
+	}
+	if hdr.Name != "dir/a.txt" || hdr.Size != 5 || hdr.Typeflag != tar.TypeReg || !hdr.ModTime.Equal(ix.CreatedAt()) {
+		t.Errorf("Unexpected header %+v", hdr)
+	}
+	if hdr.PAXRecords[tarMetaPrefix+"owner"] != "ops" {
+		t.Errorf("Expected the metadata in PAX records, got %v", hdr.PAXRecords)
+	}
+
+	if _, _, err := ix.ExtractWithHeader("dir"); !errors.Is(err, ErrNotRegularFile) {
+		t.Errorf("Expected ErrNotRegularFile for a directory, got %v", err)
+	}
+	if _, _, err := ix.ExtractWithHeader("missing.txt"); !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("Expected ErrFileNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,99 @@
+package ixtar
+
+import (
+	"io/fs"
+	"path"
+	"sort"
+	"time"
+)
+
+// dirEntry is a file or synthesized directory of the tree reconstructed from
+// stored paths. It implements both fs.DirEntry and fs.FileInfo.
+type dirEntry struct {
+	name    string
+	dir     bool
+	size    int64
+	modTime time.Time
+}
+
+func (e *dirEntry) Name() string               { return e.name }
+func (e *dirEntry) IsDir() bool                { return e.dir }
+func (e *dirEntry) Type() fs.FileMode          { return e.Mode().Type() }
+func (e *dirEntry) Info() (fs.FileInfo, error) { return e, nil }
+func (e *dirEntry) Size() int64                { return e.size }
+func (e *dirEntry) ModTime() time.Time         { return e.modTime }
+func (e *dirEntry) Sys() any                   { return nil }
+
+func (e *dirEntry) Mode() fs.FileMode {
+	if e.dir {
+		return fs.ModeDir | 0555
+	}
+	return 0444
+}
+
+// dirTree maps every directory of the bundle, "." being the root, to its
+// entries sorted by name. Directories are synthesized from the stored paths;
+// files of bundles without paths appear in the root under their hash.
+func (ix *IxTar) dirTree() map[string][]fs.DirEntry {
+	modTime := ix.CreatedAt()
+	tree := map[string][]fs.DirEntry{".": nil}
+	known := map[string]bool{".": true}
+
+	for hash, fileIndex := range ix.files() {
+		name := path.Clean(entryName(hash, fileIndex))
+
+		// Add the parent directories up to the first one already known
+		for dir := path.Dir(name); !known[dir]; dir = path.Dir(dir) {
+			known[dir] = true
+			parent := path.Dir(dir)
+			tree[parent] = append(tree[parent], &dirEntry{name: path.Base(dir), dir: true, modTime: modTime})
+		}
+
+		dir := path.Dir(name)
+		tree[dir] = append(tree[dir], &dirEntry{name: path.Base(name), size: fileIndex.Size, modTime: modTime})
+	}
+
+	for _, entries := range tree {
+		sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	}
+	return tree
+}
+
+// Walk walks the directory tree reconstructed from the stored paths like
+// fs.WalkDir: fn is called for the root "." and then for every directory and
+// file in lexical order, with directories synthesized from path prefixes.
+// fs.SkipDir and fs.SkipAll returned by fn have the same meaning as in
+// fs.WalkDir.
+func (ix *IxTar) Walk(fn fs.WalkDirFunc) error {
+	if err := ix.loadFiles(); err != nil {
+		return err
+	}
+	tree := ix.dirTree()
+	root := &dirEntry{name: ".", dir: true, modTime: ix.CreatedAt()}
+
+	err := walkTree(tree, ".", root, fn)
+	if err == fs.SkipDir || err == fs.SkipAll {
+		return nil
+	}
+	return err
+}
+
+func walkTree(tree map[string][]fs.DirEntry, name string, d fs.DirEntry, fn fs.WalkDirFunc) error {
+	if err := fn(name, d, nil); err != nil || !d.IsDir() {
+		if err == fs.SkipDir && d.IsDir() {
+			// Successfully skipped directory
+			err = nil
+		}
+		return err
+	}
+
+	for _, child := range tree[name] {
+		if err := walkTree(tree, path.Join(name, child.Name()), child, fn); err != nil {
+			if err == fs.SkipDir {
+				break
+			}
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package ixtar
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestWalkMatchesWalkDir(t *testing.T) {
+	testFiles := map[string]string{
+		"a.txt":         "alpha",
+		"b/c.txt":       "charlie",
+		"b/d/e.txt":     "echo",
+		"b/d/f.txt":     "foxtrot",
+		"b-sibling.txt": "sibling",
+		"z/y/x.txt":     "xray",
+	}
+	srcDir := t.TempDir()
+	for name, content := range testFiles {
+		path := filepath.Join(srcDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	bundlePath := filepath.Join(t.TempDir(), "tree.ixtar")
+	if err := CreateBundle(srcDir, bundlePath); err != nil {
+		t.Fatalf("Failed to create bundle: %v", err)
+	}
+
+	ix, err := NewIxTar(bundlePath)
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	defer ix.Close()
+
+	type visit struct {
+		path string
+		dir  bool
+	}
+	collect := func(walk func(fs.WalkDirFunc) error, skip string) []visit {
+		var visits []visit
+		err := walk(func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			visits = append(visits, visit{path, d.IsDir()})
+			if path == skip {
+				return fs.SkipDir
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Walk failed: %v", err)
+		}
+		return visits
+	}
+	walkDir := func(fn fs.WalkDirFunc) error { return fs.WalkDir(os.DirFS(srcDir), ".", fn) }
+
+	for _, skip := range []string{"", "b/d", "b/c.txt"} {
+		want := collect(walkDir, skip)
+		got := collect(ix.Walk, skip)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("skip %q: expected %v, got %v", skip, want, got)
+		}
+	}
+
+	var size int64
+	ix.Walk(func(path string, d fs.DirEntry, err error) error {
+		if path == "b/d/f.txt" {
+			info, _ := d.Info()
+			size = info.Size()
+			return fs.SkipAll
+		}
+		return nil
+	})
+	if size != int64(len("foxtrot")) {
+		t.Errorf("Expected size %d from entry info, got %d", len("foxtrot"), size)
+	}
+}
@@ -0,0 +1,150 @@
+package ixtar
+
+import (
+	"fmt"
+	"os"
+)
+
+// CompareMode selects how UpdateBundle decides that a source file changed.
+type CompareMode int
+
+const (
+	// CompareSizeMtime treats a file as changed when its size differs from
+	// the stored size or it was modified after the bundle was created. It
+	// only stats the source files, but misses changes that keep the size
+	// and set an older modification time, and rebuilds the bundle when only
+	// the modification time changed.
+	CompareSizeMtime CompareMode = iota
+	// CompareChecksum treats a file as changed when its size or the CRC32
+	// of its content differs from the bundle's. It reads every source file
+	// of the right size, and the bundle data of files without a stored
+	// checksum, but ignores modification times.
+	CompareChecksum
+)
+
+// UpdateOptions controls UpdateBundle.
+type UpdateOptions struct {
+	// Create is used both to list the source files, as with DryRun, and to
+	// recreate the bundle. Transform is not supported, since transformed
+	// content can't be compared with the source.
+	Create CreateOptions
+	// CompareBy selects how files are compared; the zero value is
+	// CompareSizeMtime.
+	CompareBy CompareMode
+	// Open is passed to NewIxTar when the existing bundle is compared, such
+	// as WithKey or WithPassword for an encrypted bundle. Encryption in
+	// Create only applies to the recreated bundle.
+	Open []OpenOption
+}
+
+// UpdateResult reports what UpdateBundle found.
+type UpdateResult struct {
+	// Changed lists the stored paths of files that were added, removed or
+	// changed since the bundle was created, in no particular order.
+	Changed []string
+	// Updated is true if the bundle was recreated, which is the case when
+	// Changed isn't empty or the bundle didn't exist.
+	Updated bool
+	// Create is the result of recreating the bundle, nil if it wasn't.
+	Create *CreateResult
+}
+
+// UpdateBundle recreates the bundle at bundlePath from sourceDir if any file
+// was added, removed or changed since it was created, and leaves it alone
+// otherwise. A missing bundle is created. Bundles without stored paths are
+// always recreated.
+func UpdateBundle(sourceDir, bundlePath string, opts UpdateOptions) (*UpdateResult, error) {
+	if opts.CompareBy != CompareSizeMtime && opts.CompareBy != CompareChecksum {
+		return nil, fmt.Errorf("invalid compare mode: %d", opts.CompareBy)
+	}
+	if opts.Create.Transform != nil {
+		return nil, fmt.Errorf("UpdateBundle doesn't support Transform")
+	}
+	if opts.Create.DryRun {
+		return nil, fmt.Errorf("UpdateBundle doesn't support DryRun")
+	}
+
+	result := &UpdateResult{}
+	if _, err := os.Stat(bundlePath); err == nil {
+		listOpts := opts.Create
+		listOpts.DryRun, listOpts.Checkpoint = true, ""
+		listOpts.Progress, listOpts.AbortableProgress = nil, nil
+		listed, err := CreateBundleWithOptions(sourceDir, bundlePath, listOpts)
+		if err != nil {
+			return nil, err
+		}
+		if result.Changed, err = changedFiles(bundlePath, listed.Paths, listed.sources, opts.CompareBy, opts.Open); err != nil {
+			return nil, err
+		}
+		if len(result.Changed) == 0 {
+			return result, nil
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to stat bundle file: %w", err)
+	}
+
+	created, err := CreateBundleWithOptions(sourceDir, bundlePath, opts.Create)
+	if err != nil {
+		return nil, err
+	}
+	result.Updated, result.Create = true, created
+	return result, nil
+}
+
+// changedFiles compares the bundle at bundlePath with the source files of
+// the stored paths listed, given in sources, and returns the stored paths
+// that were added, removed or changed.
+func changedFiles(bundlePath string, listed, sources []string, mode CompareMode, openOpts []OpenOption) ([]string, error) {
+	bundleStat, err := os.Stat(bundlePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat bundle file: %w", err)
+	}
+	ix, err := NewIxTar(bundlePath, openOpts...)
+	if err != nil {
+		return nil, err
+	}
+	defer ix.Close()
+
+	// Entries without a path are keyed by hash, so they never match
+	stored := make(map[string]FileIndex, len(ix.files()))
+	for hash, fileIndex := range ix.files() {
+		stored[entryName(hash, fileIndex)] = fileIndex
+	}
+	created := ix.CreatedAt()
+
+	var changed []string
+	seen := make(map[string]bool, len(listed))
+	for i, storedPath := range listed {
+		sourcePath := sources[i]
+		info, err := os.Stat(sourcePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat %s: %w", sourcePath, err)
+		}
+		if os.SameFile(info, bundleStat) {
+			continue
+		}
+		seen[storedPath] = true
+
+		fileIndex, ok := stored[storedPath]
+		differs := !ok || info.Size() != fileIndex.Size
+		if !differs && mode == CompareSizeMtime {
+			differs = info.ModTime().After(created)
+		}
+		if !differs && mode == CompareChecksum {
+			same, err := ix.sameAsLocal(sourcePath, fileIndex)
+			if err != nil {
+				return nil, err
+			}
+			differs = !same
+		}
+		if differs {
+			changed = append(changed, storedPath)
+		}
+	}
+	for name := range stored {
+		if !seen[name] {
+			changed = append(changed, name)
+		}
+	}
+	return changed, nil
+}
@@ -0,0 +1,125 @@
+package ixtar
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestUpdateBundle(t *testing.T) {
+	srcDir := t.TempDir()
+	write := func(name, content string, modTime time.Time) {
+		t.Helper()
+		path := filepath.Join(srcDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := time.Now().Add(-time.Hour)
+	write("a.txt", "alpha", old)
+	write("dir/b.txt", "bravo", old)
+
+	// The bundle lives in the tree it is made from and must not count as
+	// a change itself
+	bundlePath := filepath.Join(srcDir, "self.ixtar")
+	result, err := UpdateBundle(srcDir, bundlePath, UpdateOptions{})
+	if err != nil {
+		t.Fatalf("UpdateBundle failed: %v", err)
+	}
+	if !result.Updated || result.Create.Files != 2 {
+		t.Fatalf("Expected a missing bundle to be created with 2 files, got %+v", result)
+	}
+
+	for _, mode := range []CompareMode{CompareSizeMtime, CompareChecksum} {
+		result, err := UpdateBundle(srcDir, bundlePath, UpdateOptions{CompareBy: mode})
+		if err != nil {
+			t.Fatalf("UpdateBundle failed: %v", err)
+		}
+		if result.Updated || len(result.Changed) != 0 {
+			t.Errorf("mode %d: expected no update, got %+v", mode, result)
+		}
+	}
+
+	// Same size and an old mtime: only the checksum sees the change
+	write("a.txt", "ALPHA", old)
+	result, err = UpdateBundle(srcDir, bundlePath, UpdateOptions{CompareBy: CompareSizeMtime})
+	if err != nil || result.Updated {
+		t.Errorf("Expected size and mtime to miss the change, got %+v (%v)", result, err)
+	}
+	result, err = UpdateBundle(srcDir, bundlePath, UpdateOptions{CompareBy: CompareChecksum})
+	if err != nil || !result.Updated || len(result.Changed) != 1 || result.Changed[0] != "a.txt" {
+		t.Errorf("Expected the checksum to catch a.txt, got %+v (%v)", result, err)
+	}
+
+	// A touched file only counts as changed by modification time
+	write("dir/b.txt", "bravo", time.Now().Add(time.Hour))
+	result, err = UpdateBundle(srcDir, bundlePath, UpdateOptions{CompareBy: CompareChecksum})
+	if err != nil || result.Updated {
+		t.Errorf("Expected the checksum to ignore the mtime, got %+v (%v)", result, err)
+	}
+	result, err = UpdateBundle(srcDir, bundlePath, UpdateOptions{})
+	if err != nil || !result.Updated {
+		t.Errorf("Expected size and mtime to rebuild, got %+v (%v)", result, err)
+	}
+
+	// Added and removed files
+	write("c.txt", "charlie", old)
+	if err := os.Remove(filepath.Join(srcDir, "a.txt")); err != nil {
+		t.Fatal(err)
+	}
+	result, err = UpdateBundle(srcDir, bundlePath, UpdateOptions{CompareBy: CompareChecksum})
+	if err != nil {
+		t.Fatalf("UpdateBundle failed: %v", err)
+	}
+	sort.Strings(result.Changed)
+	if !result.Updated || len(result.Changed) != 2 || result.Changed[0] != "a.txt" || result.Changed[1] != "c.txt" {
+		t.Errorf("Expected a.txt and c.txt to change, got %+v", result)
+	}
+	ix, err := NewIxTar(bundlePath)
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	defer ix.Close()
+	if got, err := ix.ExtractBytesOfFile("c.txt"); err != nil || string(got) != "charlie" {
+		t.Errorf("c.txt: got %q (%v)", got, err)
+	}
+	if _, err := ix.Stat("a.txt"); err == nil {
+		t.Error("Expected a.txt to be gone")
+	}
+}
+
+func TestUpdateBundleSanitizeNamesAndCheckpoint(t *testing.T) {
+	srcDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(srcDir, "bell\a.txt"), []byte("ding"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	bundlePath := filepath.Join(t.TempDir(), "b.ixtar")
+	opts := UpdateOptions{
+		Create:    CreateOptions{SanitizeNames: true, Checkpoint: filepath.Join(t.TempDir(), "ckpt")},
+		CompareBy: CompareChecksum,
+	}
+	if result, err := UpdateBundle(srcDir, bundlePath, opts); err != nil || !result.Updated {
+		t.Fatalf("Expected the bundle to be created, got %+v (%v)", result, err)
+	}
+
+	// The sanitized stored path is compared with the file it came from
+	result, err := UpdateBundle(srcDir, bundlePath, opts)
+	if err != nil || result.Updated {
+		t.Errorf("Expected no update, got %+v (%v)", result, err)
+	}
+	if err := os.WriteFile(filepath.Join(srcDir, "bell\a.txt"), []byte("dong"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	result, err = UpdateBundle(srcDir, bundlePath, opts)
+	if err != nil || !result.Updated || len(result.Changed) != 1 || result.Changed[0] != "bell_.txt" {
+		t.Errorf("Expected bell_.txt to change, got %+v (%v)", result, err)
+	}
+}
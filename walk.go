@@ -0,0 +1,193 @@
+package ixtar
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// defaultReadAheadSize is the read-ahead buffer size used by WalkFiles.
+const defaultReadAheadSize = 1 << 20
+
+// WithReadAheadSize sets the size of the buffer WalkFiles uses to serve
+// consecutive small files from a single read. Zero disables read-ahead.
+func WithReadAheadSize(size int) OpenOption {
+	return func(c *openConfig) {
+		c.readAheadSize = size
+	}
+}
+
+// WalkFiles calls fn for every file in offset order with a reader over the
+// file's content, which returns io.EOF right after the file's last byte. The
+// reader is only valid until fn returns. A file whose data extends past the
+// data region fails with ErrBadFormat rather than reading short. Walking stops
+// at the first error returned by fn. With WithVerifyOnRead each file is
+// checked before fn sees it.
+func (ix *IxTar) WalkFiles(fn func(entry FileStat, r io.Reader) error) error {
+	return ix.walkFiles(func(entry FileStat, r io.Reader, err error) error {
+		if err != nil {
+			return err
+		}
+		return fn(entry, r)
+	})
+}
+
+// walkFiles is WalkFiles with the errors of single files, such as a region
+// past the end of the bundle or a checksum mismatch, passed to fn instead
+// of ending the walk. r is nil when err is set.
+func (ix *IxTar) walkFiles(fn func(entry FileStat, r io.Reader, err error) error) error {
+	if err := ix.loadFiles(); err != nil {
+		return err
+	}
+	ra := &readAhead{r: ix.reader, buf: make([]byte, ix.readAhead)}
+
+	for _, hash := range ix.entriesByOffset() {
+		if err := ix.walkEntry(ra, hash, fn); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// walkFilesConcurrently is walkFiles with fn called from n goroutines at
+// once. Runs of consecutive files, about as large as the read-ahead buffer,
+// are handed out in offset order, and every goroutine reads through its own
+// buffer. The first error returned by fn stops handing out files and is
+// returned once the calls in progress have finished.
+func (ix *IxTar) walkFilesConcurrently(n int, fn func(entry FileStat, r io.Reader, err error) error) error {
+	if err := ix.loadFiles(); err != nil {
+		return err
+	}
+	runs := make(chan []string)
+	done := make(chan struct{})
+	var (
+		wg       sync.WaitGroup
+		failOnce sync.Once
+		firstErr error
+	)
+	for w := 0; w < n; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ra := &readAhead{r: ix.reader, buf: make([]byte, ix.readAhead)}
+			for run := range runs {
+				for _, hash := range run {
+					select {
+					case <-done:
+						return
+					default:
+					}
+					if err := ix.walkEntry(ra, hash, fn); err != nil {
+						failOnce.Do(func() {
+							firstErr = err
+							close(done)
+						})
+						return
+					}
+				}
+			}
+		}()
+	}
+
+	hashes := ix.entriesByOffset()
+feed:
+	for start := 0; start < len(hashes); {
+		end, size := start+1, ix.files()[hashes[start]].storedSize()
+		for end < len(hashes) && size < int64(ix.readAhead) {
+			size += ix.files()[hashes[end]].storedSize()
+			end++
+		}
+		select {
+		case runs <- hashes[start:end]:
+		case <-done:
+			break feed
+		}
+		start = end
+	}
+	close(runs)
+	wg.Wait()
+	return firstErr
+}
+
+// walkEntry reads the file of hash through ra and passes it to fn like
+// walkFiles does.
+func (ix *IxTar) walkEntry(ra *readAhead, hash string, fn func(entry FileStat, r io.Reader, err error) error) error {
+	fileIndex := ix.files()[hash]
+	r, err := ix.walkReader(ra, fileIndex)
+	if err != nil {
+		r = nil
+		if !errors.Is(err, ErrChecksumMismatch) {
+			err = fmt.Errorf("failed to read %s: %w", entryName(hash, fileIndex), err)
+		}
+	}
+	return fn(ix.fileStat(hash, fileIndex), r, err)
+}
+
+// walkReader returns a reader over the content of a file served from ra.
+func (ix *IxTar) walkReader(ra *readAhead, fileIndex FileIndex) (io.Reader, error) {
+	// A region past the data region would end early or run into the trailer
+	if err := ix.checkRegion(fileIndex); err != nil {
+		return nil, err
+	}
+	r, err := ra.region(ix.dataOffset+fileIndex.Start, fileIndex.storedSize())
+	if err != nil {
+		return nil, err
+	}
+
+	verify := ix.verify && fileIndex.CRC32 != ""
+	if fileIndex.Sparse != nil || verify || fileIndex.encrypted() {
+		stored, err := io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		if verify {
+			if err := checkCRC32(fileIndex, stored); err != nil {
+				return nil, err
+			}
+		}
+		if stored, err = ix.decrypt(stored, fileIndex); err != nil {
+			return nil, err
+		}
+		if fileIndex.Sparse != nil {
+			stored = expandSparse(stored, fileIndex)
+		}
+		r = bytes.NewReader(stored)
+	}
+	if fileIndex.compressed() {
+		r = inflate(r, fileIndex)
+	}
+	return r, nil
+}
+
+// readAhead serves regions of r from a buffer that is refilled whenever a
+// region falls outside of it. Regions larger than the buffer are read
+// directly.
+type readAhead struct {
+	r     io.ReaderAt
+	buf   []byte
+	start int64 // offset of buf[0] in r
+	n     int   // valid bytes in buf
+}
+
+func (ra *readAhead) region(off, size int64) (io.Reader, error) {
+	if size > int64(len(ra.buf)) {
+		return io.NewSectionReader(ra.r, off, size), nil
+	}
+
+	if off < ra.start || off+size > ra.start+int64(ra.n) {
+		n, err := ra.r.ReadAt(ra.buf, off)
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if int64(n) < size {
+			return nil, io.ErrUnexpectedEOF
+		}
+		ra.start, ra.n = off, n
+	}
+
+	rel := off - ra.start
+	return bytes.NewReader(ra.buf[rel : rel+size]), nil
+}
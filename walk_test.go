@@ -0,0 +1,201 @@
+package ixtar
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWalkFiles(t *testing.T) {
+	testFiles := map[string]string{
+		"a.txt":     "alpha",
+		"dir/b.txt": "bravo",
+		"empty.txt": "",
+		"big.bin":   string(bytes.Repeat([]byte("0123456789"), 100)),
+	}
+	bundlePath := createTestBundle(t, testFiles)
+
+	for _, readAheadSize := range []int{0, 64, defaultReadAheadSize} {
+		t.Run(fmt.Sprintf("readahead-%d", readAheadSize), func(t *testing.T) {
+			ix, err := NewIxTar(bundlePath, WithReadAheadSize(readAheadSize))
+			if err != nil {
+				t.Fatalf("Failed to open bundle: %v", err)
+			}
+			defer ix.Close()
+
+			seen := 0
+			lastStart := int64(-1)
+			err = ix.WalkFiles(func(entry FileStat, r io.Reader) error {
+				data, err := io.ReadAll(r)
+				if err != nil {
+					return err
+				}
+				if string(data) != testFiles[entry.Path] {
+					t.Errorf("Content mismatch for %s: %q", entry.Path, data)
+				}
+				if entry.Start < lastStart {
+					t.Errorf("Files not walked in offset order")
+				}
+				lastStart = entry.Start
+				seen++
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("WalkFiles failed: %v", err)
+			}
+			if seen != len(testFiles) {
+				t.Errorf("Expected %d files, walked %d", len(testFiles), seen)
+			}
+		})
+	}
+}
+
+func benchmarkWalkFiles(b *testing.B, readAheadSize int) {
+	builder, err := NewBuilder()
+	if err != nil {
+		b.Fatalf("Failed to create builder: %v", err)
+	}
+	defer builder.Close()
+
+	content := bytes.Repeat([]byte{'x'}, 1024)
+	for i := 0; i < 50000; i++ {
+		if err := builder.AddBytes(fmt.Sprintf("file%d.txt", i), content); err != nil {
+			b.Fatal(err)
+		}
+	}
+	bundlePath := filepath.Join(b.TempDir(), "bench.ixtar")
+	if err := builder.WriteFile(bundlePath); err != nil {
+		b.Fatal(err)
+	}
+
+	ix, err := NewIxTar(bundlePath, WithReadAheadSize(readAheadSize))
+	if err != nil {
+		b.Fatalf("Failed to open bundle: %v", err)
+	}
+	defer ix.Close()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		err := ix.WalkFiles(func(entry FileStat, r io.Reader) error {
+			_, err := io.Copy(io.Discard, r)
+			return err
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkWalkFilesNoReadAhead(b *testing.B) { benchmarkWalkFiles(b, 0) }
+
+func BenchmarkWalkFilesReadAhead(b *testing.B) { benchmarkWalkFiles(b, defaultReadAheadSize) }
+
+func TestWalkFilesEOF(t *testing.T) {
+	// Files back to back, so a reader running past its end would see the
+	// next one
+	data := `{"a":1}` + "one\ntwo\n" + `{"b":2}`
+	files := map[string]FileIndex{
+		"a.json":    {Start: 0, Size: 7},
+		"lines.txt": {Start: 7, Size: 8},
+		"empty.txt": {Start: 15, Size: 0},
+		"b.json":    {Start: 15, Size: 7},
+	}
+	bundlePath := writeRawBundle(t, indexCSV(t, files), data)
+
+	for _, readAheadSize := range []int{0, 4, defaultReadAheadSize} {
+		t.Run(fmt.Sprintf("readahead-%d", readAheadSize), func(t *testing.T) {
+			ix, err := NewIxTar(bundlePath, WithReadAheadSize(readAheadSize))
+			if err != nil {
+				t.Fatalf("Failed to open bundle: %v", err)
+			}
+			defer ix.Close()
+
+			err = ix.WalkFiles(func(entry FileStat, r io.Reader) error {
+				want := data[entry.Start : entry.Start+entry.Size]
+				switch path.Ext(entry.Path) {
+				case ".json":
+					dec := json.NewDecoder(r)
+					var v map[string]int
+					if err := dec.Decode(&v); err != nil {
+						t.Errorf("%s: %v", entry.Path, err)
+					}
+					if err := dec.Decode(&v); err != io.EOF {
+						t.Errorf("%s: expected io.EOF after one value, got %v", entry.Path, err)
+					}
+				case ".txt":
+					scanner := bufio.NewScanner(r)
+					var lines []string
+					for scanner.Scan() {
+						lines = append(lines, scanner.Text())
+					}
+					if err := scanner.Err(); err != nil {
+						t.Errorf("%s: %v", entry.Path, err)
+					}
+					if got := strings.Join(lines, "\n"); got != strings.TrimSuffix(want, "\n") {
+						t.Errorf("%s: scanned %q", entry.Path, got)
+					}
+				}
+
+				// Further reads keep returning io.EOF without data
+				buf := make([]byte, 64)
+				for i := 0; i < 2; i++ {
+					if n, err := r.Read(buf); n != 0 || err != io.EOF {
+						t.Errorf("%s: read past the end returned %d, %v", entry.Path, n, err)
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("WalkFiles failed: %v", err)
+			}
+		})
+	}
+}
+
+func TestWalkFilesReadsExactSize(t *testing.T) {
+	data := "alphabravo"
+	bundlePath := writeRawBundle(t, indexCSV(t, map[string]FileIndex{
+		"a.txt":     {Start: 0, Size: 5},
+		"empty.txt": {Start: 5, Size: 0},
+		"b.txt":     {Start: 5, Size: 5},
+		"long.txt":  {Start: 8, Size: 100},
+	}), data)
+
+	for _, readAheadSize := range []int{0, 4, defaultReadAheadSize} {
+		t.Run(fmt.Sprintf("readahead-%d", readAheadSize), func(t *testing.T) {
+			ix, err := NewIxTar(bundlePath, WithReadAheadSize(readAheadSize))
+			if err != nil {
+				t.Fatalf("Failed to open bundle: %v", err)
+			}
+			defer ix.Close()
+
+			var walked []string
+			err = ix.WalkFiles(func(entry FileStat, r io.Reader) error {
+				buf := make([]byte, 64)
+				n, err := io.ReadFull(r, buf)
+				if err != io.ErrUnexpectedEOF && !(n == 0 && err == io.EOF) {
+					t.Errorf("%s: expected a short read, got %d, %v", entry.Path, n, err)
+				}
+				if got, want := string(buf[:n]), data[entry.Start:min(entry.Start+entry.Size, int64(len(data)))]; got != want {
+					t.Errorf("%s: read %q, want %q", entry.Path, got, want)
+				}
+				walked = append(walked, entry.Path)
+				return nil
+			})
+			// The region past the end of the data fails instead of ending early
+			if !errors.Is(err, ErrBadFormat) {
+				t.Errorf("Expected ErrBadFormat for long.txt, got %v", err)
+			}
+			if len(walked) != 3 {
+				t.Errorf("Expected the files before long.txt to be walked, got %v", walked)
+			}
+		})
+	}
+}